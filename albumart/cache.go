@@ -0,0 +1,144 @@
+package albumart
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"errors"
+	"fmt"
+	"image"
+	// album art is jpeg or png
+	_ "image/jpeg"
+	_ "image/png"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"time"
+
+	sp "github.com/nollbit/spotify"
+	log "github.com/sirupsen/logrus"
+	"gopkg.in/alecthomas/kingpin.v2"
+)
+
+var (
+	albumArtCacheFlag = kingpin.Flag("album-art-cache", "Where to keep downloaded album art. Defaults to the user cache directory.").String()
+)
+
+const (
+	// the smallest image that still looks good in a big terminal
+	preferredImageSize = 200
+	// a cover that takes longer than this isn't worth waiting for
+	downloadTimeout = 10 * time.Second
+)
+
+var (
+	ErrorNoAlbumArt = errors.New("Track has no album art")
+)
+
+// Cache fetches album art and keeps a copy on disk, so every cover is only
+// downloaded once
+type Cache struct {
+	dir    string
+	client *http.Client
+}
+
+// NewCache creates a cache in a directory, creating it if needed
+func NewCache(dir string) (*Cache, error) {
+	err := os.MkdirAll(dir, 0755)
+	if err != nil {
+		return nil, err
+	}
+	return &Cache{dir: dir, client: &http.Client{Timeout: downloadTimeout}}, nil
+}
+
+// NewCacheFromFlags creates a cache in the directory given by --album-art-cache
+func NewCacheFromFlags() (*Cache, error) {
+	dir := *albumArtCacheFlag
+	if dir == "" {
+		userCache, err := os.UserCacheDir()
+		if err != nil {
+			return nil, err
+		}
+		dir = filepath.Join(userCache, "musikmaskinen", "album-art")
+	}
+	return NewCache(dir)
+}
+
+// ForTrack returns the album art of a Spotify track
+func (c *Cache) ForTrack(track sp.FullTrack) (image.Image, error) {
+	img, ok := pickImage(track.Album.Images)
+	if !ok {
+		return nil, ErrorNoAlbumArt
+	}
+
+	return c.load(img.URL, func() ([]byte, error) {
+		log.Debugf("Downloading album art %s", img.URL)
+		return c.download(img.URL)
+	})
+}
+
+// download gets an image, giving up after downloadTimeout
+func (c *Cache) download(url string) ([]byte, error) {
+	resp, err := c.client.Get(url)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("Unable to download album art %s: %s", url, resp.Status)
+	}
+	return ioutil.ReadAll(resp.Body)
+}
+
+// load decodes the cached image for a key, calling fetch when it isn't cached
+// or the cached copy is broken
+func (c *Cache) load(key string, fetch func() ([]byte, error)) (image.Image, error) {
+	path := filepath.Join(c.dir, fmt.Sprintf("%x", sha1.Sum([]byte(key))))
+
+	data, err := ioutil.ReadFile(path)
+	if err == nil {
+		img, _, err := image.Decode(bytes.NewReader(data))
+		if err == nil {
+			return img, nil
+		}
+		log.WithError(err).Warnf("Cached album art %s is broken, downloading it again", path)
+	}
+
+	data, err = fetch()
+	if err != nil {
+		return nil, err
+	}
+
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+
+	err = ioutil.WriteFile(path, data, 0644)
+	if err != nil {
+		log.WithError(err).Warn("Unable to cache album art")
+	}
+	return img, nil
+}
+
+// pickImage picks the smallest image that's big enough, or the biggest one
+func pickImage(images []sp.Image) (sp.Image, bool) {
+	if len(images) == 0 {
+		return sp.Image{}, false
+	}
+
+	best := images[0]
+	for _, img := range images[1:] {
+		bigEnough := img.Width >= preferredImageSize
+		bestBigEnough := best.Width >= preferredImageSize
+		switch {
+		case bigEnough && (!bestBigEnough || img.Width < best.Width):
+			best = img
+		case !bigEnough && !bestBigEnough && img.Width > best.Width:
+			best = img
+		}
+	}
+
+	return best, true
+}
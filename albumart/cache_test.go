@@ -0,0 +1,128 @@
+package albumart
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/png"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	sp "github.com/nollbit/spotify"
+)
+
+func testPNG(t *testing.T, c color.Color) []byte {
+	img := image.NewRGBA(image.Rect(0, 0, 2, 2))
+	for y := 0; y < 2; y++ {
+		for x := 0; x < 2; x++ {
+			img.Set(x, y, c)
+		}
+	}
+	var b bytes.Buffer
+	if err := png.Encode(&b, img); err != nil {
+		t.Fatal(err)
+	}
+	return b.Bytes()
+}
+
+// testCache is a cache in a temporary directory with a server that counts the
+// downloads
+func testCache(t *testing.T, handler http.HandlerFunc) (*Cache, *sp.FullTrack, *int, func()) {
+	dir, err := ioutil.TempDir("", "albumart")
+	if err != nil {
+		t.Fatal(err)
+	}
+	c, err := NewCache(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	downloads := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		downloads++
+		handler(w, r)
+	}))
+
+	track := &sp.FullTrack{}
+	track.Album.Images = []sp.Image{{URL: server.URL + "/cover.png", Width: 300}}
+
+	return c, track, &downloads, func() {
+		server.Close()
+		os.RemoveAll(dir)
+	}
+}
+
+func TestCacheHitAndMiss(t *testing.T) {
+	cover := testPNG(t, color.RGBA{0xff, 0, 0, 0xff})
+	c, track, downloads, done := testCache(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Write(cover)
+	})
+	defer done()
+
+	for i := 0; i < 2; i++ {
+		img, err := c.ForTrack(*track)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if r, _, _, _ := img.At(0, 0).RGBA(); r>>8 != 0xff {
+			t.Errorf("got the wrong image")
+		}
+	}
+	if *downloads != 1 {
+		t.Errorf("downloaded %d times, want once", *downloads)
+	}
+}
+
+func TestCacheCorrupt(t *testing.T) {
+	cover := testPNG(t, color.RGBA{0, 0xff, 0, 0xff})
+	c, track, downloads, done := testCache(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Write(cover)
+	})
+	defer done()
+
+	if _, err := c.ForTrack(*track); err != nil {
+		t.Fatal(err)
+	}
+
+	files, err := filepath.Glob(filepath.Join(c.dir, "*"))
+	if err != nil || len(files) != 1 {
+		t.Fatalf("want one cached file, got %v (%v)", files, err)
+	}
+	if err := ioutil.WriteFile(files[0], []byte("not an image"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := c.ForTrack(*track); err != nil {
+		t.Fatalf("a broken cached file wasn't downloaded again: %v", err)
+	}
+	if *downloads != 2 {
+		t.Errorf("downloaded %d times, want twice", *downloads)
+	}
+
+	data, err := ioutil.ReadFile(files[0])
+	if err != nil || !bytes.Equal(data, cover) {
+		t.Errorf("the broken cached file wasn't replaced")
+	}
+}
+
+func TestCacheFailedDownload(t *testing.T) {
+	c, track, _, done := testCache(t, func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "gone", http.StatusNotFound)
+	})
+	defer done()
+
+	if _, err := c.ForTrack(*track); err == nil {
+		t.Error("a failed download gave no error")
+	}
+	if files, _ := filepath.Glob(filepath.Join(c.dir, "*")); len(files) != 0 {
+		t.Errorf("a failed download was cached: %v", files)
+	}
+
+	if _, err := c.ForTrack(sp.FullTrack{}); err != ErrorNoAlbumArt {
+		t.Errorf("a track without images gave %v, want %v", err, ErrorNoAlbumArt)
+	}
+}
@@ -1,9 +1,12 @@
 package controller
 
 import (
+	"context"
 	"errors"
 	"io"
 	"path/filepath"
+	"sync"
+	"time"
 
 	log "github.com/sirupsen/logrus"
 
@@ -25,6 +28,15 @@ const (
 	// CommandLedGlow : glow the controller led
 	CommandLedGlow = byte('G')
 
+	// CommandLedOn : Turn on the controller led, no blinking
+	CommandLedOn = byte('N')
+
+	// CommandLedBlinkInterval : Set the blink interval. Followed by one byte, in tens of milliseconds
+	CommandLedBlinkInterval = byte('I')
+
+	// CommandLedGlowInterval : Set the glow step interval. Followed by one byte, in milliseconds
+	CommandLedGlowInterval = byte('R')
+
 	// EventCmdRotaryEncoderClockwise means that the rotary knob was turned clockwise one stop
 	EventCmdRotaryEncoderClockwise = byte('W')
 
@@ -36,33 +48,190 @@ const (
 
 	// EventCmdPushButton means that the push button was pushed
 	EventCmdPushButton = byte('P')
+
+	// EventCmdSkip asks for the current track to be skipped. The Arduino controller doesn't send this.
+	EventCmdSkip = byte('S')
+
+	// EventCmdVolumeUp asks for the volume to be turned up a step
+	EventCmdVolumeUp = byte('+')
+
+	// EventCmdVolumeDown asks for the volume to be turned down a step
+	EventCmdVolumeDown = byte('-')
+)
+
+const (
+	// how many times we try to reopen the port before giving up
+	reconnectAttempts = 30
+	reconnectInterval = 1 * time.Second
 )
 
 type (
+	// Controller merges the events of every attached port (the serial controller,
+	// network controllers, ...) into CommandEvents, and sends commands to all of them
 	Controller struct {
-		port          io.ReadWriteCloser
+		ctx           context.Context
+		ports         map[io.ReadWriteCloser]string
+		listeners     []io.Closer
+		portLock      sync.Mutex
+		ledCommand    []byte // the latest LED command, replayed to ports attached later
 		CommandEvents chan byte
 		Errs          chan error
+		// signalled when the serial port was lost and has been opened again
+		Reconnects chan struct{}
 	}
 )
 
-func (c *Controller) WriteCommand(b byte) error {
-	if c.port == nil {
-		log.Debugf("Dummy controller not sending command %b", b)
+// WriteCommand sends a command, and any argument bytes it takes, to the controller
+func (c *Controller) WriteCommand(b byte, args ...byte) error {
+	return c.write(append([]byte{b}, args...))
+}
+
+func (c *Controller) write(cmd []byte) error {
+	c.portLock.Lock()
+	defer c.portLock.Unlock()
+
+	if len(c.ports) == 0 {
+		log.Debugf("Dummy controller not sending command %v", cmd)
 		return nil
 	}
-	log.Debugf("Sending command %b to controller", b)
-	_, err := c.port.Write([]byte{b})
-	return err
+
+	var firstErr error
+	for port, name := range c.ports {
+		log.Debugf("Sending command %v to controller %s", cmd, name)
+		_, err := port.Write(cmd)
+		if err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
 }
 
+// Close closes every port and stops accepting network controllers. It's done
+// automatically when the context of the controller is done.
 func (c *Controller) Close() {
-	if c.port != nil {
-		c.port.Close()
+	c.portLock.Lock()
+	defer c.portLock.Unlock()
+
+	for port := range c.ports {
+		port.Close()
+	}
+	c.ports = make(map[io.ReadWriteCloser]string)
+
+	for _, l := range c.listeners {
+		l.Close()
 	}
+	c.listeners = nil
 }
 
-func NewController() (*Controller, error) {
+// closing is true once the controller is shutting down, when errors from
+// closed ports are expected
+func (c *Controller) closing() bool {
+	return c.ctx.Err() != nil
+}
+
+// emit forwards a command from a port, it returns false when the controller
+// is shutting down and nobody is listening any more
+func (c *Controller) emit(cmd byte) bool {
+	select {
+	case c.CommandEvents <- cmd:
+		return true
+	case <-c.ctx.Done():
+		return false
+	}
+}
+
+// listen keeps a listener to close when the controller shuts down
+func (c *Controller) listen(l io.Closer) {
+	c.portLock.Lock()
+	defer c.portLock.Unlock()
+
+	c.listeners = append(c.listeners, l)
+}
+
+// attach starts sending commands to the port, including the current LED state
+func (c *Controller) attach(port io.ReadWriteCloser, name string) {
+	c.portLock.Lock()
+	defer c.portLock.Unlock()
+
+	log.Infof("Attaching controller %s", name)
+	c.ports[port] = name
+
+	if c.ledCommand != nil {
+		if _, err := port.Write(c.ledCommand); err != nil {
+			log.WithError(err).Warnf("Unable to send LED state to controller %s", name)
+		}
+	}
+}
+
+func (c *Controller) detach(port io.ReadWriteCloser) {
+	c.portLock.Lock()
+	defer c.portLock.Unlock()
+
+	if name, ok := c.ports[port]; ok {
+		log.Infof("Detaching controller %s", name)
+		delete(c.ports, port)
+	}
+	port.Close()
+}
+
+// read forwards events from the port until reading fails
+func (c *Controller) read(port io.Reader, name string) error {
+	buf := make([]byte, 8)
+	for {
+		n, err := port.Read(buf)
+		if err != nil {
+			return err
+		}
+
+		for i := 0; i < n; i++ {
+			b := buf[i]
+
+			log.Debugf("Got command %b from controller %s", b, name)
+			if !c.emit(b) {
+				return nil
+			}
+		}
+	}
+}
+
+// serve attaches the port and forwards its events until it goes away
+func (c *Controller) serve(port io.ReadWriteCloser, name string) {
+	c.attach(port, name)
+	defer c.detach(port)
+
+	err := c.read(port, name)
+	if err != nil && err != io.EOF && !c.closing() {
+		log.WithError(err).Warnf("Error reading from controller %s", name)
+	}
+}
+
+// reconnect detaches the serial port and tries to open it again
+func (c *Controller) reconnect(port io.ReadWriteCloser, options serial.OpenOptions) (io.ReadWriteCloser, error) {
+	c.detach(port)
+
+	var err error
+	for i := 0; i < reconnectAttempts; i++ {
+		select {
+		case <-time.After(reconnectInterval):
+		case <-c.ctx.Done():
+			return nil, c.ctx.Err()
+		}
+
+		port, err = serial.Open(options)
+		if err != nil {
+			log.WithError(err).Debugf("Unable to reopen controller port (attempt %d)", i+1)
+			continue
+		}
+
+		c.attach(port, options.PortName)
+		return port, nil
+	}
+
+	return nil, err
+}
+
+// NewController opens the serial controller. It's closed when the context is done.
+func NewController(ctx context.Context) (*Controller, error) {
 
 	log.Infof("controllerPortFlag = %s", *controllerPortFlag)
 
@@ -92,29 +261,30 @@ func NewController() (*Controller, error) {
 		return nil, err
 	}
 
-	commandChan := make(chan byte)
-	errChan := make(chan error)
-	controller := &Controller{
-		port:          port,
-		CommandEvents: commandChan,
-		Errs:          errChan,
-	}
+	controller := NewDummyController(ctx)
+	controller.attach(port, controllerPort)
 
 	go func() {
-		buf := make([]byte, 8)
 		for {
+			err := controller.read(port, controllerPort)
+			if controller.closing() {
+				return
+			}
+			log.WithError(err).Error("Error reading from controller port")
 
-			n, err := port.Read(buf)
+			port, err = controller.reconnect(port, options)
+			if controller.closing() {
+				return
+			}
 			if err != nil {
-				log.WithError(err).Error("Error reading from controller port")
-				errChan <- err
+				controller.Errs <- err
+				return
 			}
 
-			for i := 0; i < n; i++ {
-				b := buf[i]
-
-				log.Debugf("Got command %b from controller", b)
-				commandChan <- b
+			select {
+			case controller.Reconnects <- struct{}{}:
+			case <-ctx.Done():
+				return
 			}
 		}
 	}()
@@ -122,16 +292,25 @@ func NewController() (*Controller, error) {
 	return controller, nil
 }
 
-// NewDummyController creates a controller that never emits events
-func NewDummyController() *Controller {
+// NewDummyController creates a controller without any ports attached. It never
+// emits events unless network controllers are attached to it. Everything
+// attached to it is closed when the context is done.
+func NewDummyController(ctx context.Context) *Controller {
 	commandChan := make(chan byte)
 	errChan := make(chan error)
 	controller := &Controller{
-		port:          nil,
+		ctx:           ctx,
+		ports:         make(map[io.ReadWriteCloser]string),
 		CommandEvents: commandChan,
 		Errs:          errChan,
+		Reconnects:    make(chan struct{}),
 	}
 
+	go func() {
+		<-ctx.Done()
+		controller.Close()
+	}()
+
 	return controller
 }
 
@@ -0,0 +1,174 @@
+package controller
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"strconv"
+
+	"gopkg.in/alecthomas/kingpin.v2"
+)
+
+var (
+	controllerEvdevFlag       = kingpin.Flag("controller-evdev", "Linux input device to use as a controller, e.g. /dev/input/event3. Globs are allowed. Can be repeated.").Strings()
+	controllerEvdevConfigFlag = kingpin.Flag("controller-evdev-config", "JSON file mapping input events to controller commands").ExistingFile()
+)
+
+type (
+	// EvdevConfig describes how input events are turned into controller commands
+	EvdevConfig struct {
+		// Grab takes the devices for ourselves so that i.e. media keys don't reach the desktop
+		Grab     bool           `json:"grab"`
+		Mappings []EvdevMapping `json:"mappings"`
+	}
+
+	// EvdevMapping turns a matching input event into a controller command.
+	//
+	// Type and Code are either names ("EV_REL", "REL_DIAL") or numbers. Value is
+	// "press", "release", "repeat", "+" (any positive), "-" (any negative) or an
+	// exact number. For "+" and "-" the command is sent once for every Divider
+	// units the axis has moved, which tames sensitive knobs.
+	EvdevMapping struct {
+		Type    string `json:"type"`
+		Code    string `json:"code"`
+		Value   string `json:"value"`
+		Command string `json:"command"`
+		Divider int    `json:"divider"`
+	}
+)
+
+var (
+	evdevTypes = map[string]uint16{
+		"EV_SYN": 0x00,
+		"EV_KEY": 0x01,
+		"EV_REL": 0x02,
+		"EV_ABS": 0x03,
+	}
+
+	evdevCodes = map[string]uint16{
+		"REL_X":            0x00,
+		"REL_Y":            0x01,
+		"REL_DIAL":         0x07,
+		"REL_WHEEL":        0x08,
+		"ABS_X":            0x00,
+		"ABS_Y":            0x01,
+		"ABS_HAT0X":        0x10,
+		"ABS_HAT0Y":        0x11,
+		"KEY_ENTER":        28,
+		"KEY_SPACE":        57,
+		"KEY_UP":           103,
+		"KEY_DOWN":         108,
+		"KEY_VOLUMEDOWN":   114,
+		"KEY_VOLUMEUP":     115,
+		"KEY_NEXTSONG":     163,
+		"KEY_PLAYPAUSE":    164,
+		"KEY_PREVIOUSSONG": 165,
+		"BTN_0":            0x100,
+		"BTN_LEFT":         0x110,
+		"BTN_RIGHT":        0x111,
+		"BTN_SOUTH":        0x130,
+		"BTN_EAST":         0x131,
+		"BTN_START":        0x13b,
+	}
+)
+
+// DefaultEvdevConfig works with a Griffin PowerMate, a mouse wheel, media keys
+// and most gamepads
+func DefaultEvdevConfig() *EvdevConfig {
+	return &EvdevConfig{
+		Mappings: []EvdevMapping{
+			// PowerMate and mouse wheels
+			{Type: "EV_REL", Code: "REL_DIAL", Value: "+", Command: "clockwise", Divider: 2},
+			{Type: "EV_REL", Code: "REL_DIAL", Value: "-", Command: "counter-clockwise", Divider: 2},
+			{Type: "EV_REL", Code: "REL_WHEEL", Value: "-", Command: "clockwise"},
+			{Type: "EV_REL", Code: "REL_WHEEL", Value: "+", Command: "counter-clockwise"},
+			{Type: "EV_KEY", Code: "BTN_0", Value: "press", Command: "button"},
+			{Type: "EV_KEY", Code: "BTN_LEFT", Value: "press", Command: "button"},
+			// media keys and keyboards
+			{Type: "EV_KEY", Code: "KEY_NEXTSONG", Value: "press", Command: "clockwise"},
+			{Type: "EV_KEY", Code: "KEY_PREVIOUSSONG", Value: "press", Command: "counter-clockwise"},
+			{Type: "EV_KEY", Code: "KEY_PLAYPAUSE", Value: "press", Command: "button"},
+			{Type: "EV_KEY", Code: "KEY_VOLUMEUP", Value: "press", Command: "volume-up"},
+			{Type: "EV_KEY", Code: "KEY_VOLUMEDOWN", Value: "press", Command: "volume-down"},
+			// gamepads
+			{Type: "EV_ABS", Code: "ABS_HAT0Y", Value: "1", Command: "clockwise"},
+			{Type: "EV_ABS", Code: "ABS_HAT0Y", Value: "-1", Command: "counter-clockwise"},
+			{Type: "EV_KEY", Code: "BTN_SOUTH", Value: "press", Command: "button"},
+		},
+	}
+}
+
+// LoadEvdevConfig reads an EvdevConfig from a JSON file
+func LoadEvdevConfig(path string) (*EvdevConfig, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	config := &EvdevConfig{}
+	err = json.Unmarshal(b, config)
+	if err != nil {
+		return nil, fmt.Errorf("Unable to parse %s: %v", path, err)
+	}
+
+	return config, nil
+}
+
+func (e *EvdevConfig) matchers() ([]*eventMatcher, error) {
+	matchers := make([]*eventMatcher, 0, len(e.Mappings))
+
+	for _, m := range e.Mappings {
+		evType, err := parseEvdevNumber(m.Type, evdevTypes)
+		if err != nil {
+			return nil, err
+		}
+
+		code, err := parseEvdevNumber(m.Code, evdevCodes)
+		if err != nil {
+			return nil, err
+		}
+
+		matcher, err := newEventMatcher(evType, code, m.Value, m.Command, m.Divider)
+		if err != nil {
+			return nil, err
+		}
+
+		matchers = append(matchers, matcher)
+	}
+
+	return matchers, nil
+}
+
+func parseEvdevNumber(s string, names map[string]uint16) (uint16, error) {
+	if n, ok := names[s]; ok {
+		return n, nil
+	}
+
+	n, err := strconv.ParseUint(s, 0, 16)
+	if err != nil {
+		return 0, fmt.Errorf("Unknown input event type or code %q", s)
+	}
+	return uint16(n), nil
+}
+
+// evdevConfigFromFlags returns the config given by --controller-evdev-config or the default one
+func evdevConfigFromFlags() (*EvdevConfig, error) {
+	if *controllerEvdevConfigFlag == "" {
+		return DefaultEvdevConfig(), nil
+	}
+	return LoadEvdevConfig(*controllerEvdevConfigFlag)
+}
+
+// AttachEvdevFromFlags attaches the input devices given by --controller-evdev
+func (c *Controller) AttachEvdevFromFlags() error {
+	if len(*controllerEvdevFlag) == 0 {
+		return nil
+	}
+
+	config, err := evdevConfigFromFlags()
+	if err != nil {
+		return err
+	}
+
+	return c.AttachEvdev(*controllerEvdevFlag, config)
+}
@@ -0,0 +1,102 @@
+package controller
+
+import (
+	"encoding/binary"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"syscall"
+
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	// _IOW('E', 0x90, int)
+	evdevIoctlGrab = 0x40044590
+)
+
+type (
+	// inputEvent is struct input_event from linux/input.h
+	inputEvent struct {
+		Time  syscall.Timeval
+		Type  uint16
+		Code  uint16
+		Value int32
+	}
+
+	// evdevDevice is an input device attached to a controller. Input devices
+	// have no LED, so commands sent to them are dropped.
+	evdevDevice struct {
+		io.ReadCloser
+	}
+)
+
+func (d *evdevDevice) Write(b []byte) (int, error) {
+	return len(b), nil
+}
+
+// AttachEvdev starts reading controller events from Linux input devices. Paths
+// can be globs, i.e. /dev/input/by-id/*PowerMate*-event*
+func (c *Controller) AttachEvdev(paths []string, config *EvdevConfig) error {
+	devices := make([]string, 0, len(paths))
+	for _, p := range paths {
+		matches, err := filepath.Glob(p)
+		if err != nil {
+			return err
+		}
+		devices = append(devices, matches...)
+	}
+
+	if len(devices) == 0 {
+		return errors.New("No input devices found for controller")
+	}
+
+	for _, path := range devices {
+		matchers, err := config.matchers()
+		if err != nil {
+			return err
+		}
+
+		f, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+
+		if config.Grab {
+			_, _, errno := syscall.Syscall(syscall.SYS_IOCTL, f.Fd(), evdevIoctlGrab, 1)
+			if errno != 0 {
+				log.WithError(errno).Warnf("Unable to grab input device %s", path)
+			}
+		}
+
+		go c.serveEvdev(&evdevDevice{f}, path, matchers)
+	}
+
+	return nil
+}
+
+func (c *Controller) serveEvdev(d *evdevDevice, name string, matchers []*eventMatcher) {
+	c.attach(d, name)
+	defer c.detach(d)
+
+	for {
+		var e inputEvent
+		err := binary.Read(d, binary.LittleEndian, &e)
+		if err != nil {
+			if err != io.EOF && !c.closing() {
+				log.WithError(err).Warnf("Error reading from input device %s", name)
+			}
+			return
+		}
+
+		for _, m := range matchers {
+			for i := m.commands(e.Type, e.Code, e.Value); i > 0; i-- {
+				log.Debugf("Got command %b from input device %s", m.command, name)
+				if !c.emit(m.command) {
+					return
+				}
+			}
+		}
+	}
+}
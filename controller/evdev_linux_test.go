@@ -0,0 +1,116 @@
+package controller
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"io/ioutil"
+	"testing"
+	"time"
+)
+
+// rawInputEvent is a struct input_event the way the kernel writes it on 64 bit
+func rawInputEvent(evType uint16, code uint16, value int32) []byte {
+	b := make([]byte, 24)
+	// the time is left at zero, it isn't used
+	binary.LittleEndian.PutUint16(b[16:], evType)
+	binary.LittleEndian.PutUint16(b[18:], code)
+	binary.LittleEndian.PutUint32(b[20:], uint32(value))
+	return b
+}
+
+func TestServeEvdev(t *testing.T) {
+	if binary.Size(inputEvent{}) != 24 {
+		t.Skip("input events aren't 24 bytes on this architecture")
+	}
+
+	const (
+		evSyn = 0x00
+		evKey = 0x01
+		evRel = 0x02
+		evAbs = 0x03
+	)
+
+	tests := []struct {
+		name   string
+		events [][]byte
+		want   []byte
+	}{
+		{
+			name:   "next song key press",
+			events: [][]byte{rawInputEvent(evKey, 163, 1), rawInputEvent(evSyn, 0, 0)},
+			want:   []byte{EventCmdRotaryEncoderClockwise},
+		},
+		{
+			name:   "key release and repeat are ignored",
+			events: [][]byte{rawInputEvent(evKey, 164, 0), rawInputEvent(evKey, 164, 2)},
+		},
+		{
+			name:   "volume keys",
+			events: [][]byte{rawInputEvent(evKey, 115, 1), rawInputEvent(evKey, 114, 1)},
+			want:   []byte{EventCmdVolumeUp, EventCmdVolumeDown},
+		},
+		{
+			name:   "dial needs two steps for a command",
+			events: [][]byte{rawInputEvent(evRel, 0x07, 1), rawInputEvent(evRel, 0x07, 1), rawInputEvent(evRel, 0x07, 1)},
+			want:   []byte{EventCmdRotaryEncoderClockwise},
+		},
+		{
+			name:   "fast dial sends several commands",
+			events: [][]byte{rawInputEvent(evRel, 0x07, -5)},
+			want:   []byte{EventCmdRotaryEncoderCounterClockwise, EventCmdRotaryEncoderCounterClockwise},
+		},
+		{
+			name:   "wheel down",
+			events: [][]byte{rawInputEvent(evRel, 0x08, -1)},
+			want:   []byte{EventCmdRotaryEncoderClockwise},
+		},
+		{
+			name:   "gamepad hat",
+			events: [][]byte{rawInputEvent(evAbs, 0x11, -1), rawInputEvent(evAbs, 0x11, 0), rawInputEvent(evAbs, 0x11, 1)},
+			want:   []byte{EventCmdRotaryEncoderCounterClockwise, EventCmdRotaryEncoderClockwise},
+		},
+		{
+			name:   "half an event is dropped",
+			events: [][]byte{rawInputEvent(evKey, 0x110, 1), rawInputEvent(evKey, 0x110, 1)[:12]},
+			want:   []byte{EventCmdPushButton},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			c := NewDummyController(ctx)
+
+			matchers, err := DefaultEvdevConfig().matchers()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			d := &evdevDevice{ioutil.NopCloser(bytes.NewReader(bytes.Join(tt.events, nil)))}
+			done := make(chan struct{})
+			go func() {
+				c.serveEvdev(d, tt.name, matchers)
+				close(done)
+			}()
+
+			got := []byte{}
+			for {
+				select {
+				case cmd := <-c.CommandEvents:
+					got = append(got, cmd)
+					continue
+				case <-done:
+				case <-time.After(time.Second):
+					t.Fatal("the device was never done")
+				}
+				break
+			}
+
+			if !bytes.Equal(got, tt.want) {
+				t.Errorf("got commands %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,13 @@
+//go:build !linux
+// +build !linux
+
+package controller
+
+import (
+	"errors"
+)
+
+// AttachEvdev is only supported on Linux
+func (c *Controller) AttachEvdev(paths []string, config *EvdevConfig) error {
+	return errors.New("Input device controllers are only supported on Linux")
+}
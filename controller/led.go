@@ -0,0 +1,168 @@
+package controller
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"gopkg.in/alecthomas/kingpin.v2"
+)
+
+var (
+	controllerLedFlag = kingpin.Flag("controller-led", "LED behaviour per state, e.g. almost-full=glow:15ms or full=off. States: "+strings.Join(ledStateNames, ", ")).StringMap()
+)
+
+type (
+	// LedState is the player state that the controller LED is signalling
+	LedState int
+
+	// LedMode is what the LED should do. Interval is the blink period or the
+	// glow step, zero keeps whatever the firmware currently uses.
+	LedMode struct {
+		Command  byte
+		Interval time.Duration
+	}
+
+	// LedMapping maps every LedState to a LedMode
+	LedMapping map[LedState]LedMode
+)
+
+const (
+	// LedStateQueueOpen means there's plenty of room in the queue
+	LedStateQueueOpen LedState = iota
+
+	// LedStateQueueAlmostFull means there are only two slots left in the queue
+	LedStateQueueAlmostFull
+
+	// LedStateQueueOneSlotLeft means there is exactly one slot left in the queue
+	LedStateQueueOneSlotLeft
+
+	// LedStateQueueFull means nothing more can be queued
+	LedStateQueueFull
+
+	// LedStateTrackNext means the track that was just queued is the next one to play
+	LedStateTrackNext
+
+	// LedStateIdle means nothing is playing and the queue is empty
+	LedStateIdle
+
+	// LedStateReconnecting means the controller was lost and just came back
+	LedStateReconnecting
+)
+
+var (
+	// the names used in --controller-led, indexed by LedState
+	ledStateNames = []string{"open", "almost-full", "one-left", "full", "next", "idle", "reconnecting"}
+
+	ledModeCommands = map[string]byte{
+		"off":   CommandLedOff,
+		"on":    CommandLedOn,
+		"blink": CommandLedBlink,
+		"glow":  CommandLedGlow,
+	}
+)
+
+func (s LedState) String() string {
+	if int(s) < 0 || int(s) >= len(ledStateNames) {
+		return fmt.Sprintf("LedState(%d)", s)
+	}
+	return ledStateNames[s]
+}
+
+// DefaultLedMapping is what the controller did before the LED was configurable,
+// with the extra states filled in
+func DefaultLedMapping() LedMapping {
+	return LedMapping{
+		LedStateQueueOpen:        LedMode{Command: CommandLedBlink, Interval: time.Second},
+		LedStateQueueAlmostFull:  LedMode{Command: CommandLedBlink, Interval: 500 * time.Millisecond},
+		LedStateQueueOneSlotLeft: LedMode{Command: CommandLedBlink, Interval: 200 * time.Millisecond},
+		LedStateQueueFull:        LedMode{Command: CommandLedOff},
+		LedStateTrackNext:        LedMode{Command: CommandLedOn},
+		LedStateIdle:             LedMode{Command: CommandLedGlow, Interval: 25 * time.Millisecond},
+		LedStateReconnecting:     LedMode{Command: CommandLedGlow, Interval: 5 * time.Millisecond},
+	}
+}
+
+// LedMappingFromFlags returns the default mapping overridden by --controller-led
+func LedMappingFromFlags() (LedMapping, error) {
+	m := DefaultLedMapping()
+
+	for name, value := range *controllerLedFlag {
+		state, err := parseLedState(name)
+		if err != nil {
+			return nil, err
+		}
+
+		mode, err := ParseLedMode(value)
+		if err != nil {
+			return nil, err
+		}
+
+		m[state] = mode
+	}
+
+	return m, nil
+}
+
+// ParseLedMode parses modes like "off", "on", "blink" or "glow:15ms"
+func ParseLedMode(s string) (LedMode, error) {
+	parts := strings.SplitN(s, ":", 2)
+
+	cmd, ok := ledModeCommands[strings.ToLower(parts[0])]
+	if !ok {
+		return LedMode{}, fmt.Errorf("Unknown LED mode %q", parts[0])
+	}
+
+	mode := LedMode{Command: cmd}
+	if len(parts) == 2 {
+		interval, err := time.ParseDuration(parts[1])
+		if err != nil {
+			return LedMode{}, fmt.Errorf("Bad LED interval %q: %v", parts[1], err)
+		}
+		mode.Interval = interval
+	}
+
+	return mode, nil
+}
+
+func parseLedState(s string) (LedState, error) {
+	for i, name := range ledStateNames {
+		if name == s {
+			return LedState(i), nil
+		}
+	}
+	return 0, fmt.Errorf("Unknown LED state %q", s)
+}
+
+// SetLedMode sends the interval (if any) followed by the mode command. The mode
+// is remembered and sent to controllers that are attached later on.
+func (c *Controller) SetLedMode(m LedMode) error {
+	cmd := make([]byte, 0, 3)
+
+	if m.Interval > 0 {
+		switch m.Command {
+		case CommandLedBlink:
+			// the blink interval is sent in tens of milliseconds
+			cmd = append(cmd, CommandLedBlinkInterval, clampByte(m.Interval/(10*time.Millisecond)))
+		case CommandLedGlow:
+			cmd = append(cmd, CommandLedGlowInterval, clampByte(m.Interval/time.Millisecond))
+		}
+	}
+	cmd = append(cmd, m.Command)
+
+	c.portLock.Lock()
+	c.ledCommand = cmd
+	c.portLock.Unlock()
+
+	return c.write(cmd)
+}
+
+func clampByte(d time.Duration) byte {
+	if d < 1 {
+		return 1
+	}
+	if d > 255 {
+		return 255
+	}
+	return byte(d)
+}
@@ -0,0 +1,116 @@
+package controller
+
+import (
+	"bytes"
+	"context"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestLedMappingFromFlags(t *testing.T) {
+	tests := []struct {
+		flags   map[string]string
+		changes LedMapping
+		wantErr bool
+	}{
+		{nil, nil, false},
+		{map[string]string{"full": "on"}, LedMapping{LedStateQueueFull: {Command: CommandLedOn}}, false},
+		{map[string]string{"almost-full": "glow:15ms"}, LedMapping{LedStateQueueAlmostFull: {Command: CommandLedGlow, Interval: 15 * time.Millisecond}}, false},
+		{map[string]string{"idle": "Blink:2s", "next": "off"}, LedMapping{
+			LedStateIdle:      {Command: CommandLedBlink, Interval: 2 * time.Second},
+			LedStateTrackNext: {Command: CommandLedOff},
+		}, false},
+		{map[string]string{"reconnecting": "on:"}, nil, true},
+		{map[string]string{"open": "flash"}, nil, true},
+		{map[string]string{"open": "blink:fast"}, nil, true},
+		{map[string]string{"half-full": "on"}, nil, true},
+	}
+
+	defer func(flags map[string]string) { *controllerLedFlag = flags }(*controllerLedFlag)
+
+	for _, tt := range tests {
+		*controllerLedFlag = tt.flags
+
+		got, err := LedMappingFromFlags()
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("%v gave no error", tt.flags)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%v: %v", tt.flags, err)
+			continue
+		}
+
+		want := DefaultLedMapping()
+		for state, mode := range tt.changes {
+			want[state] = mode
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("%v = %v, want %v", tt.flags, got, want)
+		}
+	}
+}
+
+func TestLedStateNames(t *testing.T) {
+	for s := LedStateQueueOpen; s <= LedStateReconnecting; s++ {
+		got, err := parseLedState(s.String())
+		if err != nil || got != s {
+			t.Errorf("%s parses as %v (%v)", s, got, err)
+		}
+	}
+	if s := LedState(len(ledStateNames)).String(); s != "LedState(7)" {
+		t.Errorf("unknown state is %q", s)
+	}
+}
+
+// testPort records what's written to it
+type testPort struct {
+	bytes.Buffer
+}
+
+func (p *testPort) Close() error {
+	return nil
+}
+
+func TestSetLedMode(t *testing.T) {
+	tests := []struct {
+		mode LedMode
+		want []byte
+	}{
+		{LedMode{Command: CommandLedOff}, []byte{CommandLedOff}},
+		{LedMode{Command: CommandLedOn, Interval: time.Second}, []byte{CommandLedOn}},
+		{LedMode{Command: CommandLedBlink}, []byte{CommandLedBlink}},
+		{LedMode{Command: CommandLedBlink, Interval: 500 * time.Millisecond}, []byte{CommandLedBlinkInterval, 50, CommandLedBlink}},
+		{LedMode{Command: CommandLedBlink, Interval: time.Minute}, []byte{CommandLedBlinkInterval, 255, CommandLedBlink}},
+		{LedMode{Command: CommandLedBlink, Interval: time.Millisecond}, []byte{CommandLedBlinkInterval, 1, CommandLedBlink}},
+		{LedMode{Command: CommandLedGlow, Interval: 15 * time.Millisecond}, []byte{CommandLedGlowInterval, 15, CommandLedGlow}},
+		{LedMode{Command: CommandLedGlow, Interval: time.Second}, []byte{CommandLedGlowInterval, 255, CommandLedGlow}},
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	c := NewDummyController(ctx)
+
+	port := &testPort{}
+	c.attach(port, "test")
+
+	for _, tt := range tests {
+		port.Reset()
+		if err := c.SetLedMode(tt.mode); err != nil {
+			t.Fatal(err)
+		}
+		if got := port.Bytes(); !bytes.Equal(got, tt.want) {
+			t.Errorf("%v wrote %q, want %q", tt.mode, got, tt.want)
+		}
+	}
+
+	// a controller attached later gets the latest mode
+	late := &testPort{}
+	c.attach(late, "late")
+	if got, want := late.Bytes(), tests[len(tests)-1].want; !bytes.Equal(got, want) {
+		t.Errorf("late controller got %q, want %q", got, want)
+	}
+}
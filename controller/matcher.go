@@ -0,0 +1,98 @@
+package controller
+
+import (
+	"fmt"
+	"strconv"
+)
+
+// eventMatcher turns input events from evdev and MIDI devices into controller
+// commands. Events are identified by a type and a code, and carry a value.
+type eventMatcher struct {
+	evType  uint16
+	code    uint16
+	value   string
+	exact   int32
+	command byte
+	divider int32
+	// relative movement not yet turned into commands
+	accumulated int32
+}
+
+var (
+	controllerCommandNames = map[string]byte{
+		"clockwise":         EventCmdRotaryEncoderClockwise,
+		"counter-clockwise": EventCmdRotaryEncoderCounterClockwise,
+		"wheel-button":      EventCmdRotaryEncoderButton,
+		"button":            EventCmdPushButton,
+		"skip":              EventCmdSkip,
+		"volume-up":         EventCmdVolumeUp,
+		"volume-down":       EventCmdVolumeDown,
+	}
+)
+
+// newEventMatcher parses a value ("press", "release", "repeat", "+", "-" or a
+// number) and a command name into a matcher
+func newEventMatcher(evType uint16, code uint16, value string, command string, divider int) (*eventMatcher, error) {
+	cmd, ok := controllerCommandNames[command]
+	if !ok {
+		return nil, fmt.Errorf("Unknown controller command %q", command)
+	}
+
+	m := &eventMatcher{
+		evType:  evType,
+		code:    code,
+		value:   value,
+		command: cmd,
+		divider: int32(divider),
+	}
+	if m.divider < 1 {
+		m.divider = 1
+	}
+
+	switch value {
+	case "press":
+		m.exact = 1
+	case "release":
+		m.exact = 0
+	case "repeat":
+		m.exact = 2
+	case "+", "-":
+	default:
+		v, err := strconv.ParseInt(value, 0, 32)
+		if err != nil {
+			return nil, fmt.Errorf("Bad event value %q", value)
+		}
+		m.exact = int32(v)
+	}
+
+	return m, nil
+}
+
+// commands returns how many times the matcher's command should be sent for the event
+func (m *eventMatcher) commands(evType uint16, code uint16, value int32) int {
+	if evType != m.evType || code != m.code {
+		return 0
+	}
+
+	switch m.value {
+	case "+", "-":
+		if (m.value == "+") != (value > 0) || value == 0 {
+			// turning the other way starts over
+			m.accumulated = 0
+			return 0
+		}
+		if value < 0 {
+			value = -value
+		}
+		m.accumulated += value
+		n := m.accumulated / m.divider
+		m.accumulated = m.accumulated % m.divider
+		return int(n)
+	default:
+		if value == m.exact {
+			return 1
+		}
+	}
+
+	return 0
+}
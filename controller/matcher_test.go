@@ -0,0 +1,154 @@
+package controller
+
+import (
+	"testing"
+)
+
+func TestNewEventMatcher(t *testing.T) {
+	tests := []struct {
+		value   string
+		command string
+		divider int
+		exact   int32
+		div     int32
+		err     bool
+	}{
+		{value: "press", command: "button", exact: 1, div: 1},
+		{value: "release", command: "button", exact: 0, div: 1},
+		{value: "repeat", command: "button", exact: 2, div: 1},
+		{value: "-1", command: "clockwise", exact: -1, div: 1},
+		{value: "0x7f", command: "skip", exact: 127, div: 1},
+		{value: "+", command: "volume-up", divider: 4, div: 4},
+		{value: "-", command: "volume-down", divider: -3, div: 1},
+		{value: "sometimes", command: "button", err: true},
+		{value: "press", command: "explode", err: true},
+	}
+
+	for _, tt := range tests {
+		m, err := newEventMatcher(1, 2, tt.value, tt.command, tt.divider)
+		if tt.err {
+			if err == nil {
+				t.Errorf("newEventMatcher(%q, %q) didn't fail", tt.value, tt.command)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("newEventMatcher(%q, %q) failed: %v", tt.value, tt.command, err)
+			continue
+		}
+		if m.exact != tt.exact || m.divider != tt.div {
+			t.Errorf("newEventMatcher(%q, %q) exact %d divider %d, want %d and %d", tt.value, tt.command, m.exact, m.divider, tt.exact, tt.div)
+		}
+	}
+}
+
+func TestEventMatcherCommands(t *testing.T) {
+	type event struct {
+		evType, code uint16
+		value        int32
+		want         int
+	}
+
+	tests := []struct {
+		name    string
+		value   string
+		divider int
+		events  []event
+	}{
+		{
+			name:  "exact value",
+			value: "press",
+			events: []event{
+				{1, 2, 1, 1},
+				{1, 2, 0, 0},
+				{1, 2, 2, 0},
+				{1, 3, 1, 0},
+				{2, 2, 1, 0},
+			},
+		},
+		{
+			name:  "any positive",
+			value: "+",
+			events: []event{
+				{1, 2, 1, 1},
+				{1, 2, 3, 3},
+				{1, 2, -1, 0},
+				{1, 2, 0, 0},
+			},
+		},
+		{
+			name:    "divider accumulates",
+			value:   "+",
+			divider: 3,
+			events: []event{
+				{1, 2, 1, 0},
+				{1, 2, 1, 0},
+				{1, 2, 1, 1},
+				{1, 2, 4, 1},
+				{1, 2, 2, 1},
+			},
+		},
+		{
+			name:    "other events don't reset",
+			value:   "-",
+			divider: 2,
+			events: []event{
+				{1, 2, -1, 0},
+				{1, 3, 1, 0},
+				{1, 2, -1, 1},
+			},
+		},
+		{
+			name:    "turning the other way starts over",
+			value:   "-",
+			divider: 2,
+			events: []event{
+				{1, 2, -1, 0},
+				{1, 2, 1, 0},
+				{1, 2, -1, 0},
+				{1, 2, -1, 1},
+				{1, 2, -5, 2},
+				{1, 2, 0, 0},
+				{1, 2, -1, 0},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m, err := newEventMatcher(1, 2, tt.value, "clockwise", tt.divider)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for i, e := range tt.events {
+				if got := m.commands(e.evType, e.code, e.value); got != e.want {
+					t.Errorf("event %d (%d, %d, %d): got %d commands, want %d", i, e.evType, e.code, e.value, got, e.want)
+				}
+			}
+		})
+	}
+}
+
+func TestEvdevConfigMatchers(t *testing.T) {
+	if _, err := DefaultEvdevConfig().matchers(); err != nil {
+		t.Errorf("the default config doesn't parse: %v", err)
+	}
+
+	tests := []struct {
+		mapping EvdevMapping
+		err     bool
+	}{
+		{EvdevMapping{Type: "EV_KEY", Code: "KEY_ENTER", Value: "press", Command: "button"}, false},
+		{EvdevMapping{Type: "1", Code: "0x1c", Value: "press", Command: "button"}, false},
+		{EvdevMapping{Type: "EV_NOPE", Code: "KEY_ENTER", Value: "press", Command: "button"}, true},
+		{EvdevMapping{Type: "EV_KEY", Code: "KEY_NOPE", Value: "press", Command: "button"}, true},
+		{EvdevMapping{Type: "EV_KEY", Code: "0x10000", Value: "press", Command: "button"}, true},
+	}
+
+	for _, tt := range tests {
+		config := &EvdevConfig{Mappings: []EvdevMapping{tt.mapping}}
+		if _, err := config.matchers(); (err != nil) != tt.err {
+			t.Errorf("matchers() for %+v: error %v, want error %v", tt.mapping, err, tt.err)
+		}
+	}
+}
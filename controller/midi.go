@@ -0,0 +1,402 @@
+package controller
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	log "github.com/sirupsen/logrus"
+	"gopkg.in/alecthomas/kingpin.v2"
+)
+
+var (
+	controllerMidiFlag       = kingpin.Flag("controller-midi", "Raw MIDI device to use as a controller, e.g. /dev/snd/midiC1D0. Globs are allowed. Can be repeated.").Strings()
+	controllerMidiConfigFlag = kingpin.Flag("controller-midi-config", "JSON file mapping MIDI messages to controller commands").ExistingFile()
+)
+
+type (
+	// MidiConfig describes how MIDI messages are turned into controller commands,
+	// and which pads to light up for the LED commands
+	MidiConfig struct {
+		// Channel is 1-16, or 0 to listen on all channels and send on channel 1
+		Channel  int           `json:"channel"`
+		Mappings []MidiMapping `json:"mappings"`
+		Leds     []MidiLed     `json:"leds"`
+	}
+
+	// MidiMapping turns a note or control change into a controller command.
+	//
+	// Message is "note" or "cc" and Number is the note or controller number.
+	// Notes have the values "press" and "release". Control changes are turned
+	// into deltas according to Encoding, and then matched with "+", "-" or an
+	// exact number just like EvdevMapping.
+	//
+	// Encoding is "absolute" (the default, for plain knobs), "twos-complement",
+	// "offset" (64 means no change) or "sign-magnitude", depending on how the
+	// controller sends relative encoder turns.
+	MidiMapping struct {
+		Message  string `json:"message"`
+		Number   int    `json:"number"`
+		Encoding string `json:"encoding"`
+		Value    string `json:"value"`
+		Command  string `json:"command"`
+		Divider  int    `json:"divider"`
+	}
+
+	// MidiLed is a pad that's lit with a note on for the LED commands. The
+	// velocities are keyed on "off", "on", "blink" and "glow"; many controllers
+	// use the velocity to pick a colour or a blinking mode.
+	MidiLed struct {
+		Note       int            `json:"note"`
+		Velocities map[string]int `json:"velocities"`
+	}
+
+	// midiDevice is a raw MIDI device attached to a controller. LED commands
+	// written to it are sent as note on messages.
+	midiDevice struct {
+		io.ReadWriteCloser
+		channel byte
+		leds    []MidiLed
+		// set when the next byte written is the argument of the previous command
+		skipArg bool
+	}
+
+	// midiParser turns a raw MIDI byte stream into channel messages
+	midiParser struct {
+		status  byte
+		data    []byte
+		inSysex bool
+	}
+)
+
+const (
+	midiMessageNote = uint16(0)
+	midiMessageCC   = uint16(1)
+
+	midiNoteOff       = byte(0x80)
+	midiNoteOn        = byte(0x90)
+	midiControlChange = byte(0xb0)
+)
+
+var (
+	midiMessageTypes = map[string]uint16{
+		"note": midiMessageNote,
+		"cc":   midiMessageCC,
+	}
+
+	defaultLedVelocities = map[string]int{
+		"off":   0,
+		"on":    127,
+		"blink": 64,
+		"glow":  32,
+	}
+
+	ledCommandNames = map[byte]string{
+		CommandLedOff:   "off",
+		CommandLedOn:    "on",
+		CommandLedBlink: "blink",
+		CommandLedGlow:  "glow",
+	}
+)
+
+// DefaultMidiConfig uses the first encoder (CC 16, two's complement) to scroll,
+// the first pad (note 36) to queue and lights it up, and the second pad to skip
+func DefaultMidiConfig() *MidiConfig {
+	return &MidiConfig{
+		Mappings: []MidiMapping{
+			{Message: "cc", Number: 16, Encoding: "twos-complement", Value: "+", Command: "clockwise"},
+			{Message: "cc", Number: 16, Encoding: "twos-complement", Value: "-", Command: "counter-clockwise"},
+			{Message: "note", Number: 36, Value: "press", Command: "button"},
+			{Message: "note", Number: 37, Value: "press", Command: "skip"},
+		},
+		Leds: []MidiLed{
+			{Note: 36},
+		},
+	}
+}
+
+// LoadMidiConfig reads a MidiConfig from a JSON file
+func LoadMidiConfig(path string) (*MidiConfig, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	config := &MidiConfig{}
+	err = json.Unmarshal(b, config)
+	if err != nil {
+		return nil, fmt.Errorf("Unable to parse %s: %v", path, err)
+	}
+
+	return config, nil
+}
+
+func (m *MidiConfig) matchers() ([]*eventMatcher, map[uint16]string, error) {
+	matchers := make([]*eventMatcher, 0, len(m.Mappings))
+	encodings := make(map[uint16]string)
+
+	for _, mapping := range m.Mappings {
+		msgType, ok := midiMessageTypes[mapping.Message]
+		if !ok {
+			return nil, nil, fmt.Errorf("Unknown MIDI message %q", mapping.Message)
+		}
+
+		if mapping.Number < 0 || mapping.Number > 127 {
+			return nil, nil, fmt.Errorf("Bad MIDI note or controller number %d", mapping.Number)
+		}
+
+		if msgType == midiMessageCC {
+			switch mapping.Encoding {
+			case "", "absolute", "twos-complement", "offset", "sign-magnitude":
+			default:
+				return nil, nil, fmt.Errorf("Unknown MIDI encoder encoding %q", mapping.Encoding)
+			}
+			encodings[uint16(mapping.Number)] = mapping.Encoding
+		}
+
+		matcher, err := newEventMatcher(msgType, uint16(mapping.Number), mapping.Value, mapping.Command, mapping.Divider)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		matchers = append(matchers, matcher)
+	}
+
+	return matchers, encodings, nil
+}
+
+// feed adds a byte to the parser and returns a complete channel message when there is one
+func (p *midiParser) feed(b byte) (status byte, data []byte, ok bool) {
+	switch {
+	case b >= 0xf8:
+		// real time messages can show up anywhere and are ignored
+		return 0, nil, false
+	case b == 0xf0:
+		// like the other system common messages, sysex cancels running status
+		p.inSysex = true
+		p.status = 0
+		return 0, nil, false
+	case b == 0xf7:
+		p.inSysex = false
+		return 0, nil, false
+	case b >= 0xf0:
+		// other system common messages cancel running status
+		p.status = 0
+		return 0, nil, false
+	case b >= 0x80:
+		p.inSysex = false
+		p.status = b
+		p.data = p.data[:0]
+		return 0, nil, false
+	}
+
+	if p.inSysex || p.status == 0 {
+		return 0, nil, false
+	}
+
+	p.data = append(p.data, b)
+
+	length := 2
+	if kind := p.status & 0xf0; kind == 0xc0 || kind == 0xd0 {
+		length = 1
+	}
+
+	if len(p.data) < length {
+		return 0, nil, false
+	}
+
+	data = p.data
+	// keep the status around, MIDI allows running status
+	p.data = make([]byte, 0, 2)
+	return p.status, data, true
+}
+
+// decodeEncoder turns a control change value into a relative movement
+func decodeEncoder(encoding string, value byte, last int32, hasLast bool) int32 {
+	v := int32(value)
+
+	switch encoding {
+	case "twos-complement":
+		if v >= 64 {
+			return v - 128
+		}
+		return v
+	case "offset":
+		return v - 64
+	case "sign-magnitude":
+		if v&0x40 != 0 {
+			return -(v & 0x3f)
+		}
+		return v & 0x3f
+	default:
+		if !hasLast {
+			return 0
+		}
+		return v - last
+	}
+}
+
+func (d *midiDevice) Write(b []byte) (int, error) {
+	for _, cmd := range b {
+		if d.skipArg {
+			d.skipArg = false
+			continue
+		}
+
+		switch cmd {
+		case CommandLedBlinkInterval, CommandLedGlowInterval:
+			// there's no way to tell a pad how fast to blink
+			d.skipArg = true
+			continue
+		}
+
+		mode, ok := ledCommandNames[cmd]
+		if !ok {
+			continue
+		}
+
+		for _, led := range d.leds {
+			velocity, ok := led.Velocities[mode]
+			if !ok {
+				velocity = defaultLedVelocities[mode]
+			}
+
+			msg := []byte{midiNoteOn | d.channel, byte(led.Note) & 0x7f, byte(velocity) & 0x7f}
+			if _, err := d.ReadWriteCloser.Write(msg); err != nil {
+				return 0, err
+			}
+		}
+	}
+
+	return len(b), nil
+}
+
+// midiConfigFromFlags returns the config given by --controller-midi-config or the default one
+func midiConfigFromFlags() (*MidiConfig, error) {
+	if *controllerMidiConfigFlag == "" {
+		return DefaultMidiConfig(), nil
+	}
+	return LoadMidiConfig(*controllerMidiConfigFlag)
+}
+
+// AttachMidiFromFlags attaches the MIDI devices given by --controller-midi
+func (c *Controller) AttachMidiFromFlags() error {
+	if len(*controllerMidiFlag) == 0 {
+		return nil
+	}
+
+	config, err := midiConfigFromFlags()
+	if err != nil {
+		return err
+	}
+
+	return c.AttachMidi(*controllerMidiFlag, config)
+}
+
+// AttachMidi starts reading controller events from raw MIDI devices, i.e.
+// /dev/snd/midiC1D0. Paths can be globs.
+func (c *Controller) AttachMidi(paths []string, config *MidiConfig) error {
+	if config.Channel < 0 || config.Channel > 16 {
+		return fmt.Errorf("Bad MIDI channel %d", config.Channel)
+	}
+
+	devices := make([]string, 0, len(paths))
+	for _, p := range paths {
+		matches, err := filepath.Glob(p)
+		if err != nil {
+			return err
+		}
+		devices = append(devices, matches...)
+	}
+
+	if len(devices) == 0 {
+		return errors.New("No MIDI devices found for controller")
+	}
+
+	for _, path := range devices {
+		matchers, encodings, err := config.matchers()
+		if err != nil {
+			return err
+		}
+
+		f, err := os.OpenFile(path, os.O_RDWR, 0)
+		if err != nil {
+			return err
+		}
+
+		d := &midiDevice{
+			ReadWriteCloser: f,
+			leds:            config.Leds,
+		}
+		if config.Channel > 0 {
+			d.channel = byte(config.Channel - 1)
+		}
+
+		go c.serveMidi(d, path, config.Channel, matchers, encodings)
+	}
+
+	return nil
+}
+
+func (c *Controller) serveMidi(d *midiDevice, name string, channel int, matchers []*eventMatcher, encodings map[uint16]string) {
+	c.attach(d, name)
+	defer c.detach(d)
+
+	parser := &midiParser{}
+	lastCC := make(map[uint16]int32)
+	buf := make([]byte, 64)
+
+	for {
+		n, err := d.Read(buf)
+		if err != nil {
+			if err != io.EOF && !c.closing() {
+				log.WithError(err).Warnf("Error reading from MIDI device %s", name)
+			}
+			return
+		}
+
+		for _, b := range buf[:n] {
+			status, data, ok := parser.feed(b)
+			if !ok {
+				continue
+			}
+
+			if channel > 0 && int(status&0x0f) != channel-1 {
+				continue
+			}
+
+			var msgType, code uint16
+			var value int32
+
+			switch status & 0xf0 {
+			case midiNoteOn, midiNoteOff:
+				msgType = midiMessageNote
+				code = uint16(data[0])
+				if status&0xf0 == midiNoteOn && data[1] > 0 {
+					value = 1
+				}
+			case midiControlChange:
+				msgType = midiMessageCC
+				code = uint16(data[0])
+				last, hasLast := lastCC[code]
+				value = decodeEncoder(encodings[code], data[1], last, hasLast)
+				lastCC[code] = int32(data[1])
+			default:
+				continue
+			}
+
+			for _, m := range matchers {
+				for i := m.commands(msgType, code, value); i > 0; i-- {
+					log.Debugf("Got command %b from MIDI device %s", m.command, name)
+					if !c.emit(m.command) {
+						return
+					}
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,299 @@
+package controller
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"testing"
+	"time"
+)
+
+type (
+	// midiLoopback is a MIDI device where the test writes what the device sends
+	midiLoopback struct {
+		*io.PipeReader
+		sent bytes.Buffer
+	}
+)
+
+func (l *midiLoopback) Write(b []byte) (int, error) {
+	return l.sent.Write(b)
+}
+
+func TestMidiParser(t *testing.T) {
+	type message struct {
+		status byte
+		data   []byte
+	}
+
+	tests := []struct {
+		name  string
+		bytes []byte
+		want  []message
+	}{
+		{
+			name:  "note on",
+			bytes: []byte{0x90, 36, 100},
+			want:  []message{{0x90, []byte{36, 100}}},
+		},
+		{
+			name:  "running status",
+			bytes: []byte{0xb0, 16, 1, 16, 127, 17, 64},
+			want:  []message{{0xb0, []byte{16, 1}}, {0xb0, []byte{16, 127}}, {0xb0, []byte{17, 64}}},
+		},
+		{
+			name:  "one data byte for program change",
+			bytes: []byte{0xc3, 5, 6},
+			want:  []message{{0xc3, []byte{5}}, {0xc3, []byte{6}}},
+		},
+		{
+			name:  "real time messages in the middle of a message",
+			bytes: []byte{0x90, 0xf8, 36, 0xfe, 100},
+			want:  []message{{0x90, []byte{36, 100}}},
+		},
+		{
+			name:  "sysex is skipped",
+			bytes: []byte{0xf0, 0x7e, 0x7f, 0x06, 0x01, 0xf7, 0x80, 36, 0},
+			want:  []message{{0x80, []byte{36, 0}}},
+		},
+		{
+			name:  "sysex keeps the running status away",
+			bytes: []byte{0x90, 36, 100, 0xf0, 1, 2, 0xf7, 36, 0},
+			want:  []message{{0x90, []byte{36, 100}}},
+		},
+		{
+			name:  "system common cancels running status",
+			bytes: []byte{0x90, 36, 100, 0xf3, 1, 36, 0},
+			want:  []message{{0x90, []byte{36, 100}}},
+		},
+		{
+			name:  "data without a status is ignored",
+			bytes: []byte{36, 100, 0x91, 37, 127},
+			want:  []message{{0x91, []byte{37, 127}}},
+		},
+		{
+			name:  "a new status drops half a message",
+			bytes: []byte{0x90, 36, 0xb0, 16, 1},
+			want:  []message{{0xb0, []byte{16, 1}}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := &midiParser{}
+			got := []message{}
+			for _, b := range tt.bytes {
+				if status, data, ok := p.feed(b); ok {
+					got = append(got, message{status, data})
+				}
+			}
+
+			if len(got) != len(tt.want) {
+				t.Fatalf("got %d messages %v, want %d %v", len(got), got, len(tt.want), tt.want)
+			}
+			for i := range got {
+				if got[i].status != tt.want[i].status || !bytes.Equal(got[i].data, tt.want[i].data) {
+					t.Errorf("message %d is %x %v, want %x %v", i, got[i].status, got[i].data, tt.want[i].status, tt.want[i].data)
+				}
+			}
+		})
+	}
+}
+
+func TestDecodeEncoder(t *testing.T) {
+	tests := []struct {
+		encoding string
+		value    byte
+		last     int32
+		hasLast  bool
+		want     int32
+	}{
+		{"twos-complement", 1, 0, false, 1},
+		{"twos-complement", 3, 0, false, 3},
+		{"twos-complement", 127, 0, false, -1},
+		{"twos-complement", 125, 0, false, -3},
+		{"twos-complement", 64, 0, false, -64},
+		{"offset", 65, 0, false, 1},
+		{"offset", 63, 0, false, -1},
+		{"offset", 64, 0, false, 0},
+		{"sign-magnitude", 1, 0, false, 1},
+		{"sign-magnitude", 65, 0, false, -1},
+		{"sign-magnitude", 67, 0, false, -3},
+		{"absolute", 10, 0, false, 0},
+		{"absolute", 12, 10, true, 2},
+		{"absolute", 0, 5, true, -5},
+		{"", 100, 90, true, 10},
+	}
+
+	for _, tt := range tests {
+		if got := decodeEncoder(tt.encoding, tt.value, tt.last, tt.hasLast); got != tt.want {
+			t.Errorf("decodeEncoder(%q, %d, %d, %v) = %d, want %d", tt.encoding, tt.value, tt.last, tt.hasLast, got, tt.want)
+		}
+	}
+}
+
+func TestMidiDeviceWrite(t *testing.T) {
+	leds := []MidiLed{
+		{Note: 36},
+		{Note: 40, Velocities: map[string]int{"on": 5, "blink": 3}},
+	}
+
+	tests := []struct {
+		name    string
+		channel byte
+		writes  [][]byte
+		want    []byte
+	}{
+		{
+			name:   "on",
+			writes: [][]byte{{CommandLedOn}},
+			want:   []byte{0x90, 36, 127, 0x90, 40, 5},
+		},
+		{
+			name:    "off on channel 10",
+			channel: 9,
+			writes:  [][]byte{{CommandLedOff}},
+			want:    []byte{0x99, 36, 0, 0x99, 40, 0},
+		},
+		{
+			name:   "blink and glow",
+			writes: [][]byte{{CommandLedBlink}, {CommandLedGlow}},
+			want:   []byte{0x90, 36, 64, 0x90, 40, 3, 0x90, 36, 32, 0x90, 40, 32},
+		},
+		{
+			name:   "intervals and their arguments are dropped",
+			writes: [][]byte{{CommandLedBlinkInterval, CommandLedOn}, {CommandLedGlowInterval}, {CommandLedOff}, {CommandLedOn}},
+			want:   []byte{0x90, 36, 127, 0x90, 40, 5},
+		},
+		{
+			name:   "unknown commands are dropped",
+			writes: [][]byte{{'X'}},
+			want:   []byte{},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			l := &midiLoopback{}
+			d := &midiDevice{ReadWriteCloser: l, channel: tt.channel, leds: leds}
+
+			for _, w := range tt.writes {
+				n, err := d.Write(w)
+				if err != nil || n != len(w) {
+					t.Fatalf("Write(%v) = %d, %v", w, n, err)
+				}
+			}
+
+			if !bytes.Equal(l.sent.Bytes(), tt.want) {
+				t.Errorf("sent %v, want %v", l.sent.Bytes(), tt.want)
+			}
+		})
+	}
+}
+
+func TestServeMidi(t *testing.T) {
+	tests := []struct {
+		name    string
+		channel int
+		config  *MidiConfig
+		bytes   []byte
+		want    []byte
+	}{
+		{
+			name:   "pads",
+			config: DefaultMidiConfig(),
+			bytes:  []byte{0x90, 36, 100, 0x80, 36, 0, 0x90, 37, 1, 37, 0},
+			want:   []byte{EventCmdPushButton, EventCmdSkip},
+		},
+		{
+			name:   "encoder with running status",
+			config: DefaultMidiConfig(),
+			bytes:  []byte{0xb0, 16, 1, 16, 2, 16, 127},
+			want:   []byte{EventCmdRotaryEncoderClockwise, EventCmdRotaryEncoderClockwise, EventCmdRotaryEncoderClockwise, EventCmdRotaryEncoderCounterClockwise},
+		},
+		{
+			name:    "other channels are ignored",
+			channel: 2,
+			config:  DefaultMidiConfig(),
+			bytes:   []byte{0x90, 36, 100, 0x91, 37, 100},
+			want:    []byte{EventCmdSkip},
+		},
+		{
+			name: "absolute knob",
+			config: &MidiConfig{Mappings: []MidiMapping{
+				{Message: "cc", Number: 7, Value: "+", Command: "volume-up", Divider: 4},
+				{Message: "cc", Number: 7, Value: "-", Command: "volume-down", Divider: 4},
+			}},
+			bytes: []byte{0xb0, 7, 100, 7, 104, 7, 106, 7, 108, 7, 100},
+			want:  []byte{EventCmdVolumeUp, EventCmdVolumeUp, EventCmdVolumeDown, EventCmdVolumeDown},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			c := NewDummyController(ctx)
+
+			matchers, encodings, err := tt.config.matchers()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			r, w := io.Pipe()
+			d := &midiDevice{ReadWriteCloser: &midiLoopback{PipeReader: r}}
+			done := make(chan struct{})
+			go func() {
+				c.serveMidi(d, tt.name, tt.channel, matchers, encodings)
+				close(done)
+			}()
+
+			// a byte at a time, like a slow device would
+			go func() {
+				for _, b := range tt.bytes {
+					if _, err := w.Write([]byte{b}); err != nil {
+						return
+					}
+				}
+				w.Close()
+			}()
+
+			got := []byte{}
+			for {
+				select {
+				case cmd := <-c.CommandEvents:
+					got = append(got, cmd)
+					continue
+				case <-done:
+				case <-time.After(time.Second):
+					t.Fatal("the device was never done")
+				}
+				break
+			}
+
+			if !bytes.Equal(got, tt.want) {
+				t.Errorf("got commands %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMidiConfigMatchers(t *testing.T) {
+	tests := []struct {
+		mapping MidiMapping
+		err     bool
+	}{
+		{MidiMapping{Message: "note", Number: 36, Value: "press", Command: "button"}, false},
+		{MidiMapping{Message: "cc", Number: 16, Encoding: "offset", Value: "+", Command: "clockwise"}, false},
+		{MidiMapping{Message: "sysex", Number: 36, Value: "press", Command: "button"}, true},
+		{MidiMapping{Message: "note", Number: 128, Value: "press", Command: "button"}, true},
+		{MidiMapping{Message: "cc", Number: 16, Encoding: "gray-code", Value: "+", Command: "clockwise"}, true},
+	}
+
+	for _, tt := range tests {
+		config := &MidiConfig{Mappings: []MidiMapping{tt.mapping}}
+		if _, _, err := config.matchers(); (err != nil) != tt.err {
+			t.Errorf("matchers() for %+v: error %v, want error %v", tt.mapping, err, tt.err)
+		}
+	}
+}
@@ -0,0 +1,118 @@
+package controller
+
+import (
+	"net"
+	"net/http"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"golang.org/x/net/websocket"
+	"gopkg.in/alecthomas/kingpin.v2"
+)
+
+var (
+	controllerListenFlag          = kingpin.Flag("controller-listen", "Accept network controllers over TCP on this address, e.g. :4041 for anyone on the network or localhost:4041 for only this machine").String()
+	controllerWebSocketListenFlag = kingpin.Flag("controller-websocket-listen", "Accept network controllers over WebSocket on this address, e.g. :4042 for anyone on the network or localhost:4042 for only this machine").String()
+)
+
+const (
+	// a controller that doesn't take an LED command this fast is dropped, so
+	// it can't hold up the others
+	networkWriteTimeout = time.Second
+)
+
+type (
+	// networkPort is a network controller. They speak the same byte protocol
+	// as the serial controller: they send W, C, D and P, S to skip and + and -
+	// for the volume, and get the LED commands back. Any number of them can be
+	// connected at the same time. There's no authentication, so listen on
+	// localhost unless anyone on the network should get in.
+	//
+	// Writes give up after a while and close the connection, which detaches it.
+	networkPort struct {
+		net.Conn
+	}
+)
+
+func (p networkPort) Write(b []byte) (int, error) {
+	if err := p.SetWriteDeadline(time.Now().Add(networkWriteTimeout)); err != nil {
+		return 0, err
+	}
+
+	n, err := p.Conn.Write(b)
+	if err != nil {
+		p.Conn.Close()
+	}
+	return n, err
+}
+
+// ListenNetwork starts the network controller listeners given on the command line
+func (c *Controller) ListenNetwork() error {
+	if *controllerListenFlag != "" {
+		if err := c.ListenTCP(*controllerListenFlag); err != nil {
+			return err
+		}
+	}
+
+	if *controllerWebSocketListenFlag != "" {
+		if err := c.ListenWebSocket(*controllerWebSocketListenFlag); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// ListenTCP accepts network controllers on a plain TCP socket
+func (c *Controller) ListenTCP(addr string) error {
+	l, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+
+	log.Infof("Listening for network controllers on tcp %s", l.Addr())
+	c.listen(l)
+
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				if !c.closing() {
+					log.WithError(err).Error("Unable to accept network controller")
+				}
+				return
+			}
+
+			go c.serve(networkPort{conn}, "tcp:"+conn.RemoteAddr().String())
+		}
+	}()
+
+	return nil
+}
+
+// ListenWebSocket accepts network controllers on ws://<addr>/controller
+func (c *Controller) ListenWebSocket(addr string) error {
+	l, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+
+	log.Infof("Listening for network controllers on ws://%s/controller", l.Addr())
+	c.listen(l)
+
+	mux := http.NewServeMux()
+	mux.Handle("/controller", websocket.Handler(func(ws *websocket.Conn) {
+		// the LED commands take raw byte arguments, so don't pretend it's text
+		ws.PayloadType = websocket.BinaryFrame
+		c.serve(networkPort{ws}, "ws:"+ws.Request().RemoteAddr)
+	}))
+
+	go func() {
+		err := http.Serve(l, mux)
+		if !c.closing() {
+			log.WithError(err).Error("Network controller server stopped")
+		}
+	}()
+
+	return nil
+}
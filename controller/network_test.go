@@ -0,0 +1,74 @@
+package controller
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestStalledNetworkControllerIsDropped(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	c := NewDummyController(ctx)
+
+	// nobody ever reads from the other end
+	stalled, other := net.Pipe()
+	defer other.Close()
+	go c.serve(networkPort{stalled}, "stalled")
+
+	// a working controller gets the command anyway
+	working, client := net.Pipe()
+	defer client.Close()
+	go c.serve(networkPort{working}, "working")
+	got := make(chan []byte, 1)
+	go func() {
+		buf := make([]byte, 1)
+		if _, err := client.Read(buf); err == nil {
+			got <- buf
+		}
+	}()
+
+	// wait for both to be attached
+	for i := 0; ; i++ {
+		c.portLock.Lock()
+		n := len(c.ports)
+		c.portLock.Unlock()
+		if n == 2 {
+			break
+		}
+		if i > 100 {
+			t.Fatal("controllers weren't attached")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	start := time.Now()
+	c.WriteCommand(CommandLedOn)
+	if took := time.Since(start); took > 2*networkWriteTimeout {
+		t.Errorf("writing took %s with a stalled controller", took)
+	}
+
+	select {
+	case b := <-got:
+		if b[0] != CommandLedOn {
+			t.Errorf("working controller got %q, want %q", b[0], CommandLedOn)
+		}
+	case <-time.After(time.Second):
+		t.Error("working controller didn't get the command")
+	}
+
+	// the stalled one is detached once its connection is closed
+	for i := 0; ; i++ {
+		c.portLock.Lock()
+		n := len(c.ports)
+		c.portLock.Unlock()
+		if n == 1 {
+			break
+		}
+		if i > 100 {
+			t.Fatal("stalled controller wasn't detached")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
@@ -0,0 +1,275 @@
+package dedication
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+
+	sp "github.com/nollbit/spotify"
+	log "github.com/sirupsen/logrus"
+	"gopkg.in/alecthomas/kingpin.v2"
+)
+
+var (
+	dedicationWordsFlag       = kingpin.Flag("dedication-words", "File with words that aren't allowed in dedications, one per line, added to the built in ones").ExistingFile()
+	dedicationAutoApproveFlag = kingpin.Flag("dedication-auto-approve", "Show dedications without waiting for a moderator, unless they use a word on the list").Bool()
+)
+
+const (
+	// MaxMessageLength is how long a dedication can be, it has to fit on the screen
+	MaxMessageLength = 80
+	maxFromLength    = 30
+)
+
+const (
+	StatusPending  Status = "pending"
+	StatusApproved Status = "approved"
+	StatusRejected Status = "rejected"
+)
+
+var (
+	ErrorEmptyMessage      = errors.New("The message is empty")
+	ErrorMessageTooLong    = fmt.Errorf("The message can't be longer than %d characters", MaxMessageLength)
+	ErrorTrackNotQueued    = errors.New("The track isn't playing or in the queue")
+	ErrorNotAllowed        = errors.New("The message uses words that aren't allowed")
+	ErrorUnknownDedication = errors.New("No such dedication")
+	ErrorAlreadyDedicated  = errors.New("The track already has a dedication")
+	ErrorAlreadyModerated  = errors.New("The dedication has already been moderated")
+)
+
+type (
+	// Status is where a dedication is in moderation
+	Status string
+
+	// Dedication is a short message from a guest, shown while a track plays
+	Dedication struct {
+		ID      int   `json:"id"`
+		TrackID sp.ID `json:"track_id"`
+		// "Artist - Title", so moderators know what it's for
+		Track   string    `json:"track"`
+		From    string    `json:"from"`
+		Message string    `json:"message"`
+		Status  Status    `json:"status"`
+		Created time.Time `json:"created"`
+	}
+
+	// Board keeps the dedications for the playing and queued tracks. Guests
+	// submit them and a moderator approves them before they're shown. It's
+	// safe to use from several goroutines.
+	Board struct {
+		words       *WordList
+		autoApprove bool
+
+		mu          sync.Mutex
+		nextID      int
+		dedications []*Dedication
+		// the playing track and the queue, the only tracks that can get a dedication
+		tracks []sp.FullTrack
+	}
+)
+
+// NewBoard creates an empty board. Messages using words on the list are
+// rejected right away. With autoApprove, the rest are shown without waiting
+// for a moderator.
+func NewBoard(words *WordList, autoApprove bool) *Board {
+	return &Board{
+		words:       words,
+		autoApprove: autoApprove,
+		nextID:      1,
+		dedications: make([]*Dedication, 0),
+		tracks:      make([]sp.FullTrack, 0),
+	}
+}
+
+// NewBoardFromFlags creates a board with the words from --dedication-words
+// added to the default list
+func NewBoardFromFlags() (*Board, error) {
+	words := DefaultWordList()
+	if *dedicationWordsFlag != "" {
+		extra, err := LoadWordList(*dedicationWordsFlag)
+		if err != nil {
+			return nil, err
+		}
+		for word := range extra.words {
+			words.words[word] = true
+		}
+		words.prefixes = append(words.prefixes, extra.prefixes...)
+	}
+	return NewBoard(words, *dedicationAutoApproveFlag), nil
+}
+
+// SetTracks tells the board what's playing and queued. Dedications for tracks
+// that aren't any more, i.e. that have been played, are dropped.
+func (b *Board) SetTracks(tracks []sp.FullTrack) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.tracks = append(b.tracks[:0], tracks...)
+
+	kept := b.dedications[:0]
+	for _, d := range b.dedications {
+		if b.hasTrack(d.TrackID) {
+			kept = append(kept, d)
+		}
+	}
+	b.dedications = kept
+}
+
+// Tracks returns the tracks that can get a dedication
+func (b *Board) Tracks() []sp.FullTrack {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return append([]sp.FullTrack(nil), b.tracks...)
+}
+
+func (b *Board) hasTrack(trackID sp.ID) bool {
+	for _, t := range b.tracks {
+		if t.ID == trackID {
+			return true
+		}
+	}
+	return false
+}
+
+// Submit adds a dedication to a playing or queued track. Each track gets one
+// dedication, the first one that isn't rejected.
+func (b *Board) Submit(trackID sp.ID, from string, message string) (Dedication, error) {
+	from = cleanText(from, maxFromLength)
+	message = cleanText(message, -1)
+	if message == "" {
+		return Dedication{}, ErrorEmptyMessage
+	}
+	if len([]rune(message)) > MaxMessageLength {
+		return Dedication{}, ErrorMessageTooLong
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	var track *sp.FullTrack
+	for i := range b.tracks {
+		if b.tracks[i].ID == trackID {
+			track = &b.tracks[i]
+		}
+	}
+	if track == nil {
+		return Dedication{}, ErrorTrackNotQueued
+	}
+
+	for _, d := range b.dedications {
+		if d.TrackID == trackID && d.Status != StatusRejected {
+			return Dedication{}, ErrorAlreadyDedicated
+		}
+	}
+
+	d := &Dedication{
+		ID:      b.nextID,
+		TrackID: trackID,
+		Track:   describeTrack(*track),
+		From:    from,
+		Message: message,
+		Status:  StatusPending,
+		Created: time.Now(),
+	}
+	b.nextID++
+
+	if word, ok := b.words.Matches(from + " " + message); ok {
+		log.Infof("Rejected dedication %d for %s, it says %q", d.ID, d.Track, word)
+		d.Status = StatusRejected
+		b.dedications = append(b.dedications, d)
+		return *d, ErrorNotAllowed
+	}
+
+	if b.autoApprove {
+		d.Status = StatusApproved
+	}
+
+	log.Infof("Dedication %d for %s is %s: %q", d.ID, d.Track, d.Status, d.Message)
+	b.dedications = append(b.dedications, d)
+	return *d, nil
+}
+
+// Pending returns the dedications waiting for a moderator, oldest first
+func (b *Board) Pending() []Dedication {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	pending := make([]Dedication, 0)
+	for _, d := range b.dedications {
+		if d.Status == StatusPending {
+			pending = append(pending, *d)
+		}
+	}
+	return pending
+}
+
+// Moderate approves or rejects a pending dedication
+func (b *Board) Moderate(id int, approve bool) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	for _, d := range b.dedications {
+		if d.ID != id {
+			continue
+		}
+		if d.Status != StatusPending {
+			return ErrorAlreadyModerated
+		}
+
+		d.Status = StatusRejected
+		if approve {
+			d.Status = StatusApproved
+		}
+		log.Infof("Dedication %d for %s was %s", d.ID, d.Track, d.Status)
+		return nil
+	}
+
+	return ErrorUnknownDedication
+}
+
+// ForTrack returns the approved dedication of a track
+func (b *Board) ForTrack(trackID sp.ID) (Dedication, bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	for _, d := range b.dedications {
+		if d.TrackID == trackID && d.Status == StatusApproved {
+			return *d, true
+		}
+	}
+	return Dedication{}, false
+}
+
+// describeTrack is "Artist - Title", or just the title of a track without artists
+func describeTrack(track sp.FullTrack) string {
+	if len(track.Artists) == 0 {
+		return track.Name
+	}
+	return fmt.Sprintf("%s - %s", track.Artists[0].Name, track.Name)
+}
+
+// cleanText collapses white space and drops control characters and brackets,
+// which would be taken as formatting by the UI. A max < 0 doesn't cut the text.
+func cleanText(text string, max int) string {
+	text = strings.Map(func(r rune) rune {
+		switch {
+		case r == '[' || r == ']':
+			return -1
+		case unicode.IsSpace(r):
+			return ' '
+		case unicode.IsControl(r):
+			return -1
+		}
+		return r
+	}, text)
+	text = strings.Join(strings.Fields(text), " ")
+
+	if max >= 0 && len([]rune(text)) > max {
+		text = string([]rune(text)[:max])
+	}
+	return text
+}
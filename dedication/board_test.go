@@ -0,0 +1,145 @@
+package dedication
+
+import (
+	"strings"
+	"testing"
+
+	sp "github.com/nollbit/spotify"
+)
+
+func testTrack(id, artist, name string) sp.FullTrack {
+	track := sp.FullTrack{SimpleTrack: sp.SimpleTrack{ID: sp.ID(id), Name: name}}
+	if artist != "" {
+		track.Artists = []sp.SimpleArtist{{Name: artist}}
+	}
+	return track
+}
+
+func testBoard(autoApprove bool) *Board {
+	b := NewBoard(NewWordList([]string{"kuk"}), autoApprove)
+	b.SetTracks([]sp.FullTrack{
+		testTrack("1", "Abba", "Dancing Queen"),
+		testTrack("2", "", "Untitled"),
+	})
+	return b
+}
+
+func TestBoardSubmit(t *testing.T) {
+	tests := []struct {
+		name    string
+		trackID sp.ID
+		from    string
+		message string
+		err     error
+		track   string
+		text    string
+	}{
+		{name: "plain", trackID: "1", from: "Kim", message: "Grattis!", track: "Abba - Dancing Queen", text: "Grattis!"},
+		{name: "no artists", trackID: "2", message: "Grattis!", track: "Untitled", text: "Grattis!"},
+		{name: "cleaned", trackID: "1", from: "  Kim\n", message: " [Grattis](fg:red)\t på\x07 dig ", track: "Abba - Dancing Queen", text: "Grattis(fg:red) på dig"},
+		{name: "empty", trackID: "1", message: " [] ", err: ErrorEmptyMessage},
+		{name: "too long", trackID: "1", message: strings.Repeat("å", MaxMessageLength+1), err: ErrorMessageTooLong},
+		{name: "not queued", trackID: "3", message: "Grattis!", err: ErrorTrackNotQueued},
+		{name: "swearing", trackID: "1", message: "Din KUK", err: ErrorNotAllowed},
+		{name: "swearing in from", trackID: "1", from: "kuk", message: "Grattis!", err: ErrorNotAllowed},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := testBoard(false)
+			d, err := b.Submit(tt.trackID, tt.from, tt.message)
+			if err != tt.err {
+				t.Fatalf("Submit() error %v, want %v", err, tt.err)
+			}
+			if err != nil {
+				return
+			}
+			if d.Track != tt.track || d.Message != tt.text || d.Status != StatusPending {
+				t.Errorf("Submit() = %+v, want track %q, message %q and pending", d, tt.track, tt.text)
+			}
+		})
+	}
+}
+
+func TestBoardOneDedicationPerTrack(t *testing.T) {
+	b := testBoard(false)
+
+	// a rejected one doesn't count
+	if _, err := b.Submit("1", "", "kuk"); err != ErrorNotAllowed {
+		t.Fatalf("got %v, want %v", err, ErrorNotAllowed)
+	}
+	first, err := b.Submit("1", "Kim", "Grattis!")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := b.Submit("1", "Alex", "Skål!"); err != ErrorAlreadyDedicated {
+		t.Errorf("second dedication: got %v, want %v", err, ErrorAlreadyDedicated)
+	}
+
+	// once the moderator rejects it, someone else can have a go
+	if err := b.Moderate(first.ID, false); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := b.Submit("1", "Alex", "Skål!"); err != nil {
+		t.Errorf("dedication after a rejected one: %v", err)
+	}
+}
+
+func TestBoardModerate(t *testing.T) {
+	b := testBoard(false)
+	d, err := b.Submit("1", "Kim", "Grattis!")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if pending := b.Pending(); len(pending) != 1 || pending[0].ID != d.ID {
+		t.Fatalf("Pending() = %+v, want the new dedication", pending)
+	}
+	if _, ok := b.ForTrack("1"); ok {
+		t.Error("a pending dedication is shown")
+	}
+
+	if err := b.Moderate(d.ID, true); err != nil {
+		t.Fatal(err)
+	}
+	if got, ok := b.ForTrack("1"); !ok || got.Message != "Grattis!" {
+		t.Errorf("ForTrack() = %+v, %v after approving", got, ok)
+	}
+	if len(b.Pending()) != 0 {
+		t.Error("an approved dedication is still pending")
+	}
+
+	if err := b.Moderate(d.ID, false); err != ErrorAlreadyModerated {
+		t.Errorf("moderating twice: got %v, want %v", err, ErrorAlreadyModerated)
+	}
+	if err := b.Moderate(42, true); err != ErrorUnknownDedication {
+		t.Errorf("moderating nothing: got %v, want %v", err, ErrorUnknownDedication)
+	}
+}
+
+func TestBoardAutoApprove(t *testing.T) {
+	b := testBoard(true)
+
+	d, err := b.Submit("2", "", "Grattis!")
+	if err != nil || d.Status != StatusApproved {
+		t.Fatalf("Submit() = %+v, %v, want it approved", d, err)
+	}
+	if _, err := b.Submit("1", "", "kuk"); err != ErrorNotAllowed {
+		t.Errorf("auto approve let swearing through: %v", err)
+	}
+}
+
+func TestBoardSetTracksDropsPlayed(t *testing.T) {
+	b := testBoard(true)
+	if _, err := b.Submit("1", "", "Grattis!"); err != nil {
+		t.Fatal(err)
+	}
+
+	b.SetTracks([]sp.FullTrack{testTrack("2", "", "Untitled")})
+	if _, ok := b.ForTrack("1"); ok {
+		t.Error("the dedication of a played track is still there")
+	}
+	if _, err := b.Submit("1", "", "Igen!"); err != ErrorTrackNotQueued {
+		t.Errorf("dedicating a played track: got %v, want %v", err, ErrorTrackNotQueued)
+	}
+}
@@ -0,0 +1,283 @@
+package dedication
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"html/template"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+
+	sp "github.com/nollbit/spotify"
+	log "github.com/sirupsen/logrus"
+	"gopkg.in/alecthomas/kingpin.v2"
+)
+
+const (
+	// guests are on phone networks, but nothing here takes long
+	serverReadTimeout  = 10 * time.Second
+	serverWriteTimeout = 10 * time.Second
+
+	// the moderator's browser keeps the token in a cookie, so it's only in
+	// the address of the first visit
+	moderatorCookie = "moderator_token"
+)
+
+var (
+	dedicationListenFlag = kingpin.Flag("dedication-listen", "Let guests send dedications from their phones on this address, e.g. :4043").String()
+	moderatorTokenFlag   = kingpin.Flag("dedication-moderator-token", "Secret for the moderation page. A random one is logged when not given.").String()
+)
+
+// the guest page lists the tracks and has a form for the message
+var guestPage = template.Must(template.New("guest").Funcs(template.FuncMap{"describe": describeTrack}).Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<title>Musikmaskinen</title>
+</head>
+<body>
+<h1>Dedicate a song</h1>
+{{if .Notice}}<p><strong>{{.Notice}}</strong></p>{{end}}
+{{if .Tracks}}
+<form method="post" action="/dedications">
+<p><select name="track_id">
+{{range .Tracks}}<option value="{{.ID}}">{{describe .}}</option>
+{{end}}</select></p>
+<p><input name="from" placeholder="From" maxlength="30"></p>
+<p><input name="message" placeholder="For Rickard on his 40th!" maxlength="{{.MaxLength}}" required></p>
+<p><button type="submit">Send</button></p>
+</form>
+<p>Messages are shown on the screen while the song plays, once the host has had a look at them.</p>
+{{else}}
+<p>Nothing is playing or queued right now. Queue a song first!</p>
+{{end}}
+</body>
+</html>
+`))
+
+// the moderation page has buttons for each pending dedication
+var moderationPage = template.Must(template.New("moderation").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<title>Musikmaskinen moderation</title>
+</head>
+<body>
+<h1>Dedications to moderate</h1>
+{{range .Pending}}
+<form method="post" action="/moderation">
+<p>{{.Track}}<br><strong>{{.Message}}</strong>{{if .From}} from {{.From}}{{end}}</p>
+<input type="hidden" name="id" value="{{.ID}}">
+<button type="submit" name="action" value="approve">Approve</button>
+<button type="submit" name="action" value="reject">Reject</button>
+</form>
+{{else}}
+<p>Nothing to moderate.</p>
+{{end}}
+</body>
+</html>
+`))
+
+type (
+	// Server is the web page where guests send dedications, and where the
+	// moderator approves them
+	Server struct {
+		board *Board
+		token string
+		// Recorder gets what guests and moderators do, when set
+		Recorder Recorder
+	}
+
+	// Recorder records what's done on the pages, so a replayed session has it.
+	// *session.Recorder implements it.
+	Recorder interface {
+		RecordDedication(trackID sp.ID, from, message string) error
+		RecordModeration(id int, approve bool) error
+	}
+
+	guestPageData struct {
+		Tracks    []sp.FullTrack
+		Notice    string
+		MaxLength int
+	}
+)
+
+// NewServer creates a server for a board. The moderation page needs the token.
+func NewServer(board *Board, token string) *Server {
+	return &Server{board: board, token: token}
+}
+
+// ListenFromFlags starts a server on the address given by --dedication-listen,
+// if any. The recorder can be nil.
+func ListenFromFlags(board *Board, recorder Recorder) error {
+	if *dedicationListenFlag == "" {
+		return nil
+	}
+
+	token := *moderatorTokenFlag
+	logToken := false
+	if token == "" {
+		b := make([]byte, 8)
+		if _, err := rand.Read(b); err != nil {
+			return err
+		}
+		token = hex.EncodeToString(b)
+		// nobody knows a random token unless it's logged
+		logToken = true
+	}
+
+	s := NewServer(board, token)
+	s.Recorder = recorder
+	return s.Listen(*dedicationListenFlag, logToken)
+}
+
+// Listen serves the guest page on / and the moderation page on /moderation.
+// The token is only logged with logToken, a token someone picked themselves
+// shouldn't end up in the log.
+func (s *Server) Listen(addr string, logToken bool) error {
+	l, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+
+	token := "<token>"
+	if logToken {
+		token = s.token
+	}
+	log.Infof("Listening for dedications on http://%s/, moderate them on http://%s/moderation?token=%s", l.Addr(), l.Addr(), token)
+
+	server := &http.Server{
+		Handler:      s.Handler(),
+		ReadTimeout:  serverReadTimeout,
+		WriteTimeout: serverWriteTimeout,
+	}
+
+	go func() {
+		err := server.Serve(l)
+		log.WithError(err).Error("Dedication server stopped")
+	}()
+
+	return nil
+}
+
+// Handler serves the guest and moderation pages
+func (s *Server) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", s.handleGuestPage)
+	mux.HandleFunc("/dedications", s.handleSubmit)
+	mux.HandleFunc("/moderation", s.handleModeration)
+	return mux
+}
+
+func (s *Server) renderGuestPage(w http.ResponseWriter, notice string) {
+	err := guestPage.Execute(w, guestPageData{
+		Tracks:    s.board.Tracks(),
+		Notice:    notice,
+		MaxLength: MaxMessageLength,
+	})
+	if err != nil {
+		log.WithError(err).Warn("Unable to render dedication page")
+	}
+}
+
+func (s *Server) handleGuestPage(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/" {
+		http.NotFound(w, r)
+		return
+	}
+	s.renderGuestPage(w, "")
+}
+
+func (s *Server) handleSubmit(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Redirect(w, r, "/", http.StatusSeeOther)
+		return
+	}
+
+	trackID, from, message := sp.ID(r.FormValue("track_id")), r.FormValue("from"), r.FormValue("message")
+	if s.Recorder != nil {
+		if err := s.Recorder.RecordDedication(trackID, from, message); err != nil {
+			log.WithError(err).Warn("Unable to record dedication")
+		}
+	}
+
+	d, err := s.board.Submit(trackID, from, message)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		s.renderGuestPage(w, err.Error())
+		return
+	}
+
+	notice := "Thanks! Your message will be shown once the host has approved it."
+	if d.Status == StatusApproved {
+		notice = "Thanks! Your message will be shown while the song plays."
+	}
+	s.renderGuestPage(w, notice)
+}
+
+// isModerator checks the token in a cookie
+func (s *Server) isModerator(r *http.Request) bool {
+	c, err := r.Cookie(moderatorCookie)
+	return err == nil && s.validToken(c.Value)
+}
+
+func (s *Server) validToken(token string) bool {
+	return subtle.ConstantTimeCompare([]byte(token), []byte(s.token)) == 1
+}
+
+func (s *Server) handleModeration(w http.ResponseWriter, r *http.Request) {
+	if token := r.URL.Query().Get("token"); token != "" {
+		if !s.validToken(token) {
+			http.Error(w, "Forbidden", http.StatusForbidden)
+			return
+		}
+		// trade the token in the address for a cookie
+		http.SetCookie(w, &http.Cookie{
+			Name:     moderatorCookie,
+			Value:    s.token,
+			Path:     "/moderation",
+			HttpOnly: true,
+			SameSite: http.SameSiteStrictMode,
+		})
+		http.Redirect(w, r, "/moderation", http.StatusSeeOther)
+		return
+	}
+
+	if !s.isModerator(r) {
+		http.Error(w, "Forbidden", http.StatusForbidden)
+		return
+	}
+
+	if r.Method == http.MethodPost {
+		id, err := strconv.Atoi(r.FormValue("id"))
+		if err != nil {
+			http.Error(w, "Bad dedication id", http.StatusBadRequest)
+			return
+		}
+
+		approve := r.FormValue("action") == "approve"
+		if s.Recorder != nil {
+			if err := s.Recorder.RecordModeration(id, approve); err != nil {
+				log.WithError(err).Warn("Unable to record moderation")
+			}
+		}
+
+		err = s.board.Moderate(id, approve)
+		if err != nil && err != ErrorAlreadyModerated {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+
+		http.Redirect(w, r, "/moderation", http.StatusSeeOther)
+		return
+	}
+
+	err := moderationPage.Execute(w, struct {
+		Pending []Dedication
+	}{s.board.Pending()})
+	if err != nil {
+		log.WithError(err).Warn("Unable to render moderation page")
+	}
+}
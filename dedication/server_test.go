@@ -0,0 +1,123 @@
+package dedication
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"strings"
+	"testing"
+
+	sp "github.com/nollbit/spotify"
+)
+
+// testRecorder keeps what was recorded, as text
+type testRecorder []string
+
+func (r *testRecorder) RecordDedication(trackID sp.ID, from, message string) error {
+	*r = append(*r, fmt.Sprintf("dedication %s %s %s", trackID, from, message))
+	return nil
+}
+
+func (r *testRecorder) RecordModeration(id int, approve bool) error {
+	*r = append(*r, fmt.Sprintf("moderation %d %v", id, approve))
+	return nil
+}
+
+func TestServerGuestPage(t *testing.T) {
+	s := NewServer(testBoard(false), "secret")
+
+	w := httptest.NewRecorder()
+	s.Handler().ServeHTTP(w, httptest.NewRequest("GET", "/", nil))
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("got status %d", w.Code)
+	}
+	for _, want := range []string{">Abba - Dancing Queen<", ">Untitled<"} {
+		if !strings.Contains(w.Body.String(), want) {
+			t.Errorf("the guest page doesn't list %q", want)
+		}
+	}
+}
+
+func TestServerSubmit(t *testing.T) {
+	board := testBoard(false)
+	s := NewServer(board, "secret")
+	recorder := &testRecorder{}
+	s.Recorder = recorder
+
+	form := url.Values{"track_id": {"2"}, "from": {"Kim"}, "message": {"Grattis!"}}
+	r := httptest.NewRequest("POST", "/dedications", strings.NewReader(form.Encode()))
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	w := httptest.NewRecorder()
+	s.Handler().ServeHTTP(w, r)
+
+	if w.Code != http.StatusOK {
+		t.Errorf("got status %d", w.Code)
+	}
+	if pending := board.Pending(); len(pending) != 1 || pending[0].Track != "Untitled" {
+		t.Errorf("Pending() = %+v after submitting", pending)
+	}
+	if want := (testRecorder{"dedication 2 Kim Grattis!"}); !reflect.DeepEqual(*recorder, want) {
+		t.Errorf("recorded %q, want %q", *recorder, want)
+	}
+}
+
+func TestServerModeration(t *testing.T) {
+	board := testBoard(false)
+	d, err := board.Submit("1", "Kim", "Grattis!")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := NewServer(board, "secret")
+	recorder := &testRecorder{}
+	s.Recorder = recorder
+	h := s.Handler()
+
+	for _, target := range []string{"/moderation", "/moderation?token=wrong"} {
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, httptest.NewRequest("GET", target, nil))
+		if w.Code != http.StatusForbidden {
+			t.Errorf("GET %s: got status %d, want %d", target, w.Code, http.StatusForbidden)
+		}
+	}
+
+	// the token in the address is traded for a cookie
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest("GET", "/moderation?token=secret", nil))
+	if w.Code != http.StatusSeeOther || w.Header().Get("Location") != "/moderation" {
+		t.Fatalf("got status %d to %q, want a redirect to /moderation", w.Code, w.Header().Get("Location"))
+	}
+	cookies := w.Result().Cookies()
+	if len(cookies) != 1 || cookies[0].Name != moderatorCookie || !cookies[0].HttpOnly {
+		t.Fatalf("got cookies %v", cookies)
+	}
+
+	r := httptest.NewRequest("GET", "/moderation", nil)
+	r.AddCookie(cookies[0])
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), "Grattis!") {
+		t.Fatalf("got status %d and no pending dedication", w.Code)
+	}
+	if strings.Contains(w.Body.String(), "secret") {
+		t.Error("the moderation page has the token in it")
+	}
+
+	form := url.Values{"id": {"1"}, "action": {"approve"}}
+	r = httptest.NewRequest("POST", "/moderation", strings.NewReader(form.Encode()))
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	r.AddCookie(cookies[0])
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	if w.Code != http.StatusSeeOther {
+		t.Errorf("approving: got status %d", w.Code)
+	}
+	if got, ok := board.ForTrack(d.TrackID); !ok || got.ID != d.ID {
+		t.Error("the dedication wasn't approved")
+	}
+	if want := (testRecorder{"moderation 1 true"}); !reflect.DeepEqual(*recorder, want) {
+		t.Errorf("recorded %q, want %q", *recorder, want)
+	}
+}
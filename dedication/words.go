@@ -0,0 +1,104 @@
+package dedication
+
+import (
+	"bufio"
+	"os"
+	"strings"
+	"unicode"
+)
+
+// WordList is a list of words that aren't allowed in dedications. A word
+// ending with * also matches every word that starts with it.
+type WordList struct {
+	words    map[string]bool
+	prefixes []string
+}
+
+// the worst of English and Swedish, extend it with --dedication-words
+var defaultWords = []string{
+	"fuck*", "shit*", "cunt*", "bitch*", "whore*", "slut*", "wank*", "dick", "dicks", "cock", "cocks", "pussy",
+	"fitta*", "kuk", "kukar", "kuken", "hora", "horan", "horor", "jävla*", "javla*",
+	"knulla*", "bög", "bögar", "neger*", "nigger*",
+}
+
+// digits and symbols people use to get past word lists
+var lookalikes = strings.NewReplacer(
+	"0", "o", "1", "i", "3", "e", "4", "a", "5", "s", "7", "t", "@", "a", "$", "s", "!", "i",
+)
+
+// NewWordList creates a word list, the words are case insensitive
+func NewWordList(words []string) *WordList {
+	l := &WordList{words: make(map[string]bool)}
+	for _, w := range words {
+		l.add(w)
+	}
+	return l
+}
+
+// DefaultWordList is a short list of English and Swedish swear words and slurs
+func DefaultWordList() *WordList {
+	return NewWordList(defaultWords)
+}
+
+// LoadWordList reads a word list with one word per line. Empty lines and lines
+// starting with # are skipped.
+func LoadWordList(path string) (*WordList, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	words := make([]string, 0)
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		words = append(words, line)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	return NewWordList(words), nil
+}
+
+func (l *WordList) add(word string) {
+	word = strings.ToLower(word)
+	if strings.HasSuffix(word, "*") {
+		l.prefixes = append(l.prefixes, strings.TrimSuffix(word, "*"))
+	} else {
+		l.words[word] = true
+	}
+}
+
+// Matches returns the first word of a text that's on the list. Words are
+// checked as they're written, and with lookalikes replaced, so that both
+// "kuk!" and "$hit" are caught.
+func (l *WordList) Matches(text string) (string, bool) {
+	text = strings.ToLower(text)
+
+	for _, t := range []string{text, lookalikes.Replace(text)} {
+		if word, ok := l.matchWords(t); ok {
+			return word, true
+		}
+	}
+	return "", false
+}
+
+func (l *WordList) matchWords(text string) (string, bool) {
+	for _, word := range strings.FieldsFunc(text, func(r rune) bool { return !unicode.IsLetter(r) }) {
+		if l.words[word] {
+			return word, true
+		}
+		for _, prefix := range l.prefixes {
+			if strings.HasPrefix(word, prefix) {
+				return word, true
+			}
+		}
+	}
+
+	return "", false
+}
@@ -0,0 +1,81 @@
+package dedication
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestWordListMatches(t *testing.T) {
+	l := NewWordList([]string{"Kuk", "fuck*", "bög"})
+
+	tests := []struct {
+		text  string
+		match string
+	}{
+		{"Grattis Rickard!", ""},
+		{"kuk", "kuk"},
+		{"KUK!!", "kuk"},
+		{"din kuk-hjärna", "kuk"},
+		{"kukar", ""},
+		{"fuck", "fuck"},
+		{"absofuckinglutely", ""},
+		{"fuckings", "fuckings"},
+		{"f u c k", ""},
+		{"FUCK1NG", "fuck"},
+		{"FVCK1NG", ""},
+		{"k u k", ""},
+		{"bög", "bög"},
+		{"bögen", ""},
+		{"b0g", ""},
+		{"$hit", ""},
+		{"", ""},
+	}
+
+	for _, tt := range tests {
+		word, ok := l.Matches(tt.text)
+		if ok != (tt.match != "") || word != tt.match {
+			t.Errorf("Matches(%q) = %q, %v, want %q", tt.text, word, ok, tt.match)
+		}
+	}
+}
+
+func TestDefaultWordListLookalikes(t *testing.T) {
+	l := DefaultWordList()
+
+	for _, text := range []string{"$h1t", "fitt4n", "j@vla", "5LUT"} {
+		if _, ok := l.Matches(text); !ok {
+			t.Errorf("%q got past the default word list", text)
+		}
+	}
+	for _, text := range []string{"Skål för Rickard!", "Happy birthday", "Kukkonen"} {
+		if word, ok := l.Matches(text); ok {
+			t.Errorf("%q was stopped by the default word list on %q", text, word)
+		}
+	}
+}
+
+func TestLoadWordList(t *testing.T) {
+	dir, err := ioutil.TempDir("", "words")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "words.txt")
+	err = ioutil.WriteFile(path, []byte("# local words\n\n  Tråkmåns  \nbanan*\n"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	l, err := LoadWordList(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for text, want := range map[string]bool{"tråkmåns": true, "bananer": true, "local": false, "#": false} {
+		if _, ok := l.Matches(text); ok != want {
+			t.Errorf("Matches(%q) = %v, want %v", text, ok, want)
+		}
+	}
+}
@@ -15,12 +15,14 @@ require (
 	github.com/mikkyang/id3-go v0.0.0-20151201011346-0168d962f1d7
 	github.com/mitchellh/go-wordwrap v1.0.0 // indirect
 	github.com/nollbit/spotify v0.0.0-20190319124942-0c3aaca9f839
+	github.com/nsf/termbox-go v0.0.0-20190121233118-02980233997d
 	github.com/pyros2097/go-embed v0.0.0-20160412061840-4274f3450521 // indirect
 	github.com/shelmangroup/oidc-agent v0.0.0-20190301075438-63848772c93d
 	github.com/shuLhan/go-bindata v3.4.0+incompatible // indirect
 	github.com/sirupsen/logrus v1.3.0
 	github.com/toqueteos/webbrowser v1.1.0
 	github.com/zmb3/spotify v0.0.0-20190210152806-94cbe6dc5cc2
+	golang.org/x/net v0.0.0-20190108225652-1e06a53dbb7e
 	golang.org/x/oauth2 v0.0.0-20190226205417-e64efc72b421
 	gopkg.in/alecthomas/kingpin.v2 v2.2.6
 )
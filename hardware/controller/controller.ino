@@ -5,8 +5,8 @@ const int LED_MODE_ON = 1;
 const int LED_MODE_GLOW = 2;
 const int LED_MODE_BLINK = 3;
 
-const int LED_MODE_BLINK_INTERVAL = 1000;
-const int LED_MODE_GLOW_INTERVAL = 25;
+int ledModeBlinkInterval = 1000;
+int ledModeGlowInterval = 25;
 
 
 const int PIN_ROTARY_A = 3; // Connected to CLK
@@ -33,6 +33,9 @@ int pushButtonLedValue = 0;
 int pushButtonLedValueDirection = 1;
 
 unsigned long pushButtonLedNextActionAt = 0;
+
+// commands that take an argument byte are stored here until the argument arrives
+int pendingCmd = 0;
 unsigned long timeMillis;
 
 void setup() {
@@ -77,7 +80,28 @@ void loop() {
    while(Serial.available()) {
     int cmd = Serial.read();
     Serial.println(cmd);
+
+    if (pendingCmd != 0) {
+      switch (pendingCmd) {
+        case 73: // "I", blink interval in tens of milliseconds
+          ledModeBlinkInterval = max(cmd, 1) * 10;
+          break;
+        case 82: // "R", glow step interval in milliseconds
+          ledModeGlowInterval = max(cmd, 1);
+          break;
+      }
+      pendingCmd = 0;
+      continue;
+    }
+
     switch (cmd) {
+      case 73: // "I"
+      case 82: // "R"
+        pendingCmd = cmd;
+        break;
+      case 78: // "N"
+        pushButtonLedMode = LED_MODE_ON;
+        break;
       case 66: // "B"
         pushButtonLedMode = LED_MODE_BLINK;
         break;
@@ -130,7 +154,7 @@ void loop() {
       } else {
         pushButtonLedValue = 0;
       }
-      pushButtonLedNextActionAt = pushButtonLedNextActionAt + LED_MODE_BLINK_INTERVAL;
+      pushButtonLedNextActionAt = timeMillis + ledModeBlinkInterval;
     }
   } else if (pushButtonLedMode == LED_MODE_GLOW) {
     if (timeMillis > pushButtonLedNextActionAt) {
@@ -140,7 +164,7 @@ void loop() {
         pushButtonLedValueDirection = -1;
       }
       pushButtonLedValue += pushButtonLedValueDirection;
-      pushButtonLedNextActionAt = pushButtonLedNextActionAt + LED_MODE_GLOW_INTERVAL;
+      pushButtonLedNextActionAt = timeMillis + ledModeGlowInterval;
     }
     
   }
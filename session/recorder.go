@@ -0,0 +1,111 @@
+package session
+
+import (
+	"encoding/json"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/nollbit/spotify"
+)
+
+const (
+	// SourceController is a byte from any controller
+	SourceController = "controller"
+	// SourceKey is a key press in the terminal
+	SourceKey = "key"
+	// SourcePlaylist is a new version of the curated playlist
+	SourcePlaylist = "playlist"
+	// SourceDedication is a dedication sent from the guest page
+	SourceDedication = "dedication"
+	// SourceModeration is a dedication approved or rejected on the moderation page
+	SourceModeration = "moderation"
+)
+
+type (
+	// Event is one line in a recorded session
+	Event struct {
+		Time       time.Time           `json:"time"`
+		Source     string              `json:"source"`
+		Controller string              `json:"controller,omitempty"`
+		Key        string              `json:"key,omitempty"`
+		Tracks     []spotify.FullTrack `json:"tracks,omitempty"`
+		Dedication *DedicationEvent    `json:"dedication,omitempty"`
+	}
+
+	// DedicationEvent is what a guest sent, or what a moderator did. The ID is
+	// only set for moderation.
+	DedicationEvent struct {
+		ID      int        `json:"id,omitempty"`
+		TrackID spotify.ID `json:"track_id,omitempty"`
+		From    string     `json:"from,omitempty"`
+		Message string     `json:"message,omitempty"`
+		Approve bool       `json:"approve,omitempty"`
+	}
+
+	// Recorder writes every input event to a JSONL file
+	Recorder struct {
+		lock    sync.Mutex
+		file    *os.File
+		encoder *json.Encoder
+	}
+)
+
+func (r *Recorder) record(e *Event) error {
+	if r == nil {
+		return nil
+	}
+
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	e.Time = time.Now()
+	return r.encoder.Encode(e)
+}
+
+// RecordController records a byte from a controller
+func (r *Recorder) RecordController(b byte) error {
+	return r.record(&Event{Source: SourceController, Controller: string([]byte{b})})
+}
+
+// RecordKey records a key press, using the termui event ID
+func (r *Recorder) RecordKey(key string) error {
+	return r.record(&Event{Source: SourceKey, Key: key})
+}
+
+// RecordPlaylist records the tracks of the curated playlist
+func (r *Recorder) RecordPlaylist(tracks []spotify.FullTrack) error {
+	return r.record(&Event{Source: SourcePlaylist, Tracks: tracks})
+}
+
+// RecordDedication records a dedication sent from the guest page, whether the
+// board took it or not
+func (r *Recorder) RecordDedication(trackID spotify.ID, from, message string) error {
+	return r.record(&Event{Source: SourceDedication, Dedication: &DedicationEvent{TrackID: trackID, From: from, Message: message}})
+}
+
+// RecordModeration records a moderator approving or rejecting a dedication
+func (r *Recorder) RecordModeration(id int, approve bool) error {
+	return r.record(&Event{Source: SourceModeration, Dedication: &DedicationEvent{ID: id, Approve: approve}})
+}
+
+func (r *Recorder) Close() error {
+	if r == nil {
+		return nil
+	}
+	return r.file.Close()
+}
+
+// NewRecorder creates a recorder that appends to the file at path. A nil
+// *Recorder is valid and records nothing.
+func NewRecorder(path string) (*Recorder, error) {
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0666)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Recorder{
+		file:    file,
+		encoder: json.NewEncoder(file),
+	}, nil
+}
@@ -0,0 +1,124 @@
+package session
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/nollbit/spotify"
+)
+
+func TestRecordAndReplay(t *testing.T) {
+	dir, err := ioutil.TempDir("", "session")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "session.jsonl")
+
+	tracks := []spotify.FullTrack{{SimpleTrack: spotify.SimpleTrack{ID: "1", Name: "Dancing Queen", URI: "spotify:track:1"}}}
+
+	r, err := NewRecorder(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r.RecordPlaylist(tracks)
+	r.RecordController('W')
+	time.Sleep(20 * time.Millisecond)
+	r.RecordKey("<Enter>")
+	r.RecordDedication("1", "Kim", "Grattis!")
+	r.RecordModeration(1, true)
+	if err := r.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// a nil recorder records nothing
+	var nilRecorder *Recorder
+	if err := nilRecorder.RecordKey("q"); err != nil {
+		t.Errorf("the nil recorder failed: %v", err)
+	}
+
+	replayer, err := NewReplayer(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(replayer.Events) != 5 {
+		t.Fatalf("got %d events, want 5", len(replayer.Events))
+	}
+
+	start := time.Now()
+	replayer.Play(context.Background(), 2)
+
+	if got := <-replayer.Playlists; !reflect.DeepEqual(got, tracks) {
+		t.Errorf("replayed the playlist %v, want %v", got, tracks)
+	}
+	if got := <-replayer.ControllerEvents; got != 'W' {
+		t.Errorf("replayed the controller byte %q, want W", got)
+	}
+	if got := <-replayer.KeyEvents; got != "<Enter>" {
+		t.Errorf("replayed the key %q, want <Enter>", got)
+	}
+	if got, want := <-replayer.Dedications, (DedicationEvent{TrackID: "1", From: "Kim", Message: "Grattis!"}); *got != want {
+		t.Errorf("replayed the dedication %+v, want %+v", *got, want)
+	}
+	if got, want := <-replayer.Moderations, (DedicationEvent{ID: 1, Approve: true}); *got != want {
+		t.Errorf("replayed the moderation %+v, want %+v", *got, want)
+	}
+	// twice as fast
+	if d := time.Since(start); d < 10*time.Millisecond {
+		t.Errorf("replayed in %s, the events were 20ms apart", d)
+	}
+
+	select {
+	case <-replayer.Done:
+	case <-time.After(time.Second):
+		t.Error("the replay never finished")
+	}
+}
+
+func TestReplayStops(t *testing.T) {
+	now := time.Now()
+	replayer := &Replayer{
+		Events: []*Event{
+			{Time: now, Source: SourceKey, Key: "a"},
+			{Time: now.Add(time.Hour), Source: SourceKey, Key: "b"},
+		},
+		KeyEvents: make(chan string),
+		Done:      make(chan struct{}),
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	replayer.Play(ctx, 1)
+	if got := <-replayer.KeyEvents; got != "a" {
+		t.Fatalf("replayed the key %q, want a", got)
+	}
+	cancel()
+
+	select {
+	case <-replayer.Done:
+	case <-time.After(time.Second):
+		t.Error("the replay went on waiting for the next event")
+	}
+}
+
+func TestNewReplayerBadEvent(t *testing.T) {
+	dir, err := ioutil.TempDir("", "session")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "session.jsonl")
+
+	err = ioutil.WriteFile(path, []byte("{\"source\": \"key\", \"key\": \"a\"}\n\n{broken\n"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := NewReplayer(path); err == nil || !strings.HasPrefix(err.Error(), "Bad event on line 3") {
+		t.Errorf("got %v, want a bad event", err)
+	}
+}
@@ -0,0 +1,138 @@
+package session
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/nollbit/spotify"
+	log "github.com/sirupsen/logrus"
+)
+
+// Replayer feeds a recorded session back with the same timing, optionally sped up
+type Replayer struct {
+	Events []*Event
+
+	ControllerEvents chan byte
+	KeyEvents        chan string
+	Playlists        chan []spotify.FullTrack
+	Dedications      chan *DedicationEvent
+	Moderations      chan *DedicationEvent
+	// closed when every event has been replayed, or the replay was stopped
+	Done chan struct{}
+}
+
+// Play starts replaying the events in the background, until they've all been
+// replayed or the context is done
+func (r *Replayer) Play(ctx context.Context, speed float64) {
+	if speed <= 0 {
+		speed = 1
+	}
+
+	go func() {
+		defer close(r.Done)
+
+		if len(r.Events) == 0 {
+			return
+		}
+
+		start := time.Now()
+		recordingStart := r.Events[0].Time
+
+		for i, e := range r.Events {
+			offset := time.Duration(float64(e.Time.Sub(recordingStart)) / speed)
+			timer := time.NewTimer(time.Until(start.Add(offset)))
+			select {
+			case <-timer.C:
+			case <-ctx.Done():
+				timer.Stop()
+				return
+			}
+
+			log.Debugf("Replaying event %d/%d from %s", i+1, len(r.Events), e.Source)
+
+			switch e.Source {
+			case SourceController:
+				if len(e.Controller) != 1 {
+					continue
+				}
+				select {
+				case r.ControllerEvents <- e.Controller[0]:
+				case <-ctx.Done():
+					return
+				}
+			case SourceKey:
+				select {
+				case r.KeyEvents <- e.Key:
+				case <-ctx.Done():
+					return
+				}
+			case SourcePlaylist:
+				select {
+				case r.Playlists <- e.Tracks:
+				case <-ctx.Done():
+					return
+				}
+			case SourceDedication, SourceModeration:
+				if e.Dedication == nil {
+					continue
+				}
+				events := r.Dedications
+				if e.Source == SourceModeration {
+					events = r.Moderations
+				}
+				select {
+				case events <- e.Dedication:
+				case <-ctx.Done():
+					return
+				}
+			}
+		}
+	}()
+}
+
+// NewReplayer loads a session recorded by a Recorder
+func NewReplayer(path string) (*Replayer, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	events := make([]*Event, 0)
+
+	scanner := bufio.NewScanner(file)
+	// playlist events can be large
+	scanner.Buffer(make([]byte, 0, 64*1024), 64*1024*1024)
+	line := 0
+	for scanner.Scan() {
+		line++
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+
+		e := &Event{}
+		err := json.Unmarshal(scanner.Bytes(), e)
+		if err != nil {
+			return nil, fmt.Errorf("Bad event on line %d: %v", line, err)
+		}
+		events = append(events, e)
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	return &Replayer{
+		Events:           events,
+		ControllerEvents: make(chan byte),
+		KeyEvents:        make(chan string),
+		Playlists:        make(chan []spotify.FullTrack),
+		Dedications:      make(chan *DedicationEvent),
+		Moderations:      make(chan *DedicationEvent),
+		Done:             make(chan struct{}),
+	}, nil
+}
@@ -0,0 +1,54 @@
+package session
+
+import (
+	"encoding/json"
+	"os"
+	"time"
+
+	"github.com/nollbit/spotify"
+)
+
+// State is what's saved on shutdown, so a restart doesn't lose the queue
+type State struct {
+	SavedAt time.Time `json:"saved_at"`
+	// the track that was playing, if any
+	Playing *spotify.FullTrack  `json:"playing,omitempty"`
+	Queue   []spotify.FullTrack `json:"queue"`
+	// tracks that can't be queued again until the given time
+	Blacklist map[spotify.ID]time.Time `json:"blacklist"`
+}
+
+// SaveState writes the state to a file. It's written next to it first and then
+// renamed, so a crash halfway doesn't leave a broken file behind.
+func SaveState(path string, state *State) error {
+	state.SavedAt = time.Now()
+
+	data, err := json.MarshalIndent(state, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0666); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// LoadState reads a state written by SaveState. A missing file gives a nil
+// state and no error.
+func LoadState(path string) (*State, error) {
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	state := &State{}
+	if err := json.Unmarshal(data, state); err != nil {
+		return nil, err
+	}
+	return state, nil
+}
@@ -0,0 +1,63 @@
+package session
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/nollbit/spotify"
+)
+
+func TestSaveAndLoadState(t *testing.T) {
+	dir, err := ioutil.TempDir("", "state")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "state.json")
+
+	// nothing saved yet
+	if state, err := LoadState(path); state != nil || err != nil {
+		t.Fatalf("LoadState() = %v, %v without a file", state, err)
+	}
+
+	until := time.Date(2019, 3, 1, 23, 0, 0, 0, time.UTC)
+	state := &State{
+		Playing:   &spotify.FullTrack{SimpleTrack: spotify.SimpleTrack{ID: "1", Name: "Dancing Queen"}},
+		Queue:     []spotify.FullTrack{{SimpleTrack: spotify.SimpleTrack{ID: "2", Name: "Waterloo"}}},
+		Blacklist: map[spotify.ID]time.Time{"3": until},
+	}
+	if err := SaveState(path, state); err != nil {
+		t.Fatal(err)
+	}
+	if state.SavedAt.IsZero() {
+		t.Error("SaveState() didn't set SavedAt")
+	}
+	if _, err := os.Stat(path + ".tmp"); !os.IsNotExist(err) {
+		t.Errorf("the temporary file was left behind: %v", err)
+	}
+
+	loaded, err := LoadState(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if loaded.Playing == nil || loaded.Playing.ID != "1" || len(loaded.Queue) != 1 || loaded.Queue[0].ID != "2" {
+		t.Errorf("loaded %+v", loaded)
+	}
+	if !reflect.DeepEqual(loaded.Blacklist, state.Blacklist) {
+		t.Errorf("loaded the blacklist %v, want %v", loaded.Blacklist, state.Blacklist)
+	}
+	if !loaded.SavedAt.Equal(state.SavedAt) {
+		t.Errorf("loaded SavedAt %s, want %s", loaded.SavedAt, state.SavedAt)
+	}
+
+	if err := ioutil.WriteFile(path, []byte("{broken"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := LoadState(path); err == nil {
+		t.Error("LoadState() didn't fail on a broken file")
+	}
+}
@@ -0,0 +1,205 @@
+package spotify
+
+import (
+	"errors"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/nollbit/spotify"
+)
+
+type (
+	// PlayerBackend is the part of the Spotify API used by the Player.
+	// *spotify.Client implements it.
+	PlayerBackend interface {
+		PlayOpt(opt *spotify.PlayOptions) error
+		Next() error
+		Pause() error
+		PlayerState() (*spotify.PlayerState, error)
+		TransferPlayback(deviceID spotify.ID, play bool) error
+		VolumeOpt(percent int, opt *spotify.PlayOptions) error
+	}
+
+	// playbackRater is implemented by backends that don't play in real time
+	playbackRater interface {
+		PlaybackRate() float64
+	}
+
+	// FakeBackend pretends to be a Spotify device. Tracks play in real time,
+	// optionally sped up, and no requests are sent anywhere. Used when
+	// replaying sessions.
+	FakeBackend struct {
+		lock    sync.Mutex
+		tracks  map[spotify.URI]spotify.FullTrack
+		playing *spotify.FullTrack
+		// the album or playlist it's playing from, only reported back
+		context spotify.URI
+		started time.Time
+		speed   float64
+		volume  int
+		// go on to another track after a skip or the end of a track
+		autoplay bool
+	}
+)
+
+const fakeDeviceID = spotify.ID("fake")
+
+var (
+	// ErrorUnknownTrack is what Spotify says about a track it doesn't have
+	ErrorUnknownTrack = spotify.Error{Status: http.StatusNotFound, Message: "Unknown track"}
+)
+
+// AddTracks makes the tracks playable on the fake backend
+func (f *FakeBackend) AddTracks(tracks []spotify.FullTrack) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	for _, t := range tracks {
+		f.tracks[t.URI] = t
+	}
+}
+
+// PlayOpt plays the first of the URIs. The playback context is only reported
+// back in the player state, like when someone plays a track from an album.
+func (f *FakeBackend) PlayOpt(opt *spotify.PlayOptions) error {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	if len(opt.URIs) == 0 {
+		return errors.New("Nothing to play")
+	}
+
+	track, ok := f.tracks[opt.URIs[0]]
+	if !ok {
+		return ErrorUnknownTrack
+	}
+
+	f.playing = &track
+	f.context = ""
+	if opt.PlaybackContext != nil {
+		f.context = *opt.PlaybackContext
+	}
+	f.started = time.Now().Add(-time.Duration(float64(opt.PositionMs)/f.speed) * time.Millisecond)
+	return nil
+}
+
+// SetAutoplay makes the fake backend go on to another track after a skip or
+// the end of a track, like Spotify does with autoplay on
+func (f *FakeBackend) SetAutoplay(on bool) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	f.autoplay = on
+}
+
+func (f *FakeBackend) Next() error {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	f.playNext(time.Now())
+	return nil
+}
+
+func (f *FakeBackend) Pause() error {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	f.playing = nil
+	return nil
+}
+
+// playNext stops the playing track, and starts another one at the given time
+// with autoplay on. The lock must be held.
+func (f *FakeBackend) playNext(at time.Time) {
+	var current spotify.URI
+	if f.playing != nil {
+		current = f.playing.URI
+	}
+	f.playing = nil
+	f.context = ""
+	if !f.autoplay {
+		return
+	}
+
+	uris := make([]string, 0, len(f.tracks))
+	for uri := range f.tracks {
+		if uri != current {
+			uris = append(uris, string(uri))
+		}
+	}
+	if len(uris) == 0 {
+		return
+	}
+	sort.Strings(uris)
+
+	track := f.tracks[spotify.URI(uris[0])]
+	f.playing = &track
+	f.started = at
+}
+
+// TransferPlayback does nothing, there's only one fake device
+func (f *FakeBackend) TransferPlayback(deviceID spotify.ID, play bool) error {
+	return nil
+}
+
+// VolumeOpt only remembers the volume, to report it in the player state
+func (f *FakeBackend) VolumeOpt(percent int, opt *spotify.PlayOptions) error {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	f.volume = percent
+	return nil
+}
+
+func (f *FakeBackend) PlayerState() (*spotify.PlayerState, error) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	state := &spotify.PlayerState{
+		Device: spotify.PlayerDevice{ID: fakeDeviceID, Name: "Fake player", Type: "Computer", Active: true, Volume: f.volume},
+	}
+	cp := &state.CurrentlyPlaying
+	cp.Timestamp = time.Now().Unix() * 1000
+
+	if f.playing == nil {
+		return state, nil
+	}
+
+	progress := int(float64(time.Now().Sub(f.started)/time.Millisecond) * f.speed)
+	if progress >= f.playing.Duration {
+		// the track has ended
+		ended := f.started.Add(time.Duration(float64(f.playing.Duration)/f.speed) * time.Millisecond)
+		f.playNext(ended)
+		if f.playing == nil {
+			return state, nil
+		}
+		progress = int(float64(time.Now().Sub(f.started)/time.Millisecond) * f.speed)
+	}
+
+	cp.Item = f.playing
+	cp.PlaybackContext.URI = f.context
+	cp.Playing = true
+	cp.Progress = progress
+
+	return state, nil
+}
+
+// PlaybackRate is how much faster than real time tracks play
+func (f *FakeBackend) PlaybackRate() float64 {
+	return f.speed
+}
+
+// NewFakeBackend creates a fake backend. Speed is how much faster than real time tracks play.
+func NewFakeBackend(speed float64) *FakeBackend {
+	if speed <= 0 {
+		speed = 1
+	}
+
+	return &FakeBackend{
+		tracks: make(map[spotify.URI]spotify.FullTrack),
+		speed:  speed,
+		volume: 50,
+	}
+}
@@ -3,6 +3,7 @@ package spotify
 import (
 	"crypto/rand"
 	"encoding/base64"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
@@ -15,23 +16,29 @@ import (
 )
 
 var (
-	spotifyClientID     = kingpin.Flag("spotify-client-id", "Spotify client ID. See https://developer.spotify.com/dashboard/applications").Required().String()
-	spotifyClientSecret = kingpin.Flag("spotify-client-secret", "Spotify client secret").Required().String()
+	spotifyClientID     = kingpin.Flag("spotify-client-id", "Spotify client ID. See https://developer.spotify.com/dashboard/applications").String()
+	spotifyClientSecret = kingpin.Flag("spotify-client-secret", "Spotify client secret").String()
 
 	SpotifyCuratedPlaylistID = kingpin.
-					Flag("spotify-curated-playlist", "The playlist from which people can select tracks. Must belong to the logged in user.").
-					Default("5qpgQ7n2oPEw71GrLLnt85").
+					Flag("spotify-curated-playlist", "The playlist from which people can select tracks, the same as --source=spotify:playlist:<id>").
 					String()
 
 	oauthCallbackPort = kingpin.Flag("oauth-callback-port", "Where to redirect the user after login").Default("4040").Int()
 )
 
 func GetClient() (*spotify.Client, error) {
+	// not required by kingpin since replaying sessions doesn't need them
+	if *spotifyClientID == "" || *spotifyClientSecret == "" {
+		return nil, errors.New("--spotify-client-id and --spotify-client-secret are required")
+	}
 
 	auth := spotify.NewAuthenticator("http://localhost:4040/callback",
 		spotify.ScopeUserReadPlaybackState,
 		spotify.ScopeUserModifyPlaybackState,
 		spotify.ScopePlaylistModifyPrivate,
+		// for followed and collaborative playlists
+		spotify.ScopePlaylistReadPrivate,
+		spotify.ScopePlaylistReadCollaborative,
 	)
 
 	auth.SetAuthInfo(*spotifyClientID, *spotifyClientSecret)
@@ -1,6 +1,7 @@
 package spotify
 
 import (
+	"context"
 	"sort"
 	"strings"
 	"time"
@@ -14,6 +15,35 @@ type CuratedPlaylist struct {
 	Tracks     []spotify.FullTrack
 	Changes    chan string              // is there a no-op type for channels?
 	blacklist  map[spotify.ID]time.Time // stores the track blacklist
+	// the names of the sources each track is in
+	sources map[spotify.ID][]string
+	// nil unless audio features are fetched
+	features *FeatureCache
+}
+
+// Features returns the audio features of a track, if they're known
+func (c *CuratedPlaylist) Features(trackID spotify.ID) (Features, bool) {
+	return c.features.Get(trackID)
+}
+
+// Sources returns the names of the playlists, albums and artists a track is
+// from
+func (c *CuratedPlaylist) Sources(trackID spotify.ID) []string {
+	return c.sources[trackID]
+}
+
+// SourceNames returns the names of all sources with tracks, in order
+func (c *CuratedPlaylist) SourceNames() []string {
+	names := make([]string, 0)
+	for _, t := range c.Tracks {
+		for _, name := range c.sources[t.ID] {
+			if !hasSource(names, name) {
+				names = append(names, name)
+			}
+		}
+	}
+	sort.Strings(names)
+	return names
 }
 
 func (c *CuratedPlaylist) BlacklistTrack(trackID spotify.ID, duration time.Duration) {
@@ -33,77 +63,52 @@ func (c *CuratedPlaylist) IsTrackBlacklisted(trackID spotify.ID) (time.Time, boo
 
 }
 
-func NewCuratedPlaylist(spotifyClient *spotify.Client, playlistID spotify.ID) (*CuratedPlaylist, error) {
-	log.Debugf("Creating curated playlist from %s", playlistID)
+// Blacklist returns the blacklisted tracks and until when they are, for saving
+// the state
+func (c *CuratedPlaylist) Blacklist() map[spotify.ID]time.Time {
+	blacklist := make(map[spotify.ID]time.Time, len(c.blacklist))
+	for id, t := range c.blacklist {
+		if t.After(time.Now()) {
+			blacklist[id] = t
+		}
+	}
+	return blacklist
+}
 
-	curatedPlaylistChanges := make(chan *spotify.FullPlaylist)
-	err := WatchPlaylist(spotifyClient, playlistID, curatedPlaylistChanges)
-	if err != nil {
-		log.WithError(err).Error("Unable to watch playlist")
-		return nil, err
+// RestoreBlacklist adds tracks saved with Blacklist
+func (c *CuratedPlaylist) RestoreBlacklist(blacklist map[spotify.ID]time.Time) {
+	for id, t := range blacklist {
+		c.blacklist[id] = t
 	}
+}
+
+// SetTracks replaces the tracks, sorted by first artist name (case insensitive) and track name
+func (c *CuratedPlaylist) SetTracks(tracks []spotify.FullTrack) {
+	sort.Slice(tracks, func(i, j int) bool {
+		artistI := strings.ToLower(tracks[i].Artists[0].Name)
+		artistJ := strings.ToLower(tracks[j].Artists[0].Name)
+		if artistI != artistJ {
+			return artistI < artistJ
+		}
+		return tracks[i].Name < tracks[j].Name
+	})
 
-	c := &CuratedPlaylist{
+	c.Tracks = tracks
+}
+
+// NewFixedCuratedPlaylist creates a curated playlist that isn't backed by a
+// Spotify playlist. Tracks are set with SetTracks.
+func NewFixedCuratedPlaylist(playlistID spotify.ID) *CuratedPlaylist {
+	return &CuratedPlaylist{
 		PlaylistID: playlistID,
 		Tracks:     make([]spotify.FullTrack, 0),
 		Changes:    make(chan string),
 		blacklist:  make(map[spotify.ID]time.Time),
 	}
+}
 
-	go func() {
-		for {
-			curatedPlaylist := <-curatedPlaylistChanges
-
-			newCuratedPlaylistTracks := make([]spotify.FullTrack, 0, len(c.Tracks))
-
-			// So, the spotify pkg doesn't page, so we'll have to do that manually for now
-			// https://github.com/zmb3/spotify/pull/79
-			page := &curatedPlaylist.Tracks
-
-			morePages := true
-			for morePages {
-				plTracks := page.Tracks
-				log.Debugf("Adding %d tracks from page", len(page.Tracks))
-				for _, plTrack := range plTracks {
-					newCuratedPlaylistTracks = append(newCuratedPlaylistTracks, plTrack.Track)
-				}
-
-				var err error
-				if page.Next != "" {
-					newPage := &spotify.PlaylistTrackPage{}
-					err = spotifyClient.Get(page.Next, newPage)
-
-					if err != nil {
-						log.WithError(err).Error("Unable to get next page")
-						break
-					}
-
-					page = newPage
-				} else {
-					break
-				}
-
-			}
-
-			if err != nil {
-				// we really don't want to die, so let's just ignore this round of changes instead
-				continue
-			}
-
-			// sort by first artist name (case insensitive), track name desc
-			sort.Slice(newCuratedPlaylistTracks, func(i, j int) bool {
-				artistI := strings.ToLower(newCuratedPlaylistTracks[i].Artists[0].Name)
-				artistJ := strings.ToLower(newCuratedPlaylistTracks[j].Artists[0].Name)
-				if artistI != artistJ {
-					return artistI < artistJ
-				}
-				return newCuratedPlaylistTracks[i].Name < newCuratedPlaylistTracks[j].Name
-			})
-
-			c.Tracks = newCuratedPlaylistTracks
-			c.Changes <- curatedPlaylist.SnapshotID
-		}
-	}()
-
-	return c, nil
+// NewCuratedPlaylist keeps the tracks of a Spotify playlist up to date, until
+// the context is done. It's a library with only that playlist.
+func NewCuratedPlaylist(ctx context.Context, spotifyClient *spotify.Client, guard *Guard, playlistID spotify.ID, opts CuratedOptions) (*CuratedPlaylist, error) {
+	return NewCuratedLibrary(ctx, spotifyClient, guard, []Source{{Kind: SourcePlaylist, ID: playlistID}}, opts)
 }
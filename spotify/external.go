@@ -0,0 +1,52 @@
+package spotify
+
+import (
+	"github.com/nollbit/spotify"
+	"gopkg.in/alecthomas/kingpin.v2"
+)
+
+var (
+	externalControlFlag = kingpin.Flag("external-control", "What to do when someone else plays something on the Spotify account: pause the queue until they're done, reclaim the device or adopt their track as now playing").
+		Default(string(ExternalPause)).Enum(string(ExternalPause), string(ExternalReclaim), string(ExternalAdopt))
+)
+
+type (
+	// ExternalPolicy is what the player does when someone else takes over
+	// playback, i.e. from the Spotify app on their phone
+	ExternalPolicy string
+
+	// PlayerExternalStatus is sent when someone else takes over playback, and
+	// when the queue resumes after being paused
+	PlayerExternalStatus struct {
+		Policy ExternalPolicy
+		// what's playing instead and where, nil when it's over
+		Track  *spotify.FullTrack
+		Device string
+		// the queue is playing again after being paused
+		Resumed bool
+	}
+)
+
+const (
+	// ExternalPause lets the other track play, the queue waits until nothing is playing
+	ExternalPause ExternalPolicy = "pause"
+	// ExternalReclaim starts our track again, where it was, on our device
+	ExternalReclaim ExternalPolicy = "reclaim"
+	// ExternalAdopt shows the other track as now playing, the queue continues after it
+	ExternalAdopt ExternalPolicy = "adopt"
+)
+
+// ExternalPolicyFromFlags returns the policy given by --external-control
+func ExternalPolicyFromFlags() ExternalPolicy {
+	return ExternalPolicy(*externalControlFlag)
+}
+
+// external tells the UI that someone else took over, or that they're done
+func (p *Player) external(e *PlayerExternalStatus) {
+	go func() {
+		select {
+		case p.ExternalEvents <- e:
+		case <-p.ctx.Done():
+		}
+	}()
+}
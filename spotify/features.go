@@ -0,0 +1,192 @@
+package spotify
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/nollbit/spotify"
+	log "github.com/sirupsen/logrus"
+	"gopkg.in/alecthomas/kingpin.v2"
+)
+
+var (
+	audioFeaturesFlag      = kingpin.Flag("audio-features", "Get the tempo, energy, danceability and key of the curated tracks from Spotify").Bool()
+	audioFeaturesCacheFlag = kingpin.Flag("audio-features-cache", "Where to keep audio features between runs. Defaults to the user cache directory.").String()
+)
+
+const (
+	// how many tracks Spotify gives audio features for at once
+	featuresPerRequest = 100
+)
+
+type (
+	// Features is what a track sounds like, according to Spotify
+	Features struct {
+		// beats per minute
+		Tempo float64 `json:"tempo"`
+		// 0 to 1, how intense and active it is
+		Energy float64 `json:"energy"`
+		// 0 to 1, how suitable it is for dancing
+		Danceability float64 `json:"danceability"`
+		// pitch class, 0 is C, 1 is C♯ and so on. -1 when unknown.
+		Key int `json:"key"`
+		// 1 is major, 0 is minor
+		Mode int `json:"mode"`
+	}
+
+	// FeatureCache keeps the audio features of tracks, on disk as well so
+	// they're only fetched once. It's safe to use from several goroutines.
+	FeatureCache struct {
+		path string
+
+		lock     sync.Mutex
+		features map[spotify.ID]Features
+	}
+)
+
+// NewFeatureCache loads the features saved in a file, if it exists
+func NewFeatureCache(path string) (*FeatureCache, error) {
+	c := &FeatureCache{
+		path:     path,
+		features: make(map[spotify.ID]Features),
+	}
+
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return c, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	err = json.Unmarshal(data, &c.features)
+	if err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// AudioFeaturesEnabled tells if --audio-features was given
+func AudioFeaturesEnabled() bool {
+	return *audioFeaturesFlag
+}
+
+// NewFeatureCacheFromFlags creates a cache in the file given by
+// --audio-features-cache. Without --audio-features there's no cache and no
+// features are fetched.
+func NewFeatureCacheFromFlags() (*FeatureCache, error) {
+	if !*audioFeaturesFlag {
+		return nil, nil
+	}
+
+	path := *audioFeaturesCacheFlag
+	if path == "" {
+		userCache, err := os.UserCacheDir()
+		if err != nil {
+			return nil, err
+		}
+		dir := filepath.Join(userCache, "musikmaskinen")
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return nil, err
+		}
+		path = filepath.Join(dir, "audio-features.json")
+	}
+	return NewFeatureCache(path)
+}
+
+// Get returns the features of a track, if they're known. A nil cache knows
+// nothing.
+func (c *FeatureCache) Get(trackID spotify.ID) (Features, bool) {
+	if c == nil {
+		return Features{}, false
+	}
+
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	f, ok := c.features[trackID]
+	return f, ok
+}
+
+// Fetch gets the features of the tracks that aren't in the cache yet, in
+// batches, and saves the cache. Each batch is only tried once, tracks that
+// failed are tried again the next time.
+func (c *FeatureCache) Fetch(client *spotify.Client, guard *Guard, tracks []spotify.FullTrack) {
+	if c == nil {
+		return
+	}
+
+	missing := make([]spotify.ID, 0)
+	c.lock.Lock()
+	for _, t := range tracks {
+		if _, ok := c.features[t.ID]; !ok {
+			missing = append(missing, t.ID)
+		}
+	}
+	c.lock.Unlock()
+
+	if len(missing) == 0 {
+		return
+	}
+	log.Debugf("Getting audio features of %d tracks", len(missing))
+
+	fetched := 0
+	for len(missing) > 0 {
+		n := len(missing)
+		if n > featuresPerRequest {
+			n = featuresPerRequest
+		}
+
+		var result []*spotify.AudioFeatures
+		err := guard.Call(func() (err error) {
+			result, err = client.GetAudioFeatures(missing[:n]...)
+			return err
+		})
+		if err != nil {
+			log.WithError(err).Warnf("Unable to get audio features of %d tracks", len(missing))
+			break
+		}
+
+		c.lock.Lock()
+		for _, af := range result {
+			// tracks without features are null
+			if af == nil {
+				continue
+			}
+			c.features[af.ID] = Features{
+				Tempo:        float64(af.Tempo),
+				Energy:       float64(af.Energy),
+				Danceability: float64(af.Danceability),
+				Key:          af.Key,
+				Mode:         af.Mode,
+			}
+			fetched++
+		}
+		c.lock.Unlock()
+
+		missing = missing[n:]
+	}
+
+	if fetched > 0 {
+		if err := c.save(); err != nil {
+			log.WithError(err).Warn("Unable to save audio features")
+		}
+	}
+}
+
+func (c *FeatureCache) save() error {
+	c.lock.Lock()
+	data, err := json.Marshal(c.features)
+	c.lock.Unlock()
+	if err != nil {
+		return err
+	}
+
+	tmp := c.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0666); err != nil {
+		return err
+	}
+	return os.Rename(tmp, c.path)
+}
@@ -0,0 +1,232 @@
+package spotify
+
+import (
+	"context"
+	"errors"
+	"math/rand"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/nollbit/spotify"
+	log "github.com/sirupsen/logrus"
+)
+
+type (
+	// GuardStatus is how the connection to Spotify is doing
+	GuardStatus int
+
+	// GuardState is the status of a Guard and until when no requests are sent
+	GuardState struct {
+		Status GuardStatus
+		Until  time.Time
+		// the last error, nil when everything is fine
+		Err error
+	}
+
+	// Guard is shared by everything that talks to Spotify. Requests go through
+	// Call, which keeps track of failures. When Spotify says it's getting too
+	// many requests, nothing is sent for a while. After too many failures in a
+	// row the circuit opens and nothing is sent for a while, so a broken network
+	// or an outage doesn't turn in to a flood of requests. Callers that retry
+	// wait for Delay between attempts. Requests Spotify turns down, like a 404
+	// for a track that's gone, aren't failures and aren't retried.
+	Guard struct {
+		// failures in a row before the circuit opens
+		MaxFailures int
+		// how long the circuit stays open
+		OpenFor time.Duration
+		// backoff between retries, doubling up to MaxDelay
+		BaseDelay time.Duration
+		MaxDelay  time.Duration
+
+		lock     sync.Mutex
+		state    GuardState
+		failures int
+	}
+)
+
+const (
+	// GuardOK means requests go through as usual
+	GuardOK GuardStatus = iota
+	// GuardRetrying means requests have failed, but not enough to give up
+	GuardRetrying
+	// GuardRateLimited means Spotify asked us to slow down
+	GuardRateLimited
+	// GuardOpen means Spotify has failed so many times that it's left alone for a while
+	GuardOpen
+)
+
+const (
+	// how long to wait after a 429. The client keeps the Retry-After header to
+	// itself, so it's as long as the client waits with AutoRetry when Spotify
+	// doesn't say.
+	defaultRetryAfter = 5 * time.Second
+)
+
+var (
+	ErrorRateLimited = errors.New("Spotify is rate limiting requests")
+	ErrorCircuitOpen = errors.New("Spotify has failed too many times, waiting before trying again")
+)
+
+func (s GuardStatus) String() string {
+	switch s {
+	case GuardRetrying:
+		return "retrying"
+	case GuardRateLimited:
+		return "rate limited"
+	case GuardOpen:
+		return "open"
+	}
+	return "ok"
+}
+
+// NewGuard creates a guard with sensible defaults
+func NewGuard() *Guard {
+	return &Guard{
+		MaxFailures: 5,
+		OpenFor:     30 * time.Second,
+		BaseDelay:   time.Second,
+		MaxDelay:    time.Minute,
+	}
+}
+
+// State returns the current state, for showing in the UI
+func (g *Guard) State() GuardState {
+	g.lock.Lock()
+	defer g.lock.Unlock()
+
+	return g.state
+}
+
+// Call runs a request unless Spotify is rate limiting us or the circuit is
+// open, in which case ErrorRateLimited or ErrorCircuitOpen is returned right
+// away. It never blocks on its own.
+func (g *Guard) Call(request func() error) error {
+	g.lock.Lock()
+	if g.state.Status == GuardRateLimited || g.state.Status == GuardOpen {
+		if time.Now().Before(g.state.Until) {
+			err := ErrorRateLimited
+			if g.state.Status == GuardOpen {
+				err = ErrorCircuitOpen
+			}
+			g.lock.Unlock()
+			return err
+		}
+		// half open, let this request through and see how it goes
+	}
+	g.lock.Unlock()
+
+	err := request()
+	if permanent(err) {
+		// Spotify is fine, it's the request
+		return err
+	}
+
+	g.lock.Lock()
+	defer g.lock.Unlock()
+
+	if err == nil {
+		if g.state.Status != GuardOK {
+			log.Info("Spotify requests are working again")
+		}
+		g.failures = 0
+		g.state = GuardState{Status: GuardOK}
+		return nil
+	}
+
+	g.failures++
+	g.state.Err = err
+
+	if wait, ok := rateLimited(err); ok {
+		log.WithError(err).Warnf("Spotify is rate limiting requests, waiting %s", wait)
+		g.state.Status = GuardRateLimited
+		g.state.Until = time.Now().Add(wait)
+		return err
+	}
+
+	if g.failures >= g.MaxFailures {
+		log.WithError(err).Warnf("Spotify failed %d times in a row, leaving it alone for %s", g.failures, g.OpenFor)
+		g.state.Status = GuardOpen
+		g.state.Until = time.Now().Add(g.OpenFor)
+		return err
+	}
+
+	g.state.Status = GuardRetrying
+	g.state.Until = time.Time{}
+	return err
+}
+
+// Delay is how long to wait before retry number attempt (counting from 0). It
+// backs off exponentially with jitter, and is never shorter than the time
+// Spotify asked us to wait.
+func (g *Guard) Delay(attempt int) time.Duration {
+	delay := g.BaseDelay
+	for i := 0; i < attempt && delay < g.MaxDelay; i++ {
+		delay *= 2
+	}
+	if delay > g.MaxDelay {
+		delay = g.MaxDelay
+	}
+	// anywhere between half and all of it, so retries don't line up
+	delay = delay/2 + time.Duration(rand.Int63n(int64(delay/2)+1))
+
+	g.lock.Lock()
+	defer g.lock.Unlock()
+
+	if wait := time.Until(g.state.Until); wait > delay {
+		return wait
+	}
+	return delay
+}
+
+// Retry calls request until it succeeds, waiting longer and longer between
+// attempts. It gives up when the context is done, and right away when Spotify
+// turns the request down.
+func (g *Guard) Retry(ctx context.Context, what string, request func() error) error {
+	for attempt := 0; ; attempt++ {
+		err := g.Call(request)
+		if err == nil {
+			return nil
+		}
+		if permanent(err) {
+			log.WithError(err).Warnf("Unable to %s", what)
+			return err
+		}
+
+		delay := g.Delay(attempt)
+		log.WithError(err).Warnf("Unable to %s, trying again in %s", what, delay.Round(time.Millisecond))
+		if !sleep(ctx, delay) {
+			return ctx.Err()
+		}
+	}
+}
+
+// sleep waits for a while, it returns false if the context was done first
+func sleep(ctx context.Context, d time.Duration) bool {
+	t := time.NewTimer(d)
+	defer t.Stop()
+
+	select {
+	case <-t.C:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+// rateLimited tells if an error is a 429, and how long to wait
+func rateLimited(err error) (time.Duration, bool) {
+	if e, ok := err.(spotify.Error); ok && e.Status == http.StatusTooManyRequests {
+		return defaultRetryAfter, true
+	}
+
+	return 0, false
+}
+
+// permanent tells if Spotify turned a request down, so that trying it again
+// won't help. That's any 4xx but a 429.
+func permanent(err error) bool {
+	e, ok := err.(spotify.Error)
+	return ok && e.Status >= 400 && e.Status < 500 && e.Status != http.StatusTooManyRequests
+}
@@ -0,0 +1,172 @@
+package spotify
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/nollbit/spotify"
+	"golang.org/x/oauth2"
+)
+
+var errorTest = errors.New("Spotify is down")
+
+func TestGuardDelay(t *testing.T) {
+	g := &Guard{BaseDelay: time.Second, MaxDelay: 10 * time.Second}
+
+	tests := []struct {
+		attempt int
+		max     time.Duration
+	}{
+		{0, time.Second},
+		{1, 2 * time.Second},
+		{2, 4 * time.Second},
+		{3, 8 * time.Second},
+		{4, 10 * time.Second},
+		{100, 10 * time.Second},
+	}
+
+	for _, tt := range tests {
+		for i := 0; i < 20; i++ {
+			if d := g.Delay(tt.attempt); d < tt.max/2 || d > tt.max {
+				t.Errorf("Delay(%d) = %s, want between %s and %s", tt.attempt, d, tt.max/2, tt.max)
+			}
+		}
+	}
+}
+
+func TestGuardCircuit(t *testing.T) {
+	g := &Guard{MaxFailures: 3, OpenFor: 50 * time.Millisecond, BaseDelay: time.Millisecond, MaxDelay: time.Millisecond}
+	fail := func() error { return errorTest }
+
+	for i := 0; i < 2; i++ {
+		if err := g.Call(fail); err != errorTest {
+			t.Fatalf("call %d: got %v", i, err)
+		}
+		if s := g.State(); s.Status != GuardRetrying || s.Err != errorTest {
+			t.Fatalf("call %d: state %+v, want retrying", i, s)
+		}
+	}
+
+	g.Call(fail)
+	if s := g.State(); s.Status != GuardOpen {
+		t.Fatalf("state %+v after 3 failures, want open", s)
+	}
+
+	// nothing gets through while it's open
+	called := false
+	if err := g.Call(func() error { called = true; return nil }); err != ErrorCircuitOpen || called {
+		t.Fatalf("open circuit: got %v and called %v", err, called)
+	}
+	if d := g.Delay(0); d < 30*time.Millisecond {
+		t.Errorf("Delay(0) = %s while the circuit is open", d)
+	}
+
+	// half open, one failure opens it again
+	time.Sleep(60 * time.Millisecond)
+	if err := g.Call(fail); err != errorTest {
+		t.Fatalf("half open: got %v", err)
+	}
+	if s := g.State(); s.Status != GuardOpen {
+		t.Fatalf("state %+v after failing half open, want open", s)
+	}
+
+	// and a success closes it
+	time.Sleep(60 * time.Millisecond)
+	if err := g.Call(func() error { return nil }); err != nil {
+		t.Fatalf("half open: got %v", err)
+	}
+	if s := g.State(); s.Status != GuardOK || s.Err != nil {
+		t.Errorf("state %+v after a success, want ok", s)
+	}
+	if err := g.Call(fail); err != errorTest || g.State().Status != GuardRetrying {
+		t.Errorf("the failures weren't reset by the success")
+	}
+}
+
+func TestGuardRateLimited(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		wait time.Duration
+	}{
+		{"429", spotify.Error{Status: http.StatusTooManyRequests, Message: "API rate limit exceeded"}, defaultRetryAfter},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := NewGuard()
+			if err := g.Call(func() error { return tt.err }); err != tt.err {
+				t.Fatalf("got %v", err)
+			}
+
+			s := g.State()
+			if s.Status != GuardRateLimited {
+				t.Fatalf("state %+v, want rate limited", s)
+			}
+			if wait := time.Until(s.Until); wait < tt.wait-time.Second || wait > tt.wait {
+				t.Errorf("waiting %s, want %s", wait, tt.wait)
+			}
+			if d := g.Delay(0); d < tt.wait-time.Second {
+				t.Errorf("Delay(0) = %s, want at least %s", d, tt.wait-time.Second)
+			}
+			if err := g.Call(func() error { return nil }); err != ErrorRateLimited {
+				t.Errorf("got %v while rate limited", err)
+			}
+		})
+	}
+}
+
+func TestGuardPermanent(t *testing.T) {
+	g := &Guard{MaxFailures: 1, OpenFor: time.Minute, BaseDelay: time.Millisecond, MaxDelay: time.Millisecond}
+	notFound := spotify.Error{Status: http.StatusNotFound, Message: "Non existing id"}
+
+	calls := 0
+	err := g.Retry(context.Background(), "get album", func() error {
+		calls++
+		return notFound
+	})
+	if err != notFound || calls != 1 {
+		t.Fatalf("got %v after %d calls, want the 404 after 1", err, calls)
+	}
+	if s := g.State(); s.Status != GuardOK {
+		t.Errorf("state %+v after a 404, want ok", s)
+	}
+
+	tests := []struct {
+		err       error
+		permanent bool
+	}{
+		{notFound, true},
+		{spotify.Error{Status: http.StatusForbidden}, true},
+		{spotify.Error{Status: http.StatusTooManyRequests}, false},
+		{spotify.Error{Status: http.StatusBadGateway}, false},
+		{errorTest, false},
+		{nil, false},
+	}
+	for _, tt := range tests {
+		if got := permanent(tt.err); got != tt.permanent {
+			t.Errorf("permanent(%v) = %v", tt.err, got)
+		}
+	}
+}
+
+func TestClientRateLimited(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusTooManyRequests)
+		w.Write([]byte(`{"error": {"status": 429, "message": "API rate limit exceeded"}}`))
+	}))
+	defer server.Close()
+
+	client := spotify.NewAuthenticator(server.URL).NewClient(&oauth2.Token{AccessToken: "token"})
+
+	g := NewGuard()
+	var user spotify.User
+	g.Call(func() error { return client.Get(server.URL+"/me", &user) })
+	if s := g.State(); s.Status != GuardRateLimited {
+		t.Fatalf("state %+v, want rate limited", s)
+	}
+}
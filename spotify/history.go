@@ -0,0 +1,294 @@
+package spotify
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/nollbit/spotify"
+	log "github.com/sirupsen/logrus"
+	"gopkg.in/alecthomas/kingpin.v2"
+)
+
+var (
+	historyFlag        = kingpin.Flag("history-playlist", "Add every track that played to a private \"Party history <date>\" playlist").Bool()
+	historySkippedFlag = kingpin.Flag("history-skipped", "Add the tracks that were skipped to a \"Party history <date> (skipped)\" playlist").Bool()
+)
+
+const (
+	// a party that goes on past midnight belongs to the day it started, so
+	// the date changes in the morning
+	historyDayStart = 6 * time.Hour
+	// plays waiting to be written, more than a night's worth
+	historyBuffer = 256
+	// how long the plays that are left get to be written when closing
+	historyDrainTimeout = 10 * time.Second
+
+	currentUserPlaylistsURL = "https://api.spotify.com/v1/me/playlists?limit=50"
+	historyTracksURL        = "https://api.spotify.com/v1/playlists/%s/tracks?fields=next,items(added_at,track(id))&limit=100"
+)
+
+type (
+	// HistoryBackend is the part of the Spotify API used by the History.
+	// *spotify.Client implements it.
+	HistoryBackend interface {
+		CurrentUser() (*spotify.PrivateUser, error)
+		CreatePlaylistForUser(userID, playlistName, description string, public bool) (*spotify.FullPlaylist, error)
+		AddTracksToPlaylist(playlistID spotify.ID, trackIDs ...spotify.ID) (string, error)
+		Get(url string, result interface{}) error
+	}
+
+	// History writes the tracks that played to a playlist, in the background.
+	// It finds the playlist of the day by name, so a restart goes on with
+	// the same one, and leaves out plays that are already in it.
+	History struct {
+		client  HistoryBackend
+		guard   *Guard
+		date    string
+		skipped bool
+
+		plays  chan historyPlay
+		cancel context.CancelFunc
+		// closed when everything is written, or given up on
+		done chan struct{}
+	}
+
+	historyPlay struct {
+		track     spotify.FullTrack
+		startedAt time.Time
+		skipped   bool
+	}
+
+	// historyPlaylist is a playlist tracks are added to, and what's in it
+	historyPlaylist struct {
+		id   spotify.ID
+		name string
+		// when each track was last added
+		added map[spotify.ID]time.Time
+		// set when an add failed, it might have gone through anyway
+		stale bool
+	}
+)
+
+// NewHistory starts writing to the history playlists of today, creating them
+// when the first track is added. Skipped tracks are only written with skipped.
+// When the context is done, the plays that are left are still written, for a
+// while, see Close.
+func NewHistory(ctx context.Context, client HistoryBackend, guard *Guard, skipped bool) *History {
+	h := &History{
+		client:  client,
+		guard:   guard,
+		date:    time.Now().Add(-historyDayStart).Format("2006-01-02"),
+		skipped: skipped,
+		plays:   make(chan historyPlay, historyBuffer),
+		done:    make(chan struct{}),
+	}
+	ctx, h.cancel = context.WithCancel(ctx)
+	go h.run(ctx)
+	return h
+}
+
+// NewHistoryFromFlags returns a history if --history-playlist is given, and
+// nil otherwise
+func NewHistoryFromFlags(ctx context.Context, client *spotify.Client, guard *Guard) *History {
+	if !*historyFlag {
+		return nil
+	}
+	return NewHistory(ctx, client, guard, *historySkippedFlag)
+}
+
+// Played adds a track that played. It never blocks and a nil history does
+// nothing.
+func (h *History) Played(track spotify.FullTrack, startedAt time.Time, skipped bool) {
+	if h == nil || skipped && !h.skipped {
+		return
+	}
+
+	select {
+	case h.plays <- historyPlay{track: track, startedAt: startedAt, skipped: skipped}:
+	default:
+		log.Warnf("Too many tracks waiting for the history playlist, leaving out %s", track.URI)
+	}
+}
+
+// Close stops taking plays and waits until the ones that are left are written,
+// or historyDrainTimeout has passed. A nil history does nothing.
+func (h *History) Close() {
+	if h == nil {
+		return
+	}
+
+	h.cancel()
+	<-h.done
+}
+
+func (h *History) run(ctx context.Context) {
+	defer close(h.done)
+
+	// requests go on for a while after the context is done, to write the
+	// plays that are left
+	work, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		select {
+		case <-ctx.Done():
+		case <-work.Done():
+			return
+		}
+		timer := time.NewTimer(historyDrainTimeout)
+		defer timer.Stop()
+		select {
+		case <-timer.C:
+			cancel()
+		case <-work.Done():
+		}
+	}()
+
+	var played, skipped *historyPlaylist
+
+	for {
+		var play historyPlay
+		select {
+		case play = <-h.plays:
+		case <-ctx.Done():
+			select {
+			case play = <-h.plays:
+			default:
+				return
+			}
+		}
+
+		playlist := &played
+		name := "Party history " + h.date
+		description := "Everything that played at the party"
+		if play.skipped {
+			playlist = &skipped
+			name += " (skipped)"
+			description = "Everything that was skipped at the party"
+		}
+
+		if *playlist == nil {
+			p, err := h.findPlaylist(work, name, description)
+			if work.Err() != nil {
+				h.gaveUp()
+				return
+			}
+			if err != nil {
+				// turned down, try again with the next play
+				log.Errorf("Unable to find the playlist %s, leaving out %s", name, play.track.URI)
+				continue
+			}
+			*playlist = p
+		}
+
+		err := h.add(work, *playlist, play)
+		if work.Err() != nil {
+			h.gaveUp()
+			return
+		}
+		if err != nil {
+			log.Errorf("Unable to add %s to %s, leaving it out", play.track.URI, name)
+		}
+	}
+}
+
+// gaveUp logs the plays that weren't written in time, the one that was being
+// written and the ones waiting
+func (h *History) gaveUp() {
+	log.Warnf("Closed with %d tracks left to add to the history playlist", len(h.plays)+1)
+}
+
+// add adds a play to a playlist, unless the track was added after it started
+func (h *History) add(ctx context.Context, p *historyPlaylist, play historyPlay) error {
+	return h.guard.Retry(ctx, "add to history playlist", func() error {
+		if p.stale {
+			added, err := h.getAdded(p.id)
+			if err != nil {
+				return err
+			}
+			p.added = added
+			p.stale = false
+		}
+
+		// added_at is in whole seconds
+		if at, ok := p.added[play.track.ID]; ok && !at.Before(play.startedAt.Truncate(time.Second)) {
+			log.Debugf("Track %s is already in %s", play.track.URI, p.name)
+			return nil
+		}
+
+		_, err := h.client.AddTracksToPlaylist(p.id, play.track.ID)
+		if err != nil {
+			p.stale = true
+			return err
+		}
+
+		log.Debugf("Added %s to %s", play.track.URI, p.name)
+		p.added[play.track.ID] = time.Now()
+		return nil
+	})
+}
+
+// findPlaylist finds a playlist of the user by name, or creates it
+func (h *History) findPlaylist(ctx context.Context, name, description string) (*historyPlaylist, error) {
+	p := &historyPlaylist{name: name}
+
+	err := h.guard.Retry(ctx, "find history playlist", func() error {
+		user, err := h.client.CurrentUser()
+		if err != nil {
+			return err
+		}
+
+		next := currentUserPlaylistsURL
+		for next != "" {
+			page := &spotify.SimplePlaylistPage{}
+			if err := h.client.Get(next, page); err != nil {
+				return err
+			}
+			for _, playlist := range page.Playlists {
+				if playlist.Name == name && playlist.Owner.ID == user.ID {
+					p.id = playlist.ID
+					return nil
+				}
+			}
+			next = page.Next
+		}
+
+		created, err := h.client.CreatePlaylistForUser(user.ID, name, description, false)
+		if err != nil {
+			return err
+		}
+		log.Infof("Created the history playlist %s", name)
+		p.id = created.ID
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	p.stale = true
+	return p, nil
+}
+
+// getAdded returns when each track of a playlist was last added
+func (h *History) getAdded(playlistID spotify.ID) (map[spotify.ID]time.Time, error) {
+	added := make(map[spotify.ID]time.Time)
+
+	next := fmt.Sprintf(historyTracksURL, playlistID)
+	for next != "" {
+		page := &spotify.PlaylistTrackPage{}
+		if err := h.client.Get(next, page); err != nil {
+			return nil, err
+		}
+		for _, t := range page.Tracks {
+			at, err := time.Parse(spotify.TimestampLayout, t.AddedAt)
+			if err != nil {
+				continue
+			}
+			if at.After(added[t.Track.ID]) {
+				added[t.Track.ID] = at
+			}
+		}
+		next = page.Next
+	}
+	return added, nil
+}
@@ -0,0 +1,212 @@
+package spotify
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/nollbit/spotify"
+)
+
+type (
+	// testSpotify is the part of the Spotify API the history uses, served as
+	// Spotify would
+	testSpotify struct {
+		lock sync.Mutex
+		// playlist ID to name
+		playlists map[string]string
+		// playlist ID to the tracks in it, and when they were added
+		tracks map[string][]testPlaylistTrack
+	}
+
+	testPlaylistTrack struct {
+		AddedAt string `json:"added_at"`
+		Track   struct {
+			ID string `json:"id"`
+		} `json:"track"`
+	}
+)
+
+// do sends a request to the fake Spotify and decodes the answer in to result
+func (s *testSpotify) do(method, url string, body, result interface{}) error {
+	var buf bytes.Buffer
+	if body != nil {
+		json.NewEncoder(&buf).Encode(body)
+	}
+	w := httptest.NewRecorder()
+	s.ServeHTTP(w, httptest.NewRequest(method, url, &buf))
+
+	if w.Code >= 300 {
+		return spotify.Error{Status: w.Code, Message: strings.TrimSpace(w.Body.String())}
+	}
+	return json.NewDecoder(w.Body).Decode(result)
+}
+
+func (s *testSpotify) CurrentUser() (*spotify.PrivateUser, error) {
+	user := &spotify.PrivateUser{}
+	return user, s.do("GET", "https://api.spotify.com/v1/me", nil, user)
+}
+
+func (s *testSpotify) CreatePlaylistForUser(userID, playlistName, description string, public bool) (*spotify.FullPlaylist, error) {
+	playlist := &spotify.FullPlaylist{}
+	body := map[string]interface{}{"name": playlistName, "description": description, "public": public}
+	return playlist, s.do("POST", "https://api.spotify.com/v1/users/"+userID+"/playlists", body, playlist)
+}
+
+func (s *testSpotify) AddTracksToPlaylist(playlistID spotify.ID, trackIDs ...spotify.ID) (string, error) {
+	uris := make([]string, 0, len(trackIDs))
+	for _, id := range trackIDs {
+		uris = append(uris, "spotify:track:"+string(id))
+	}
+	result := struct {
+		SnapshotID string `json:"snapshot_id"`
+	}{}
+	err := s.do("POST", "https://api.spotify.com/v1/playlists/"+string(playlistID)+"/tracks", map[string][]string{"uris": uris}, &result)
+	return result.SnapshotID, err
+}
+
+func (s *testSpotify) Get(url string, result interface{}) error {
+	return s.do("GET", url, nil, result)
+}
+
+func (s *testSpotify) add(playlistID, trackID string, at time.Time) {
+	pt := testPlaylistTrack{AddedAt: at.UTC().Format(spotify.TimestampLayout)}
+	pt.Track.ID = trackID
+	s.tracks[playlistID] = append(s.tracks[playlistID], pt)
+}
+
+// added lists the tracks of a playlist, in the order they were added
+func (s *testSpotify) added(playlistID string) []string {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	ids := make([]string, 0)
+	for _, pt := range s.tracks[playlistID] {
+		ids = append(ids, pt.Track.ID)
+	}
+	return ids
+}
+
+func (s *testSpotify) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	path := strings.TrimPrefix(r.URL.Path, "/v1")
+	parts := strings.Split(strings.Trim(path, "/"), "/")
+
+	switch {
+	case r.Method == "GET" && path == "/me":
+		json.NewEncoder(w).Encode(map[string]string{"id": "rickard"})
+
+	case r.Method == "GET" && path == "/me/playlists":
+		items := make([]map[string]interface{}, 0)
+		for id, name := range s.playlists {
+			items = append(items, map[string]interface{}{"id": id, "name": name, "owner": map[string]string{"id": "rickard"}})
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{"items": items})
+
+	case r.Method == "POST" && path == "/users/rickard/playlists":
+		var body struct {
+			Name string `json:"name"`
+		}
+		json.NewDecoder(r.Body).Decode(&body)
+		id := fmt.Sprintf("created%d", len(s.playlists))
+		s.playlists[id] = body.Name
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(map[string]string{"id": id, "name": body.Name})
+
+	case r.Method == "GET" && len(parts) == 3 && parts[0] == "playlists" && parts[2] == "tracks":
+		json.NewEncoder(w).Encode(map[string]interface{}{"items": s.tracks[parts[1]]})
+
+	case r.Method == "POST" && len(parts) == 3 && parts[0] == "playlists" && parts[2] == "tracks":
+		var body struct {
+			URIs []string `json:"uris"`
+		}
+		json.NewDecoder(r.Body).Decode(&body)
+		for _, uri := range body.URIs {
+			s.add(parts[1], strings.TrimPrefix(uri, "spotify:track:"), time.Now())
+		}
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(map[string]string{"snapshot_id": "snapshot"})
+
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func TestHistory(t *testing.T) {
+	addedAt := time.Now().Add(-time.Hour).Truncate(time.Second)
+	fake := &testSpotify{
+		playlists: map[string]string{"history": "Party history 2019-03-01", "old": "Party history 2019-02-28"},
+		tracks:    make(map[string][]testPlaylistTrack),
+	}
+	fake.add("history", "waterloo", addedAt)
+
+	h := NewHistory(context.Background(), fake, NewGuard(), true)
+	h.date = "2019-03-01"
+
+	waterloo := testTrack("spotify:track:waterloo", 180)
+	sos := testTrack("spotify:track:sos", 200)
+	// already in the playlist from before a restart
+	h.Played(waterloo, addedAt.Add(-3*time.Minute), false)
+	h.Played(sos, time.Now().Add(-time.Minute), false)
+	// the same play again
+	h.Played(sos, time.Now().Add(-time.Minute), false)
+	// played again later
+	h.Played(waterloo, time.Now(), false)
+	h.Played(sos, time.Now(), true)
+	h.Close()
+
+	if got, want := fake.added("history"), []string{"waterloo", "sos", "waterloo"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("the history playlist has %v, want %v", got, want)
+	}
+	if got := fake.added("old"); len(got) != 0 {
+		t.Errorf("the history of another day got %v", got)
+	}
+
+	fake.lock.Lock()
+	skipped := ""
+	for id, name := range fake.playlists {
+		if name == "Party history 2019-03-01 (skipped)" {
+			skipped = id
+		}
+	}
+	fake.lock.Unlock()
+	if skipped == "" {
+		t.Fatal("no playlist was created for skipped tracks")
+	}
+	if got, want := fake.added(skipped), []string{"sos"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("the skipped playlist has %v, want %v", got, want)
+	}
+}
+
+func TestHistoryCloseWritesWhatsLeft(t *testing.T) {
+	fake := &testSpotify{
+		playlists: map[string]string{"history": "Party history 2019-03-01"},
+		tracks:    make(map[string][]testPlaylistTrack),
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	h := NewHistory(ctx, fake, NewGuard(), false)
+	h.date = "2019-03-01"
+
+	for _, id := range []string{"waterloo", "sos", "mamma_mia"} {
+		h.Played(testTrack("spotify:track:"+id, 180), time.Now(), false)
+	}
+	// skipped tracks are left out without skipped
+	h.Played(testTrack("spotify:track:fernando", 180), time.Now(), true)
+	cancel()
+	h.Close()
+
+	if got, want := fake.added("history"), []string{"waterloo", "sos", "mamma_mia"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("the history playlist has %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,423 @@
+package spotify
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/nollbit/spotify"
+	log "github.com/sirupsen/logrus"
+	"gopkg.in/alecthomas/kingpin.v2"
+)
+
+var (
+	sourcesFlag = kingpin.Flag("source", "Add the tracks of a playlist, an album or an artist's top tracks, given as a Spotify URI or link. Can be given several times.").Strings()
+)
+
+// the playlist used when no sources are given
+const defaultCuratedPlaylistID = "5qpgQ7n2oPEw71GrLLnt85"
+
+const (
+	SourcePlaylist SourceKind = "playlist"
+	SourceAlbum    SourceKind = "album"
+	SourceArtist   SourceKind = "artist"
+)
+
+const (
+	albumURL           = "https://api.spotify.com/v1/albums/%s?market=from_token"
+	tracksURL          = "https://api.spotify.com/v1/tracks?ids=%s&market=from_token"
+	artistURL          = "https://api.spotify.com/v1/artists/%s"
+	artistTopTracksURL = "https://api.spotify.com/v1/artists/%s/top-tracks?market=from_token"
+
+	// how many tracks can be asked for at once
+	tracksPerRequest = 50
+	// albums and top tracks don't change much
+	sourceRefreshInterval = time.Hour
+)
+
+var (
+	ErrorUnknownSource = errors.New("Not a Spotify playlist, album or artist")
+)
+
+type (
+	// SourceKind is what kind of thing tracks are taken from
+	SourceKind string
+
+	// Source is a playlist, an album or an artist whose top tracks are added
+	// to the library
+	Source struct {
+		Kind SourceKind
+		ID   spotify.ID
+	}
+
+	// sourceTracks is the latest version of the tracks of a source
+	sourceTracks struct {
+		index int
+		name  string
+		// changes when the tracks change
+		version string
+		items   []playlistItem
+	}
+
+	albumTrackPage struct {
+		Items []struct {
+			ID spotify.ID `json:"id"`
+		} `json:"items"`
+		Next string `json:"next"`
+	}
+
+	namedAlbum struct {
+		Name   string         `json:"name"`
+		Tracks albumTrackPage `json:"tracks"`
+	}
+
+	trackList struct {
+		Tracks []*playableItem `json:"tracks"`
+	}
+)
+
+func (s Source) String() string {
+	return fmt.Sprintf("spotify:%s:%s", s.Kind, s.ID)
+}
+
+// ParseSource reads a Spotify URI, i.e. spotify:album:1234, or a link, i.e.
+// https://open.spotify.com/playlist/1234. A plain ID is taken to be a playlist.
+func ParseSource(s string) (Source, error) {
+	s = strings.TrimSpace(s)
+
+	var parts []string
+	if u, err := url.Parse(s); err == nil && u.Host != "" {
+		parts = strings.Split(strings.Trim(u.Path, "/"), "/")
+	} else if strings.HasPrefix(s, "spotify:") {
+		parts = strings.Split(strings.TrimPrefix(s, "spotify:"), ":")
+	} else if s != "" && !strings.ContainsAny(s, ":/") {
+		return Source{Kind: SourcePlaylist, ID: spotify.ID(s)}, nil
+	}
+
+	// the last kind and ID pair wins, old playlist URIs start with the user
+	for i := len(parts) - 2; i >= 0; i-- {
+		kind := SourceKind(parts[i])
+		if kind == SourcePlaylist || kind == SourceAlbum || kind == SourceArtist {
+			if parts[i+1] == "" {
+				break
+			}
+			return Source{Kind: kind, ID: spotify.ID(parts[i+1])}, nil
+		}
+	}
+
+	return Source{}, fmt.Errorf("Unable to parse source %s: %v", s, ErrorUnknownSource)
+}
+
+// SourcesFromFlags returns the sources given by --spotify-curated-playlist and
+// --source. Without either, the default playlist is used.
+func SourcesFromFlags() ([]Source, error) {
+	sources := make([]Source, 0, len(*sourcesFlag)+1)
+	if *SpotifyCuratedPlaylistID != "" {
+		sources = append(sources, Source{Kind: SourcePlaylist, ID: spotify.ID(*SpotifyCuratedPlaylistID)})
+	}
+
+	for _, s := range *sourcesFlag {
+		source, err := ParseSource(s)
+		if err != nil {
+			return nil, err
+		}
+		sources = append(sources, source)
+	}
+
+	if len(sources) == 0 {
+		sources = append(sources, Source{Kind: SourcePlaylist, ID: defaultCuratedPlaylistID})
+	}
+	return sources, nil
+}
+
+// NewCuratedLibrary keeps the tracks of several sources up to date, until the
+// context is done. A track in more than one source is only listed once, going
+// by its ISRC, and gets the names of all the sources it's in. Tracks that can't
+// be played are left out, see CuratedOptions.
+func NewCuratedLibrary(ctx context.Context, spotifyClient *spotify.Client, guard *Guard, sources []Source, opts CuratedOptions) (*CuratedPlaylist, error) {
+	if len(sources) == 0 {
+		return nil, ErrorUnknownSource
+	}
+
+	updates := make(chan sourceTracks)
+	for i, source := range sources {
+		log.Debugf("Adding source %s", source)
+
+		var err error
+		switch source.Kind {
+		case SourcePlaylist:
+			err = watchPlaylistSource(ctx, spotifyClient, guard, i, source.ID, updates)
+		default:
+			go refreshSource(ctx, spotifyClient, guard, i, source, updates)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	c := NewFixedCuratedPlaylist(sources[0].ID)
+	c.features = opts.Features
+
+	go func() {
+		latest := make([]*sourceTracks, len(sources))
+		for {
+			select {
+			case update := <-updates:
+				latest[update.index] = &update
+			case <-ctx.Done():
+				return
+			}
+
+			tracks, trackSources, report := mergeSources(latest, opts)
+			log.Infof("Curated library: %s", report)
+			for _, e := range report.Excluded {
+				log.Debugf("Left out %s %q: %s", e.URI, e.Name, e.Reason)
+			}
+			opts.save(report)
+
+			opts.Features.Fetch(spotifyClient, guard, tracks)
+
+			c.SetTracks(tracks)
+			c.sources = trackSources
+
+			versions := make([]string, 0, len(latest))
+			for _, l := range latest {
+				if l != nil {
+					versions = append(versions, l.version)
+				}
+			}
+			select {
+			case c.Changes <- strings.Join(versions, ","):
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	return c, nil
+}
+
+// mergeSources puts the tracks of every source that has been loaded together
+func mergeSources(latest []*sourceTracks, opts CuratedOptions) ([]spotify.FullTrack, map[spotify.ID][]string, CuratedReport) {
+	tracks := make([]spotify.FullTrack, 0)
+	trackSources := make(map[spotify.ID][]string)
+	report := CuratedReport{Excluded: make([]ExcludedTrack, 0)}
+	// the ID of the first version of each track
+	seen := make(map[string]spotify.ID)
+
+	for _, source := range latest {
+		if source == nil {
+			continue
+		}
+
+		playable, sourceReport := opts.filter(source.items)
+		report.Excluded = append(report.Excluded, sourceReport.Excluded...)
+
+		for _, track := range playable {
+			key := trackKey(track)
+			if id, ok := seen[key]; ok {
+				if !hasSource(trackSources[id], source.name) {
+					trackSources[id] = append(trackSources[id], source.name)
+				}
+				continue
+			}
+
+			seen[key] = track.ID
+			trackSources[track.ID] = []string{source.name}
+			tracks = append(tracks, track)
+		}
+	}
+
+	report.Included = len(tracks)
+	return tracks, trackSources, report
+}
+
+// trackKey is the same for every version of a recording, i.e. the single and
+// the album version
+func trackKey(track spotify.FullTrack) string {
+	if isrc := track.ExternalIDs["isrc"]; isrc != "" {
+		return "isrc:" + strings.ToUpper(isrc)
+	}
+	return "id:" + string(track.ID)
+}
+
+func hasSource(sources []string, name string) bool {
+	for _, s := range sources {
+		if s == name {
+			return true
+		}
+	}
+	return false
+}
+
+// watchPlaylistSource sends the tracks of a playlist every time it changes
+func watchPlaylistSource(ctx context.Context, client *spotify.Client, guard *Guard, index int, playlistID spotify.ID, updates chan sourceTracks) error {
+	changes := make(chan *spotify.FullPlaylist)
+	err := WatchPlaylist(ctx, client, guard, playlistID, changes)
+	if err != nil {
+		log.WithError(err).Error("Unable to watch playlist")
+		return err
+	}
+
+	go func() {
+		for {
+			var playlist *spotify.FullPlaylist
+			select {
+			case playlist = <-changes:
+			case <-ctx.Done():
+				return
+			}
+
+			// the tracks of the playlist we got don't say if they're playable,
+			// so get them again for the user's market
+			items := make([]playlistItem, 0, playlist.Tracks.Total)
+			next := fmt.Sprintf(playlistTracksURL, playlistID)
+			for next != "" {
+				page := &playlistItemPage{}
+				// half a playlist is worse than waiting for the rest
+				err := guard.Retry(ctx, "get playlist tracks", func() error {
+					return client.Get(next, page)
+				})
+				if ctx.Err() != nil {
+					return
+				}
+				if err != nil {
+					// turned down, wait for the next change
+					items = nil
+					break
+				}
+
+				log.Debugf("Adding %d tracks from page", len(page.Items))
+				items = append(items, page.Items...)
+				next = page.Next
+			}
+
+			if items == nil {
+				continue
+			}
+			update := sourceTracks{index: index, name: playlist.Name, version: playlist.SnapshotID, items: items}
+			select {
+			case updates <- update:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	return nil
+}
+
+// refreshSource sends the tracks of an album or an artist, and again every
+// now and then
+func refreshSource(ctx context.Context, client *spotify.Client, guard *Guard, index int, source Source, updates chan sourceTracks) {
+	for {
+		var update sourceTracks
+		var err error
+		switch source.Kind {
+		case SourceAlbum:
+			update, err = getAlbumSource(ctx, client, guard, source.ID)
+		case SourceArtist:
+			update, err = getArtistSource(ctx, client, guard, source.ID)
+		}
+		if err != nil {
+			if ctx.Err() == nil {
+				log.WithError(err).Errorf("Unable to get the tracks of %s", source)
+			}
+			return
+		}
+
+		update.index = index
+		update.version = fmt.Sprintf("%s@%d", source, time.Now().Unix())
+		select {
+		case updates <- update:
+		case <-ctx.Done():
+			return
+		}
+
+		if !sleep(ctx, sourceRefreshInterval) {
+			return
+		}
+	}
+}
+
+func getAlbumSource(ctx context.Context, client *spotify.Client, guard *Guard, albumID spotify.ID) (sourceTracks, error) {
+	album := &namedAlbum{}
+	err := guard.Retry(ctx, "get album", func() error {
+		return client.Get(fmt.Sprintf(albumURL, albumID), album)
+	})
+	if err != nil {
+		return sourceTracks{}, err
+	}
+
+	ids := make([]string, 0, len(album.Tracks.Items))
+	for _, t := range album.Tracks.Items {
+		ids = append(ids, string(t.ID))
+	}
+	next := album.Tracks.Next
+	for next != "" {
+		page := &albumTrackPage{}
+		err := guard.Retry(ctx, "get album tracks", func() error {
+			return client.Get(next, page)
+		})
+		if err != nil {
+			return sourceTracks{}, err
+		}
+		for _, t := range page.Items {
+			ids = append(ids, string(t.ID))
+		}
+		next = page.Next
+	}
+
+	// the album only has the simple tracks, without album and popularity
+	items := make([]playlistItem, 0, len(ids))
+	for len(ids) > 0 {
+		n := len(ids)
+		if n > tracksPerRequest {
+			n = tracksPerRequest
+		}
+
+		list := &trackList{}
+		err := guard.Retry(ctx, "get album tracks", func() error {
+			return client.Get(fmt.Sprintf(tracksURL, strings.Join(ids[:n], ",")), list)
+		})
+		if err != nil {
+			return sourceTracks{}, err
+		}
+		for _, t := range list.Tracks {
+			items = append(items, playlistItem{Track: t})
+		}
+		ids = ids[n:]
+	}
+
+	return sourceTracks{name: album.Name, items: items}, nil
+}
+
+func getArtistSource(ctx context.Context, client *spotify.Client, guard *Guard, artistID spotify.ID) (sourceTracks, error) {
+	artist := &struct {
+		Name string `json:"name"`
+	}{}
+	err := guard.Retry(ctx, "get artist", func() error {
+		return client.Get(fmt.Sprintf(artistURL, artistID), artist)
+	})
+	if err != nil {
+		return sourceTracks{}, err
+	}
+
+	list := &trackList{}
+	err = guard.Retry(ctx, "get top tracks", func() error {
+		return client.Get(fmt.Sprintf(artistTopTracksURL, artistID), list)
+	})
+	if err != nil {
+		return sourceTracks{}, err
+	}
+
+	items := make([]playlistItem, 0, len(list.Tracks))
+	for _, t := range list.Tracks {
+		items = append(items, playlistItem{Track: t})
+	}
+
+	return sourceTracks{name: artist.Name, items: items}, nil
+}
@@ -0,0 +1,85 @@
+package spotify
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/nollbit/spotify"
+)
+
+func TestParseSource(t *testing.T) {
+	tests := []struct {
+		s    string
+		want Source
+	}{
+		{"spotify:playlist:5qpgQ7n2oPEw71GrLLnt85", Source{SourcePlaylist, "5qpgQ7n2oPEw71GrLLnt85"}},
+		{"spotify:user:nollbit:playlist:5qpgQ7n2oPEw71GrLLnt85", Source{SourcePlaylist, "5qpgQ7n2oPEw71GrLLnt85"}},
+		{"spotify:album:1M4anG49aEs4YimBdj96Oy", Source{SourceAlbum, "1M4anG49aEs4YimBdj96Oy"}},
+		{"https://open.spotify.com/artist/0LcJLqbBmaGUft1e9Mm8HV?si=abc", Source{SourceArtist, "0LcJLqbBmaGUft1e9Mm8HV"}},
+		{" https://open.spotify.com/playlist/5qpgQ7n2oPEw71GrLLnt85 ", Source{SourcePlaylist, "5qpgQ7n2oPEw71GrLLnt85"}},
+		{"5qpgQ7n2oPEw71GrLLnt85", Source{SourcePlaylist, "5qpgQ7n2oPEw71GrLLnt85"}},
+	}
+
+	for _, tt := range tests {
+		got, err := ParseSource(tt.s)
+		if err != nil || got != tt.want {
+			t.Errorf("ParseSource(%q) = %v, %v, want %v", tt.s, got, err, tt.want)
+		}
+	}
+
+	for _, s := range []string{"", "spotify:track:2ATDkfqprlNNe9mYWodgdc", "spotify:album:", "https://example.com/", "a:b"} {
+		if got, err := ParseSource(s); err == nil {
+			t.Errorf("ParseSource(%q) = %v, want an error", s, got)
+		}
+	}
+}
+
+func TestMergeSources(t *testing.T) {
+	isrc := func(uri, code string) playlistItem {
+		return testPlaylistItem(uri, func(i *playableItem) {
+			i.ExternalIDs = map[string]string{"isrc": code}
+		})
+	}
+	no := false
+
+	latest := []*sourceTracks{
+		{name: "Party", items: []playlistItem{
+			isrc("spotify:track:single", "SEAYD7601010"),
+			testPlaylistItem("spotify:track:noisrc", nil),
+			testPlaylistItem("spotify:track:gone", func(i *playableItem) { i.IsPlayable = &no }),
+		}},
+		// not loaded yet
+		nil,
+		{name: "Arrival", items: []playlistItem{
+			isrc("spotify:track:album", "seayd7601010"),
+			isrc("spotify:track:other", "SEAYD7601020"),
+			testPlaylistItem("spotify:track:noisrc", nil),
+		}},
+		{name: "Party", items: []playlistItem{
+			isrc("spotify:track:album", "SEAYD7601010"),
+		}},
+	}
+
+	tracks, sources, report := mergeSources(latest, CuratedOptions{})
+
+	ids := make([]spotify.ID, 0, len(tracks))
+	for _, track := range tracks {
+		ids = append(ids, track.ID)
+	}
+	if want := []spotify.ID{"single", "noisrc", "other"}; !reflect.DeepEqual(ids, want) {
+		t.Errorf("got tracks %v, want %v", ids, want)
+	}
+
+	want := map[spotify.ID][]string{
+		"single": {"Party", "Arrival"},
+		"noisrc": {"Party", "Arrival"},
+		"other":  {"Arrival"},
+	}
+	if !reflect.DeepEqual(sources, want) {
+		t.Errorf("got sources %v, want %v", sources, want)
+	}
+
+	if report.Included != 3 || len(report.Excluded) != 1 || report.Excluded[0].URI != "spotify:track:gone" {
+		t.Errorf("got report %+v", report)
+	}
+}
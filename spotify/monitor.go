@@ -0,0 +1,152 @@
+package spotify
+
+import (
+	"strings"
+	"time"
+
+	"github.com/nollbit/spotify"
+)
+
+const (
+	// how often to check that the track is still playing, mostly to notice if
+	// someone else took over the device or paused it
+	monitorCheckInterval = 30 * time.Second
+	// one last check this long before the end, to correct for drift
+	monitorNearEndCheck = 5 * time.Second
+	// when there's no next track, check this long after the expected end
+	monitorEndGrace = 500 * time.Millisecond
+	// start the next track this long before the current one ends, about as long
+	// as the request takes, so there's no gap and Spotify doesn't get to start
+	// something on its own
+	monitorHandoverLead = 300 * time.Millisecond
+	// how often to check if a track has started
+	monitorStartInterval = 500 * time.Millisecond
+)
+
+// playbackMonitor keeps track of where a track is without asking Spotify all
+// the time. The end of the track is worked out from the progress of the latest
+// poll, and Spotify is only asked again when it's time for a check.
+type playbackMonitor struct {
+	track *spotify.FullTrack
+	// how much faster than real time the track plays, only the fake backend
+	// plays at anything but 1
+	rate float64
+	// the device it started on, playback moving elsewhere means someone else took over
+	device spotify.ID
+	// the album or playlist it started from, empty for tracks the player started
+	context spotify.URI
+	// progress in milliseconds at the latest poll
+	progress  int
+	polled    time.Time
+	nextCheck time.Time
+}
+
+// playbackResult is what a poll says about the monitored track
+type playbackResult int
+
+const (
+	// the track is still playing
+	playbackPlaying playbackResult = iota
+	// nothing is playing, the track has ended or someone paused it
+	playbackStopped
+	// something else is playing, or it's playing somewhere else. Spotify's
+	// autoplay or someone else.
+	playbackTakenOver
+)
+
+func newPlaybackMonitor(track *spotify.FullTrack, rate float64) *playbackMonitor {
+	if rate <= 0 {
+		rate = 1
+	}
+	return &playbackMonitor{track: track, rate: rate}
+}
+
+// started tells if a poll shows the track playing, and remembers where
+func (m *playbackMonitor) started(state *spotify.PlayerState) bool {
+	if !state.Playing || state.Item == nil || !sameTrack(state.Item, m.track) {
+		return false
+	}
+	m.device = state.Device.ID
+	m.context = state.PlaybackContext.URI
+	return true
+}
+
+// update takes the result of a poll and schedules the next check
+func (m *playbackMonitor) update(state *spotify.PlayerState, now time.Time) playbackResult {
+	cp := state.CurrentlyPlaying
+	if !cp.Playing || cp.Item == nil {
+		return playbackStopped
+	}
+	// tracks are played by URI, so there's only a context when someone else
+	// started it from an album or a playlist. An adopted track keeps the one
+	// it started with.
+	if !sameTrack(cp.Item, m.track) || cp.PlaybackContext.URI != m.context {
+		return playbackTakenOver
+	}
+	if m.device != "" && state.Device.ID != "" && state.Device.ID != m.device {
+		return playbackTakenOver
+	}
+
+	m.progress = cp.Progress
+	m.polled = now
+
+	end := m.endsAt()
+	switch {
+	case now.Add(monitorCheckInterval).Before(end.Add(-monitorNearEndCheck)):
+		m.nextCheck = now.Add(monitorCheckInterval)
+	case now.Before(end.Add(-monitorNearEndCheck)):
+		m.nextCheck = end.Add(-monitorNearEndCheck)
+	default:
+		m.nextCheck = end.Add(monitorEndGrace)
+	}
+
+	return playbackPlaying
+}
+
+// endsAt is when the track is expected to end
+func (m *playbackMonitor) endsAt() time.Time {
+	left := float64(m.track.Duration-m.progress) / m.rate
+	return m.polled.Add(time.Duration(left) * time.Millisecond)
+}
+
+// position is how far in to the track it's expected to be, in milliseconds
+func (m *playbackMonitor) position(now time.Time) int {
+	return m.track.Duration - int(float64(m.remaining(now)/time.Millisecond)*m.rate)
+}
+
+// remaining is how much is left of the track, never less than 0
+func (m *playbackMonitor) remaining(now time.Time) time.Duration {
+	remaining := m.endsAt().Sub(now)
+	if remaining < 0 {
+		return 0
+	}
+	return remaining
+}
+
+// autoplayed tells if something else playing is just Spotify carrying on
+// after the track ended, rather than someone taking over
+func (m *playbackMonitor) autoplayed(state *spotify.PlayerState, now time.Time) bool {
+	return m.remaining(now) <= monitorEndGrace && (m.device == "" || state.Device.ID == m.device)
+}
+
+// needsCheck tells if it's time to ask Spotify again
+func (m *playbackMonitor) needsCheck(now time.Time) bool {
+	return !now.Before(m.nextCheck)
+}
+
+// readyForHandover tells if it's time to start the next track
+func (m *playbackMonitor) readyForHandover(now time.Time) bool {
+	return m.remaining(now) <= monitorHandoverLead
+}
+
+// sameTrack compares tracks by ID, or by name and artist for when Spotify
+// plays another version of the same track in the user's market
+func sameTrack(a, b *spotify.FullTrack) bool {
+	if a.ID == b.ID {
+		return true
+	}
+	if len(a.Artists) == 0 || len(b.Artists) == 0 {
+		return false
+	}
+	return strings.EqualFold(a.Name, b.Name) && strings.EqualFold(a.Artists[0].Name, b.Artists[0].Name)
+}
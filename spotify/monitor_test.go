@@ -0,0 +1,135 @@
+package spotify
+
+import (
+	"testing"
+	"time"
+
+	"github.com/nollbit/spotify"
+)
+
+func testPlayerState(track *spotify.FullTrack, device spotify.ID, progress int) *spotify.PlayerState {
+	state := &spotify.PlayerState{Device: spotify.PlayerDevice{ID: device}}
+	if track != nil {
+		state.Item = track
+		state.Playing = true
+		state.Progress = progress
+	}
+	return state
+}
+
+func TestPlaybackMonitorUpdate(t *testing.T) {
+	track := testTrack("spotify:track:queued1", 200)
+	other := testTrack("spotify:track:other", 200)
+	now := time.Date(2019, 3, 1, 22, 0, 0, 0, time.UTC)
+
+	inContext := testPlayerState(&track, "speaker", 10000)
+	inContext.PlaybackContext.URI = "spotify:album:abba"
+
+	tests := []struct {
+		name   string
+		state  *spotify.PlayerState
+		result playbackResult
+		// when to check again, from now
+		nextCheck time.Duration
+	}{
+		{"far from the end", testPlayerState(&track, "speaker", 10000), playbackPlaying, monitorCheckInterval},
+		{"close to the end", testPlayerState(&track, "speaker", 170000), playbackPlaying, 25 * time.Second},
+		{"at the end", testPlayerState(&track, "speaker", 197000), playbackPlaying, 3*time.Second + monitorEndGrace},
+		{"stopped", testPlayerState(nil, "speaker", 0), playbackStopped, 0},
+		{"other track", testPlayerState(&other, "speaker", 10000), playbackTakenOver, 0},
+		{"other device", testPlayerState(&track, "phone", 10000), playbackTakenOver, 0},
+		{"from an album", inContext, playbackTakenOver, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := newPlaybackMonitor(&track, 1)
+			if !m.started(testPlayerState(&track, "speaker", 0)) {
+				t.Fatal("the track didn't start")
+			}
+
+			if got := m.update(tt.state, now); got != tt.result {
+				t.Fatalf("update() = %d, want %d", got, tt.result)
+			}
+			if tt.result == playbackPlaying && m.nextCheck != now.Add(tt.nextCheck) {
+				t.Errorf("next check in %s, want %s", m.nextCheck.Sub(now), tt.nextCheck)
+			}
+		})
+	}
+}
+
+func TestPlaybackMonitorRate(t *testing.T) {
+	track := testTrack("spotify:track:queued1", 200)
+	now := time.Date(2019, 3, 1, 22, 0, 0, 0, time.UTC)
+
+	m := newPlaybackMonitor(&track, 10)
+	m.update(testPlayerState(&track, "fake", 100000), now)
+
+	if got := m.remaining(now); got != 10*time.Second {
+		t.Errorf("remaining() = %s, want 10s", got)
+	}
+	if got := m.position(now.Add(5 * time.Second)); got != 150000 {
+		t.Errorf("position() = %d, want 150000", got)
+	}
+	if got := m.remaining(now.Add(time.Minute)); got != 0 {
+		t.Errorf("remaining() = %s after the end", got)
+	}
+}
+
+func TestPlaybackMonitorEnd(t *testing.T) {
+	track := testTrack("spotify:track:queued1", 200)
+	autoplay := testTrack("spotify:track:autoplay", 200)
+	now := time.Date(2019, 3, 1, 22, 0, 0, 0, time.UTC)
+
+	m := newPlaybackMonitor(&track, 1)
+	m.started(testPlayerState(&track, "speaker", 0))
+	m.update(testPlayerState(&track, "speaker", 190000), now)
+
+	tests := []struct {
+		name       string
+		at         time.Duration
+		device     spotify.ID
+		handover   bool
+		autoplayed bool
+	}{
+		{"playing", 5 * time.Second, "speaker", false, false},
+		{"a second before the end", 9 * time.Second, "speaker", false, false},
+		{"handing over", 10*time.Second - monitorHandoverLead, "speaker", true, true},
+		{"at the end", 10 * time.Second, "speaker", true, true},
+		{"at the end elsewhere", 10 * time.Second, "phone", true, false},
+	}
+
+	for _, tt := range tests {
+		at := now.Add(tt.at)
+		if got := m.readyForHandover(at); got != tt.handover {
+			t.Errorf("%s: readyForHandover() = %v, want %v", tt.name, got, tt.handover)
+		}
+		if got := m.autoplayed(testPlayerState(&autoplay, tt.device, 1000), at); got != tt.autoplayed {
+			t.Errorf("%s: autoplayed() = %v, want %v", tt.name, got, tt.autoplayed)
+		}
+	}
+}
+
+func TestSameTrack(t *testing.T) {
+	abba := []spotify.SimpleArtist{{Name: "ABBA"}}
+	track := spotify.FullTrack{SimpleTrack: spotify.SimpleTrack{ID: "1", Name: "Dancing Queen", Artists: abba}}
+
+	tests := []struct {
+		name  string
+		other spotify.SimpleTrack
+		same  bool
+	}{
+		{"same id", spotify.SimpleTrack{ID: "1"}, true},
+		{"relinked", spotify.SimpleTrack{ID: "2", Name: "dancing queen", Artists: []spotify.SimpleArtist{{Name: "Abba"}}}, true},
+		{"other artist", spotify.SimpleTrack{ID: "2", Name: "Dancing Queen", Artists: []spotify.SimpleArtist{{Name: "A*Teens"}}}, false},
+		{"no artist", spotify.SimpleTrack{ID: "2", Name: "Dancing Queen"}, false},
+		{"other track", spotify.SimpleTrack{ID: "2", Name: "Waterloo", Artists: abba}, false},
+	}
+
+	for _, tt := range tests {
+		other := spotify.FullTrack{SimpleTrack: tt.other}
+		if got := sameTrack(&track, &other); got != tt.same {
+			t.Errorf("%s: sameTrack() = %v, want %v", tt.name, got, tt.same)
+		}
+	}
+}
@@ -0,0 +1,183 @@
+package spotify
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/nollbit/spotify"
+	log "github.com/sirupsen/logrus"
+	"gopkg.in/alecthomas/kingpin.v2"
+)
+
+var (
+	curatedSkipExplicitFlag = kingpin.Flag("curated-skip-explicit", "Leave out tracks with explicit lyrics").Bool()
+	curatedReportFlag       = kingpin.Flag("curated-report", "Write the tracks that were left out of the curated playlist, and why, to this file").String()
+)
+
+// the playlist items, with Spotify relinking tracks for the user's market
+const playlistTracksURL = "https://api.spotify.com/v1/playlists/%s/tracks?market=from_token&limit=100"
+
+type (
+	// CuratedOptions decide which tracks of the curated playlist are left out,
+	// and what else to find out about them
+	CuratedOptions struct {
+		// leave out tracks with explicit lyrics
+		SkipExplicit bool
+		// write the report here every time the playlist changes, if set
+		ReportPath string
+		// audio features are fetched for the tracks when set
+		Features *FeatureCache
+	}
+
+	// CuratedReport lists what was left out of the curated playlist
+	CuratedReport struct {
+		Included int
+		Excluded []ExcludedTrack
+	}
+
+	// ExcludedTrack is an item of the playlist that can't be played
+	ExcludedTrack struct {
+		Name   string
+		URI    spotify.URI
+		Reason string
+	}
+
+	// playlistItem is a playlist item as Spotify sends it with a market. The
+	// client doesn't know about playability, local files or episodes.
+	playlistItem struct {
+		IsLocal bool          `json:"is_local"`
+		Track   *playableItem `json:"track"`
+	}
+
+	playableItem struct {
+		spotify.FullTrack
+		// "track" or "episode"
+		Type string `json:"type"`
+		// only set when a market is given
+		IsPlayable   *bool `json:"is_playable"`
+		Restrictions struct {
+			Reason string `json:"reason"`
+		} `json:"restrictions"`
+	}
+
+	playlistItemPage struct {
+		Items []playlistItem `json:"items"`
+		Next  string         `json:"next"`
+	}
+)
+
+// CuratedOptionsFromFlags returns the options given by --curated-skip-explicit
+// and --curated-report
+func CuratedOptionsFromFlags() CuratedOptions {
+	return CuratedOptions{
+		SkipExplicit: *curatedSkipExplicitFlag,
+		ReportPath:   *curatedReportFlag,
+	}
+}
+
+// check returns why an item can't be in the curated playlist, or "" if it can
+func (o CuratedOptions) check(item playlistItem) string {
+	t := item.Track
+	switch {
+	case t == nil || t.ID == "" && !item.IsLocal:
+		return "removed from Spotify"
+	case item.IsLocal:
+		return "local file"
+	case t.Type != "" && t.Type != "track":
+		return fmt.Sprintf("not a track (%s)", t.Type)
+	case t.IsPlayable != nil && !*t.IsPlayable:
+		if t.Restrictions.Reason != "" {
+			return fmt.Sprintf("not playable (%s)", t.Restrictions.Reason)
+		}
+		return "not playable in this market"
+	case o.SkipExplicit && t.Explicit:
+		return "explicit"
+	}
+	return ""
+}
+
+// filter splits items in to playable tracks and a report of the rest
+func (o CuratedOptions) filter(items []playlistItem) ([]spotify.FullTrack, CuratedReport) {
+	tracks := make([]spotify.FullTrack, 0, len(items))
+	report := CuratedReport{Excluded: make([]ExcludedTrack, 0)}
+
+	for _, item := range items {
+		if reason := o.check(item); reason != "" {
+			excluded := ExcludedTrack{Reason: reason}
+			if t := item.Track; t != nil {
+				excluded.Name = t.Name
+				if len(t.Artists) > 0 {
+					excluded.Name = t.Artists[0].Name + " - " + t.Name
+				}
+				excluded.URI = t.URI
+			}
+			report.Excluded = append(report.Excluded, excluded)
+			continue
+		}
+		tracks = append(tracks, item.Track.FullTrack)
+	}
+
+	report.Included = len(tracks)
+	return tracks, report
+}
+
+// Write writes the report as text, one excluded item per line
+func (r CuratedReport) Write(w io.Writer) error {
+	_, err := fmt.Fprintf(w, "%d tracks included, %d left out\n", r.Included, len(r.Excluded))
+	if err != nil {
+		return err
+	}
+
+	for _, e := range r.Excluded {
+		name := e.Name
+		if name == "" {
+			name = "(unknown)"
+		}
+		_, err := fmt.Fprintf(w, "%s\t%s\t%s\n", e.Reason, name, e.URI)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// String is a one line summary of the report, for the log
+func (r CuratedReport) String() string {
+	reasons := make(map[string]int)
+	order := make([]string, 0)
+	for _, e := range r.Excluded {
+		if reasons[e.Reason] == 0 {
+			order = append(order, e.Reason)
+		}
+		reasons[e.Reason]++
+	}
+
+	parts := make([]string, 0, len(order))
+	for _, reason := range order {
+		parts = append(parts, fmt.Sprintf("%d %s", reasons[reason], reason))
+	}
+	if len(parts) == 0 {
+		return fmt.Sprintf("%d tracks included, none left out", r.Included)
+	}
+	return fmt.Sprintf("%d tracks included, left out %s", r.Included, strings.Join(parts, ", "))
+}
+
+// save writes the report to the report path, if any
+func (o CuratedOptions) save(report CuratedReport) {
+	if o.ReportPath == "" {
+		return
+	}
+
+	file, err := os.Create(o.ReportPath)
+	if err != nil {
+		log.WithError(err).Warn("Unable to write curated playlist report")
+		return
+	}
+	defer file.Close()
+
+	if err := report.Write(file); err != nil {
+		log.WithError(err).Warn("Unable to write curated playlist report")
+	}
+}
@@ -0,0 +1,89 @@
+package spotify
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/nollbit/spotify"
+)
+
+func testPlaylistItem(uri string, modify func(*playableItem)) playlistItem {
+	item := &playableItem{FullTrack: testTrack(uri, 200), Type: "track"}
+	item.Artists = []spotify.SimpleArtist{{Name: "ABBA"}}
+	if modify != nil {
+		modify(item)
+	}
+	return playlistItem{Track: item}
+}
+
+func TestCuratedOptionsCheck(t *testing.T) {
+	no := false
+
+	tests := []struct {
+		name   string
+		item   playlistItem
+		reason string
+	}{
+		{"track", testPlaylistItem("spotify:track:waterloo", nil), ""},
+		{"removed", playlistItem{}, "removed from Spotify"},
+		{"local", playlistItem{IsLocal: true, Track: &playableItem{}}, "local file"},
+		{"episode", testPlaylistItem("spotify:track:pod", func(i *playableItem) { i.Type = "episode" }), "not a track (episode)"},
+		{"not playable", testPlaylistItem("spotify:track:gone", func(i *playableItem) { i.IsPlayable = &no }), "not playable in this market"},
+		{"restricted", testPlaylistItem("spotify:track:gone", func(i *playableItem) {
+			i.IsPlayable = &no
+			i.Restrictions.Reason = "market"
+		}), "not playable (market)"},
+		{"explicit", testPlaylistItem("spotify:track:rude", func(i *playableItem) { i.Explicit = true }), "explicit"},
+	}
+
+	o := CuratedOptions{SkipExplicit: true}
+	for _, tt := range tests {
+		if got := o.check(tt.item); got != tt.reason {
+			t.Errorf("%s: check() = %q, want %q", tt.name, got, tt.reason)
+		}
+	}
+
+	explicit := testPlaylistItem("spotify:track:rude", func(i *playableItem) { i.Explicit = true })
+	if got := (CuratedOptions{}).check(explicit); got != "" {
+		t.Errorf("explicit tracks are left out without SkipExplicit: %q", got)
+	}
+}
+
+func TestCuratedOptionsFilter(t *testing.T) {
+	no := false
+	items := []playlistItem{
+		testPlaylistItem("spotify:track:waterloo", nil),
+		testPlaylistItem("spotify:track:gone", func(i *playableItem) { i.IsPlayable = &no }),
+		{},
+		testPlaylistItem("spotify:track:sos", nil),
+		testPlaylistItem("spotify:track:gone2", func(i *playableItem) { i.IsPlayable = &no }),
+	}
+
+	tracks, report := CuratedOptions{}.filter(items)
+	if len(tracks) != 2 || tracks[0].URI != "spotify:track:waterloo" || tracks[1].URI != "spotify:track:sos" {
+		t.Errorf("filter() kept %v", tracks)
+	}
+	if report.Included != 2 || len(report.Excluded) != 3 {
+		t.Fatalf("got report %+v", report)
+	}
+	if e := report.Excluded[0]; e.Name != "ABBA - gone" || e.URI != "spotify:track:gone" {
+		t.Errorf("got excluded %+v", e)
+	}
+
+	want := "2 tracks included, left out 2 not playable in this market, 1 removed from Spotify"
+	if got := report.String(); got != want {
+		t.Errorf("String() = %q, want %q", got, want)
+	}
+
+	var b bytes.Buffer
+	if err := report.Write(&b); err != nil {
+		t.Fatal(err)
+	}
+	want = "2 tracks included, 3 left out\n" +
+		"not playable in this market\tABBA - gone\tspotify:track:gone\n" +
+		"removed from Spotify\t(unknown)\t\n" +
+		"not playable in this market\tABBA - gone2\tspotify:track:gone2\n"
+	if b.String() != want {
+		t.Errorf("Write() wrote %q, want %q", b.String(), want)
+	}
+}
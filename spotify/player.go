@@ -1,7 +1,9 @@
 package spotify
 
 import (
+	"context"
 	"fmt"
+	"sync"
 	"time"
 
 	"github.com/nollbit/spotify"
@@ -32,13 +34,36 @@ type (
 	}
 
 	Player struct {
+		QueueEvents chan *PlayerQueueStatus
+		TrackEvents chan *PlayerTrackStatus
+		client      PlayerBackend
+		guard       *Guard
+		ctx         context.Context
+		cancel      context.CancelFunc
+		closeOnce   sync.Once
+		// asks the monitor to check with Spotify now, i.e. after a skip
+		recheck chan struct{}
+		// ExternalEvents tells when someone else takes over playback
+		ExternalEvents chan *PlayerExternalStatus
+		// External is what to do when someone else takes over playback
+		External ExternalPolicy
+		// History gets the tracks that played, when set
+		History *History
+
+		// the UI and the monitor both use the rest, behind the lock
+		lock                  sync.Mutex
 		State                 State
 		playing               *spotify.FullTrack
 		queue                 *Queue
-		QueueEvents           chan *PlayerQueueStatus
-		TrackEvents           chan *PlayerTrackStatus
 		currentTrackRemaining int
-		client                *spotify.Client
+		// the device tracks are played on, once one has started
+		deviceID spotify.ID
+		// the queue waits while someone else is playing
+		held bool
+		// set when the playing track is skipped
+		skipped bool
+		// when the playing track started, zero until it has
+		startedAt time.Time
 	}
 )
 
@@ -48,16 +73,49 @@ const (
 )
 
 func (p *Player) QueueFull() bool {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
 	return p.queue.QueueFull()
 }
 
+// QueueLen is the number of tracks waiting in the queue, not counting the one playing
+func (p *Player) QueueLen() int {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	return len(p.queue.Get())
+}
+
+// QueueSlotsLeft is how many more tracks can be added before the queue is full
+func (p *Player) QueueSlotsLeft() int {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	left := p.queue.MaxQueueSize - len(p.queue.Get())
+	if left < 0 {
+		return 0
+	}
+	return left
+}
+
 func (p *Player) QueueEmpty() bool {
-	return p.queue.QueueEmpty() && p.playing == nil // include current playing track in the "queue"
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	return p.queueEmpty()
+}
+
+// queueEmpty includes the playing track in the "queue". The lock must be held.
+func (p *Player) queueEmpty() bool {
+	return p.queue.QueueEmpty() && p.playing == nil
 }
 
 // add a tracks to end of the queue
 func (p *Player) QueueAdd(track spotify.FullTrack) error {
+	p.lock.Lock()
 	err := p.queue.QueueAdd(track)
+	p.lock.Unlock()
 	if err != nil {
 		return err
 	}
@@ -68,13 +126,18 @@ func (p *Player) QueueAdd(track spotify.FullTrack) error {
 
 // remove the last item added to the queue
 func (p *Player) QueueRemove() error {
+	p.lock.Lock()
+	skip := p.queue.QueueEmpty() && p.playing != nil
+	var err error
 	if !p.queue.QueueEmpty() {
-		_, err := p.queue.QueueRemove()
+		_, err = p.queue.QueueRemove()
+	}
+	p.lock.Unlock()
 
-		if err != nil {
-			return err
-		}
-	} else if p.playing != nil {
+	if err != nil {
+		return err
+	}
+	if skip {
 		p.Skip()
 	}
 
@@ -93,28 +156,55 @@ func (p *Player) IsInQueue(trackID spotify.ID) bool {
 }
 
 func (p *Player) CurrentlyPlaying() *spotify.FullTrack {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
 	return p.playing
 }
 
 func (p *Player) Skip() error {
+	p.lock.Lock()
 	if p.State != StatePlaying {
+		p.lock.Unlock()
 		return nil
 	}
-
 	// simply tell the spotify player to skip the currently playing song
 	// polling will detect that we're no longer playing and kick off
 	// the next song
-	return p.client.Next()
+	p.skipped = true
+	p.lock.Unlock()
+
+	err := p.guard.Call(p.client.Next)
+
+	// let the monitor see it right away
+	select {
+	case p.recheck <- struct{}{}:
+	default:
+	}
+	return err
+}
+
+// Guard returns the guard all requests to Spotify go through
+func (p *Player) Guard() *Guard {
+	return p.guard
 }
 
 func (p *Player) GetQueue() []*QueuedTrack {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	return p.getQueue()
+}
+
+// getQueue is GetQueue with the lock held
+func (p *Player) getQueue() []*QueuedTrack {
 	tracks := p.queue.Get()
 
 	//log.Debug("Queue has tracks %v", tracks)
 
 	q := make([]*QueuedTrack, 0, len(tracks))
 
-	remaining := p.currentTrackRemaining
+	remaining := p.playingRemaining()
 
 	for _, s := range tracks {
 		qs := &QueuedTrack{
@@ -129,8 +219,37 @@ func (p *Player) GetQueue() []*QueuedTrack {
 	return q
 }
 
+// TimeUntilQueued returns the time in seconds until a track added to the queue
+// now would start playing. It's the TimeUntilStart GetQueue would give it.
+func (p *Player) TimeUntilQueued() int {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	remaining := p.playingRemaining()
+
+	for _, s := range p.queue.Get() {
+		remaining += (s.Duration / 1000)
+	}
+
+	return remaining
+}
+
+// playingRemaining is how long the playing track goes on, in seconds, with
+// the lock held. A skipped track is about to end, whatever the monitor saw
+// last.
+func (p *Player) playingRemaining() int {
+	if p.skipped {
+		return 0
+	}
+	return p.currentTrackRemaining
+}
+
+// playNextTrackIfNotAlready takes the next track from the queue and starts it
+// in the background, unless something is already playing
 func (p *Player) playNextTrackIfNotAlready() {
-	if p.QueueEmpty() || p.State == StatePlaying {
+	p.lock.Lock()
+	if p.queueEmpty() || p.State == StatePlaying || p.held {
+		p.lock.Unlock()
 		return
 	}
 
@@ -144,122 +263,377 @@ func (p *Player) playNextTrackIfNotAlready() {
 	}
 
 	p.State = StatePlaying
+	p.skipped = false
+	p.startedAt = time.Time{}
 
 	nextTrack, err := p.queue.Next()
 	if err != nil {
 		panic(err)
 	}
-
-	p.queueChanged()
-
 	p.playing = nextTrack
+	p.lock.Unlock()
 
-	for {
-		log.Debugf("Trying to start track %s", nextTrack.URI)
-		err = p.client.PlayOpt(&spotify.PlayOptions{
-			URIs: []spotify.URI{nextTrack.URI},
+	p.sendQueueStatus()
+	go p.start(nextTrack)
+}
+
+// start asks Spotify to play the track until it does, then follows it. It
+// can take a while when Spotify is having trouble, so it's never run on the
+// UI's goroutine.
+func (p *Player) start(nextTrack *spotify.FullTrack) {
+	log.Debugf("Trying to start track %s", nextTrack.URI)
+	err := p.guard.Retry(p.ctx, "start playing track", func() error {
+		return p.client.PlayOpt(&spotify.PlayOptions{
+			DeviceID: p.device(),
+			URIs:     []spotify.URI{nextTrack.URI},
 		})
+	})
+	if err != nil {
+		if p.ctx.Err() != nil {
+			log.WithField("nextTrack", nextTrack.URI).Debug("Closed before the track started")
+			return
+		}
+		// Spotify won't play it, go on with the next one
+		if p.sendTrackStatus(nextTrack, true) {
+			p.finished()
+		}
+		return
+	}
+	log.WithField("nextTrack", nextTrack.URI).Debug("Started playing track")
+
+	go p.monitor(nextTrack)
+}
+
+// monitor follows a track until it ends, sending track events as it goes.
+// Spotify is only asked now and then, see playbackMonitor. When there's a
+// next track in the queue it's started just before this one ends. When
+// someone else takes over, the External policy decides what happens.
+func (p *Player) monitor(track *spotify.FullTrack) {
+	rate := 1.0
+	if r, ok := p.client.(playbackRater); ok {
+		rate = r.PlaybackRate()
+	}
+	m := newPlaybackMonitor(track, rate)
+
+	var state *spotify.PlayerState
+	pollPlayerState := func() (err error) {
+		state, err = p.client.PlayerState()
+		return err
+	}
+	failures := 0
+	// poll sleeps and returns false when it's time to give up
+	poll := func() bool {
+		err := p.guard.Call(pollPlayerState)
 		if err != nil {
-			log.WithError(err).Warn("Unable to start playing track")
-			time.Sleep(3 * time.Second)
-		} else {
-			log.WithField("nextTrack", nextTrack.URI).Debug("Started playing track")
+			log.WithError(err).Warn("Unable to poll player state")
+			if !sleep(p.ctx, p.guard.Delay(failures)) {
+				return false
+			}
+			failures++
+			return true
+		}
+		failures = 0
+		return true
+	}
+
+	// make sure we actually start playing the track before going in to the track loop
+	for {
+		state = nil
+		if !poll() {
+			return
+		}
+		if state != nil && m.started(state) {
 			break
 		}
+		if p.isSkipped() {
+			// skipped while it was being started, and Spotify went on to
+			// something else or stopped
+			log.Debugf("Track %s was skipped before it started", track.URI)
+			if p.sendTrackStatus(track, true) {
+				p.finished()
+			}
+			return
+		}
+		if !sleep(p.ctx, monitorStartInterval) {
+			return
+		}
 	}
+	m.update(state, time.Now())
+	p.lock.Lock()
+	p.deviceID = m.device
+	p.startedAt = time.Now()
+	p.lock.Unlock()
 
-	// poll for track play status
-	go func() {
+	for {
+		now := time.Now()
+		done := false
 
-		var cp *spotify.CurrentlyPlaying
+		select {
+		case <-p.recheck:
+			m.nextCheck = now
+		default:
+		}
 
-		// make sure we actually start playing the track before going in to the track loop
-		for {
-			//log.Debug("Polling for track start")
-			cp, err = p.client.PlayerCurrentlyPlaying()
-			if err != nil {
-				log.WithError(err).Warn("Unable to poll currently playing")
-				time.Sleep(1 * time.Second)
-				continue
+		if m.needsCheck(now) {
+			state = nil
+			if !poll() {
+				return
 			}
-
-			if !cp.Playing {
-				time.Sleep(1 * time.Second)
+			if state == nil {
 				continue
 			}
+			now = time.Now()
+			switch m.update(state, now) {
+			case playbackStopped:
+				log.Debugf("Track %s stopped", m.track.URI)
+				done = true
+			case playbackTakenOver:
+				if p.isSkipped() {
+					log.Debugf("Track %s was skipped, Spotify went on to %s", m.track.URI, state.Item.URI)
+					done = true
+				} else if m.autoplayed(state, now) {
+					log.Debugf("Track %s ended, Spotify went on to %s", m.track.URI, state.Item.URI)
+					done = true
+				} else if p.takenOver(m, state, now) {
+					// the monitor follows the adopted track instead
+					m = newPlaybackMonitor(state.Item, rate)
+					m.started(state)
+					m.update(state, now)
+					p.lock.Lock()
+					p.playing = state.Item
+					p.deviceID = m.device
+					p.startedAt = now
+					p.skipped = false
+					p.lock.Unlock()
+				} else {
+					return
+				}
+			}
+		}
 
-			break
+		// hand over to the next track without waiting for Spotify to notice
+		// this one has ended
+		if !done && p.queueWaiting() && m.readyForHandover(now) {
+			log.Debugf("Handing over from %s", m.track.URI)
+			done = true
 		}
 
-		trackLengthMillis := p.playing.Duration
-		trackProgressMillis := cp.Progress
-		almostDone := false
+		remaining := m.remaining(now)
+		if done {
+			remaining = 0
+		}
+		// in track time, like the durations of the queued tracks
+		p.lock.Lock()
+		p.currentTrackRemaining = int(remaining.Seconds() * rate)
+		startedAt, skipped := p.startedAt, p.skipped
+		p.lock.Unlock()
+
+		if !p.sendTrackStatus(m.track, done) {
+			return
+		}
 
-		// we don't query spotify all the time, so keep track on when we did it last
-		latestFullUpdate := time.Now()
-		for {
-			elapsedSinceFullUpdate := time.Now().Sub(latestFullUpdate)
+		if done {
+			p.History.Played(*m.track, startedAt, skipped)
+			p.finished()
+			return
+		}
 
-			if int(elapsedSinceFullUpdate.Seconds()) > 10 || almostDone {
+		if !sleep(p.ctx, 200*time.Millisecond) {
+			return
+		}
+	}
+}
 
-				cp, err = p.client.PlayerCurrentlyPlaying()
-				if err != nil {
-					log.WithError(err).Warn("Unable to poll currently playing")
-					continue
-				}
-				latestFullUpdate = time.Now()
+// finished stops following the playing track and starts the next one
+func (p *Player) finished() {
+	p.lock.Lock()
+	p.playing = nil
+	p.State = StateStopped
+	p.lock.Unlock()
 
-				trackProgressMillis = cp.Progress
-			} else {
-				trackProgressMillis = cp.Progress + int(elapsedSinceFullUpdate.Nanoseconds()/1000000)
-			}
+	p.playNextTrackIfNotAlready()
+}
 
-			currentTrackRemainingMillis := trackLengthMillis - trackProgressMillis
-			currentTrackRemaining := currentTrackRemainingMillis / 1000
-			p.currentTrackRemaining = currentTrackRemaining
+// isSkipped tells if the playing track has been skipped
+func (p *Player) isSkipped() bool {
+	p.lock.Lock()
+	defer p.lock.Unlock()
 
-			done := !cp.Playing
+	return p.skipped
+}
 
-			trackStatus := &PlayerTrackStatus{
-				Length:    trackLengthMillis / 1000,
-				Remaining: currentTrackRemaining,
-				Err:       nil,
-				Done:      done,
-				Track:     p.playing,
-			}
-			p.TrackEvents <- trackStatus
+// queueWaiting tells if there are tracks waiting after the playing one
+func (p *Player) queueWaiting() bool {
+	p.lock.Lock()
+	defer p.lock.Unlock()
 
-			if done {
-				p.playing = nil
-				p.State = StateStopped
-				go p.playNextTrackIfNotAlready()
-				return
-			}
+	return !p.queue.QueueEmpty()
+}
 
-			if currentTrackRemainingMillis < 400 {
-				almostDone = true
+// sendTrackStatus sends a track event, it returns false if the player was
+// closed first
+func (p *Player) sendTrackStatus(track *spotify.FullTrack, done bool) bool {
+	p.lock.Lock()
+	remaining := p.currentTrackRemaining
+	p.lock.Unlock()
+
+	trackStatus := &PlayerTrackStatus{
+		Length:    track.Duration / 1000,
+		Remaining: remaining,
+		Err:       nil,
+		Done:      done,
+		Track:     track,
+	}
+	if done {
+		trackStatus.Remaining = 0
+	}
+
+	select {
+	case p.TrackEvents <- trackStatus:
+		return true
+	case <-p.ctx.Done():
+		return false
+	}
+}
+
+// takenOver handles someone else playing something, or playing it somewhere
+// else. It returns true when the monitor should follow the other track, and
+// false when it's done with the current one.
+func (p *Player) takenOver(m *playbackMonitor, state *spotify.PlayerState, now time.Time) bool {
+	e := &PlayerExternalStatus{
+		Policy: p.External,
+		Device: state.Device.Name,
+		Track:  state.Item,
+	}
+	log.Warnf("Expected %s to be playing, but it's %s on %s (%s), policy is %s",
+		m.track.URI, state.Item.URI, state.Device.Name, state.Device.ID, p.External)
+	p.external(e)
+
+	switch p.External {
+	case ExternalAdopt:
+		return true
+
+	case ExternalReclaim:
+		position := m.position(now)
+		err := p.guard.Retry(p.ctx, "reclaim playback", func() error {
+			return p.client.PlayOpt(&spotify.PlayOptions{
+				DeviceID:   p.device(),
+				URIs:       []spotify.URI{m.track.URI},
+				PositionMs: position,
+			})
+		})
+		if err != nil {
+			if p.ctx.Err() == nil && p.sendTrackStatus(m.track, true) {
+				p.finished()
 			}
+			return false
+		}
+		log.Infof("Reclaimed playback of %s at %s", m.track.URI, time.Duration(position)*time.Millisecond)
+		go p.monitor(m.track)
+		return false
+
+	default:
+		// let them play, and pick up the queue when they're done
+		p.sendTrackStatus(m.track, true)
+		p.lock.Lock()
+		p.playing = nil
+		p.State = StateStopped
+		p.held = true
+		p.lock.Unlock()
+		go p.waitForExternal()
+		return false
+	}
+}
 
-			time.Sleep(200 * time.Millisecond)
+// waitForExternal checks now and then if the other playback has stopped,
+// and starts the queue again when it has
+func (p *Player) waitForExternal() {
+	for {
+		if !sleep(p.ctx, monitorCheckInterval) {
+			return
 		}
-	}()
+
+		var state *spotify.PlayerState
+		err := p.guard.Call(func() (err error) {
+			state, err = p.client.PlayerState()
+			return err
+		})
+		if err != nil {
+			log.WithError(err).Warn("Unable to poll player state")
+			continue
+		}
+		if state.Playing && state.Item != nil {
+			continue
+		}
+
+		log.Info("Nothing else is playing any more, resuming the queue")
+		p.lock.Lock()
+		p.held = false
+		p.lock.Unlock()
+		p.external(&PlayerExternalStatus{Policy: p.External, Resumed: true})
+		p.playNextTrackIfNotAlready()
+		return
+	}
+}
+
+// device is the device the player plays on, nil until a track has started
+// and whatever device is active is used
+func (p *Player) device() *spotify.ID {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	if p.deviceID == "" {
+		return nil
+	}
+	id := p.deviceID
+	return &id
 }
 
 func (p *Player) queueChanged() {
+	p.sendQueueStatus()
+	p.playNextTrackIfNotAlready()
+}
+
+// sendQueueStatus sends a queue event in the background
+func (p *Player) sendQueueStatus() {
 	e := &PlayerQueueStatus{Queue: p.GetQueue()}
 
 	go func() {
-		p.QueueEvents <- e
+		select {
+		case p.QueueEvents <- e:
+		case <-p.ctx.Done():
+		}
 	}()
-	p.playNextTrackIfNotAlready()
-
 }
 
+// Close stops polling and pauses playback. The playing track goes to the
+// history as played. It's fine to call it more than once.
 func (p *Player) Close() {
+	p.closeOnce.Do(func() {
+		p.cancel()
+
+		p.lock.Lock()
+		playing, startedAt := p.playing, p.startedAt
+		p.lock.Unlock()
+		if playing != nil && !startedAt.IsZero() {
+			p.History.Played(*playing, startedAt, false)
+		}
+
+		err := p.client.Pause()
+		if err != nil {
+			log.WithError(err).Warn("Unable to pause playback")
+		}
+	})
 }
 
-// NewPlayer creates a new player. It's not thread safe.
-func NewPlayer(client *spotify.Client, maxQueueSize int) (*Player, error) {
+// NewPlayer creates a new player. All requests go through the guard, a new
+// one is created if it's nil. The player stops when the context is done or
+// it's closed.
+func NewPlayer(ctx context.Context, client PlayerBackend, guard *Guard, maxQueueSize int) (*Player, error) {
+	if guard == nil {
+		guard = NewGuard()
+	}
+
 	queue := NewQueue(maxQueueSize)
 
 	p := &Player{
@@ -269,7 +643,13 @@ func NewPlayer(client *spotify.Client, maxQueueSize int) (*Player, error) {
 		TrackEvents: make(chan *PlayerTrackStatus),
 		QueueEvents: make(chan *PlayerQueueStatus),
 		client:      client,
+		guard:       guard,
+		recheck:     make(chan struct{}, 1),
+
+		ExternalEvents: make(chan *PlayerExternalStatus),
+		External:       ExternalPause,
 	}
+	p.ctx, p.cancel = context.WithCancel(ctx)
 
 	return p, nil
 }
@@ -0,0 +1,270 @@
+package spotify
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/nollbit/spotify"
+)
+
+const testSpeed = 10
+
+func testTrack(uri string, seconds int) spotify.FullTrack {
+	id := spotify.ID(uri[len("spotify:track:"):])
+	return spotify.FullTrack{
+		SimpleTrack: spotify.SimpleTrack{
+			ID:       id,
+			URI:      spotify.URI(uri),
+			Name:     string(id),
+			Duration: seconds * 1000,
+		},
+	}
+}
+
+// testPlayer plays two queued tracks on a fake backend, which also has a track
+// for autoplay and one for someone else to play
+func testPlayer(t *testing.T, autoplay bool) (*Player, *FakeBackend, <-chan *PlayerExternalStatus) {
+	fake := NewFakeBackend(testSpeed)
+	fake.AddTracks([]spotify.FullTrack{
+		testTrack("spotify:track:queued1", 60),
+		testTrack("spotify:track:queued2", 60),
+		testTrack("spotify:track:autoplay", 60),
+		testTrack("spotify:track:other", 60),
+	})
+	fake.SetAutoplay(autoplay)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	p, err := NewPlayer(ctx, fake, nil, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(p.Close)
+
+	external := make(chan *PlayerExternalStatus, 10)
+	go func() {
+		for {
+			select {
+			case <-p.QueueEvents:
+			case e := <-p.ExternalEvents:
+				external <- e
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	return p, fake, external
+}
+
+// waitForTrack reads track events until the track is playing
+func waitForTrack(t *testing.T, p *Player, uri spotify.URI) {
+	t.Helper()
+
+	timeout := time.After(5 * time.Second)
+	for {
+		select {
+		case s := <-p.TrackEvents:
+			if s.Track.URI == uri && !s.Done {
+				return
+			}
+		case <-timeout:
+			t.Fatalf("%s never started playing", uri)
+		}
+	}
+}
+
+func TestPlayerSkipWithAutoplay(t *testing.T) {
+	p, _, external := testPlayer(t, true)
+
+	for _, track := range []spotify.FullTrack{testTrack("spotify:track:queued1", 60), testTrack("spotify:track:queued2", 60)} {
+		if err := p.QueueAdd(track); err != nil {
+			t.Fatal(err)
+		}
+	}
+	waitForTrack(t, p, "spotify:track:queued1")
+
+	if err := p.Skip(); err != nil {
+		t.Fatal(err)
+	}
+	waitForTrack(t, p, "spotify:track:queued2")
+
+	select {
+	case e := <-external:
+		t.Errorf("the skip was taken for someone else taking over: %+v", e)
+	default:
+	}
+}
+
+func TestPlayerExternalControl(t *testing.T) {
+	tests := []struct {
+		policy ExternalPolicy
+		// the track playing after someone else took over
+		playing spotify.URI
+	}{
+		{ExternalAdopt, "spotify:track:other"},
+		{ExternalReclaim, "spotify:track:queued1"},
+	}
+
+	for _, tt := range tests {
+		t.Run(string(tt.policy), func(t *testing.T) {
+			p, fake, external := testPlayer(t, false)
+			p.External = tt.policy
+
+			if err := p.QueueAdd(testTrack("spotify:track:queued1", 60)); err != nil {
+				t.Fatal(err)
+			}
+			waitForTrack(t, p, "spotify:track:queued1")
+
+			fake.PlayOpt(&spotify.PlayOptions{URIs: []spotify.URI{"spotify:track:other"}})
+			p.recheck <- struct{}{}
+
+			select {
+			case e := <-external:
+				if e.Policy != tt.policy || e.Track == nil || e.Track.URI != "spotify:track:other" {
+					t.Errorf("got external event %+v", e)
+				}
+			case <-time.After(5 * time.Second):
+				t.Fatal("taking over wasn't noticed")
+			}
+			waitForTrack(t, p, tt.playing)
+		})
+	}
+}
+
+func TestPlayerExternalPause(t *testing.T) {
+	p, fake, external := testPlayer(t, false)
+
+	track := testTrack("spotify:track:queued1", 60)
+	if err := p.QueueAdd(track); err != nil {
+		t.Fatal(err)
+	}
+	waitForTrack(t, p, "spotify:track:queued1")
+
+	fake.PlayOpt(&spotify.PlayOptions{URIs: []spotify.URI{"spotify:track:other"}})
+	p.recheck <- struct{}{}
+
+	select {
+	case e := <-external:
+		if e.Policy != ExternalPause || e.Resumed {
+			t.Errorf("got external event %+v", e)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("taking over wasn't noticed")
+	}
+
+	timeout := time.After(5 * time.Second)
+	for {
+		select {
+		case s := <-p.TrackEvents:
+			if s.Track.URI != "spotify:track:queued1" {
+				t.Fatalf("got a track event for %s", s.Track.URI)
+			}
+			if !s.Done {
+				continue
+			}
+		case <-timeout:
+			t.Fatal("the track never ended")
+		}
+		break
+	}
+
+	// the queue waits for them
+	if err := p.QueueAdd(track); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case s := <-p.TrackEvents:
+		t.Errorf("%s started while someone else was playing", s.Track.URI)
+	case <-time.After(500 * time.Millisecond):
+	}
+}
+
+func TestPlayerAdoptWithContext(t *testing.T) {
+	p, fake, external := testPlayer(t, false)
+	p.External = ExternalAdopt
+
+	if err := p.QueueAdd(testTrack("spotify:track:queued1", 60)); err != nil {
+		t.Fatal(err)
+	}
+	waitForTrack(t, p, "spotify:track:queued1")
+
+	// played from an album on someone's phone
+	album := spotify.URI("spotify:album:arrival")
+	fake.PlayOpt(&spotify.PlayOptions{PlaybackContext: &album, URIs: []spotify.URI{"spotify:track:other"}})
+	p.recheck <- struct{}{}
+	waitForTrack(t, p, "spotify:track:other")
+
+	// checking again while it plays isn't someone else taking over again
+	adopted := 0
+	timeout := time.After(time.Second)
+	for checks := 0; ; {
+		select {
+		case e := <-external:
+			if e.Track == nil || e.Track.URI != "spotify:track:other" {
+				t.Errorf("got external event %+v", e)
+			}
+			adopted++
+			continue
+		case s := <-p.TrackEvents:
+			if s.Track.URI != "spotify:track:other" {
+				t.Fatalf("got a track event for %s", s.Track.URI)
+			}
+			if checks < 3 {
+				select {
+				case p.recheck <- struct{}{}:
+					checks++
+				default:
+				}
+			}
+			continue
+		case <-timeout:
+		}
+		break
+	}
+	if adopted != 1 {
+		t.Errorf("got %d adopt events, want 1", adopted)
+	}
+	if playing := p.CurrentlyPlaying(); playing == nil || playing.URI != "spotify:track:other" {
+		t.Errorf("playing %v, want the adopted track", playing)
+	}
+}
+
+func TestPlayerUnplayableTrack(t *testing.T) {
+	p, _, _ := testPlayer(t, false)
+
+	for _, track := range []spotify.FullTrack{testTrack("spotify:track:gone", 60), testTrack("spotify:track:queued1", 60)} {
+		if err := p.QueueAdd(track); err != nil {
+			t.Fatal(err)
+		}
+	}
+	waitForTrack(t, p, "spotify:track:queued1")
+
+	if s := p.Guard().State(); s.Status != GuardOK {
+		t.Errorf("guard state %+v after a track Spotify doesn't have, want ok", s)
+	}
+}
+
+func TestPlayerSkippedTrackRemaining(t *testing.T) {
+	playing := testTrack("spotify:track:playing", 240)
+	p := &Player{
+		State:                 StatePlaying,
+		playing:               &playing,
+		queue:                 NewQueue(5),
+		currentTrackRemaining: 200,
+	}
+	if err := p.queue.QueueAdd(testTrack("spotify:track:next", 180)); err != nil {
+		t.Fatal(err)
+	}
+
+	if q := p.GetQueue(); q[0].TimeUntilStart != 200 || p.TimeUntilQueued() != 380 {
+		t.Errorf("the next track starts in %d seconds and a new one in %d, want 200 and 380", q[0].TimeUntilStart, p.TimeUntilQueued())
+	}
+
+	// the rest of a skipped track doesn't count, even before the next one starts
+	p.skipped = true
+	if q := p.GetQueue(); q[0].TimeUntilStart != 0 || p.TimeUntilQueued() != 180 {
+		t.Errorf("after a skip the next track starts in %d seconds and a new one in %d, want 0 and 180", q[0].TimeUntilStart, p.TimeUntilQueued())
+	}
+}
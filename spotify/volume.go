@@ -0,0 +1,331 @@
+package spotify
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/nollbit/spotify"
+	log "github.com/sirupsen/logrus"
+	"gopkg.in/alecthomas/kingpin.v2"
+)
+
+var (
+	volumeFlag       = kingpin.Flag("volume", "The volume to start at, in percent. Defaults to the volume of the device.").Int()
+	volumeMaxFlag    = kingpin.Flag("volume-max", "The highest volume anyone can turn it up to, in percent").Default("100").Int()
+	volumeStepFlag   = kingpin.Flag("volume-step", "How much each turn up or down changes the volume, in percent").Default("5").Int()
+	volumeLimitsFlag = kingpin.Flag("volume-limits", "Lower the highest volume at set times, e.g. 23:00=60,01:00=40").String()
+	volumeFadeFlag   = kingpin.Flag("volume-fade", "Fade out at closing time, e.g. 02:00/10m fades to nothing over ten minutes from 02:00").String()
+)
+
+const (
+	// how often the schedule is checked, often enough for a smooth fade
+	volumeInterval = time.Second
+	// the night goes from noon to noon, times before it are after midnight
+	volumeNightStart = 12 * time.Hour
+)
+
+type (
+	// VolumeSchedule lowers the highest volume during the night, and fades
+	// out at closing time
+	VolumeSchedule struct {
+		limits []volumeLimit
+		// zero when there's no fade
+		fadeAt, fadeOver time.Duration
+	}
+
+	volumeLimit struct {
+		// since the start of the night
+		at  time.Duration
+		max int
+	}
+
+	// VolumeStatus is the volume right now
+	VolumeStatus struct {
+		// what the device is set to
+		Level int
+		// what was asked for, more than Level when a limit or the fade is in the way
+		Wanted int
+		// set during the fade at closing time
+		Fading bool
+	}
+
+	// Volume turns the volume of the device the player plays on up and down,
+	// within the safe maximum and the limits of the schedule. The device is
+	// set in the background, so turning it up and down never blocks.
+	Volume struct {
+		player   *Player
+		schedule *VolumeSchedule
+		max      int
+		step     int
+
+		lock sync.Mutex
+		// what was asked for
+		wanted int
+		// what the device was last set to, -1 before the first time
+		level int
+
+		nudge chan struct{}
+		// Events tells when the volume changes
+		Events chan *VolumeStatus
+	}
+)
+
+// ParseVolumeSchedule reads limits like 23:00=60, separated by commas, and a
+// fade like 02:00/10m. Either can be empty.
+func ParseVolumeSchedule(limits, fade string) (*VolumeSchedule, error) {
+	s := &VolumeSchedule{limits: make([]volumeLimit, 0)}
+
+	for _, part := range strings.Split(limits, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+
+		kv := strings.SplitN(part, "=", 2)
+		if len(kv) != 2 {
+			return nil, fmt.Errorf("Unable to parse volume limit %s: expected time=percent", part)
+		}
+		at, err := parseNightTime(kv[0])
+		if err != nil {
+			return nil, fmt.Errorf("Unable to parse volume limit time %s: %v", kv[0], err)
+		}
+		max, err := strconv.Atoi(strings.TrimSpace(kv[1]))
+		if err != nil || max < 0 || max > 100 {
+			return nil, fmt.Errorf("Unable to parse volume limit %s: expected 0 to 100", kv[1])
+		}
+		s.limits = append(s.limits, volumeLimit{at: at, max: max})
+	}
+	sort.Slice(s.limits, func(i, j int) bool {
+		return s.limits[i].at < s.limits[j].at
+	})
+
+	if fade = strings.TrimSpace(fade); fade != "" {
+		parts := strings.SplitN(fade, "/", 2)
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("Unable to parse volume fade %s: expected time/duration", fade)
+		}
+		at, err := parseNightTime(parts[0])
+		if err != nil {
+			return nil, fmt.Errorf("Unable to parse volume fade time %s: %v", parts[0], err)
+		}
+		over, err := time.ParseDuration(strings.TrimSpace(parts[1]))
+		if err != nil || over <= 0 {
+			return nil, fmt.Errorf("Unable to parse volume fade duration %s: expected i.e. 10m", parts[1])
+		}
+		s.fadeAt, s.fadeOver = at, over
+	}
+
+	return s, nil
+}
+
+// parseNightTime reads a time of day as the time since the start of the night
+func parseNightTime(s string) (time.Duration, error) {
+	clock, err := time.Parse("15:04", strings.TrimSpace(s))
+	if err != nil {
+		return 0, err
+	}
+	return sinceNightStart(clock), nil
+}
+
+func sinceNightStart(t time.Time) time.Duration {
+	at := time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute + time.Duration(t.Second())*time.Second
+	return (at - volumeNightStart + 24*time.Hour) % (24 * time.Hour)
+}
+
+// Max is the highest volume at a time, according to the limits. It's 100
+// before the first one.
+func (s *VolumeSchedule) Max(t time.Time) int {
+	at := sinceNightStart(t)
+
+	max := 100
+	for _, l := range s.limits {
+		if l.at > at {
+			break
+		}
+		max = l.max
+	}
+	return max
+}
+
+// fade is how much of the volume is left at a time, from 1 before closing
+// time down to 0 when the fade is over
+func (s *VolumeSchedule) fade(t time.Time) float64 {
+	if s.fadeOver == 0 {
+		return 1
+	}
+
+	f := float64(sinceNightStart(t)-s.fadeAt) / float64(s.fadeOver)
+	return 1 - math.Max(0, math.Min(1, f))
+}
+
+// NewVolume controls the volume of the device the player plays on. It starts
+// at the given volume, or the volume of the device if it's 0, and follows the
+// schedule until the context is done.
+func NewVolume(ctx context.Context, player *Player, schedule *VolumeSchedule, start, max, step int) *Volume {
+	if schedule == nil {
+		schedule = &VolumeSchedule{}
+	}
+
+	v := &Volume{
+		player:   player,
+		schedule: schedule,
+		max:      max,
+		step:     step,
+		wanted:   start,
+		level:    -1,
+		nudge:    make(chan struct{}, 1),
+		Events:   make(chan *VolumeStatus),
+	}
+
+	if start <= 0 {
+		var state *spotify.PlayerState
+		err := player.guard.Call(func() (err error) {
+			state, err = player.client.PlayerState()
+			return err
+		})
+		if err != nil {
+			log.WithError(err).Warn("Unable to get the volume of the device, starting at half")
+			v.wanted = 50
+		} else {
+			v.wanted = state.Device.Volume
+		}
+	}
+	if v.wanted > max {
+		v.wanted = max
+	}
+
+	go v.run(ctx)
+	return v
+}
+
+// VolumeFromFlags controls the volume as given by the --volume flags
+func VolumeFromFlags(ctx context.Context, player *Player) (*Volume, error) {
+	schedule, err := ParseVolumeSchedule(*volumeLimitsFlag, *volumeFadeFlag)
+	if err != nil {
+		return nil, err
+	}
+	if *volumeMaxFlag < 0 || *volumeMaxFlag > 100 {
+		return nil, fmt.Errorf("Unable to use volume max %d: expected 0 to 100", *volumeMaxFlag)
+	}
+	return NewVolume(ctx, player, schedule, *volumeFlag, *volumeMaxFlag, *volumeStepFlag), nil
+}
+
+// Up turns the volume up a step, as far as it's allowed to go right now
+func (v *Volume) Up() {
+	v.change(v.step)
+}
+
+// Down turns the volume down a step
+func (v *Volume) Down() {
+	v.change(-v.step)
+}
+
+func (v *Volume) change(delta int) {
+	v.lock.Lock()
+	// going from what's heard, so turning it down under a limit is heard
+	// right away and turning it up doesn't save up for when the limit is over
+	wanted := v.wanted
+	max := v.maxAt(time.Now())
+	if wanted > max {
+		wanted = max
+	}
+	wanted += delta
+	if wanted > max {
+		wanted = max
+	}
+	if wanted < 0 {
+		wanted = 0
+	}
+	v.wanted = wanted
+	v.lock.Unlock()
+
+	select {
+	case v.nudge <- struct{}{}:
+	default:
+	}
+}
+
+// maxAt is the highest volume at a time
+func (v *Volume) maxAt(t time.Time) int {
+	max := v.schedule.Max(t)
+	if v.max < max {
+		max = v.max
+	}
+	return max
+}
+
+// Status returns the volume right now
+func (v *Volume) Status() *VolumeStatus {
+	v.lock.Lock()
+	defer v.lock.Unlock()
+
+	return v.status(time.Now())
+}
+
+func (v *Volume) status(now time.Time) *VolumeStatus {
+	level := v.wanted
+	if max := v.maxAt(now); level > max {
+		level = max
+	}
+	fade := v.schedule.fade(now)
+	level = int(math.Round(float64(level) * fade))
+
+	return &VolumeStatus{Level: level, Wanted: v.wanted, Fading: fade < 1}
+}
+
+func (v *Volume) run(ctx context.Context) {
+	ticker := time.NewTicker(volumeInterval)
+	defer ticker.Stop()
+
+	var sent VolumeStatus
+	failures := 0
+	for {
+		v.lock.Lock()
+		status := v.status(time.Now())
+		changed := status.Level != v.level
+		v.lock.Unlock()
+
+		if changed {
+			err := v.player.guard.Call(func() error {
+				return v.player.client.VolumeOpt(status.Level, &spotify.PlayOptions{DeviceID: v.player.device()})
+			})
+			if err != nil {
+				log.WithError(err).Warnf("Unable to set the volume to %d%%", status.Level)
+				if !sleep(ctx, v.player.guard.Delay(failures)) {
+					return
+				}
+				failures++
+				continue
+			}
+			failures = 0
+			log.Debugf("Volume set to %d%%", status.Level)
+
+			v.lock.Lock()
+			v.level = status.Level
+			v.lock.Unlock()
+		}
+
+		// turning it up against a limit changes what's wanted, not the level
+		if *status != sent {
+			select {
+			case v.Events <- status:
+				sent = *status
+			case <-ctx.Done():
+				return
+			}
+		}
+
+		select {
+		case <-v.nudge:
+		case <-ticker.C:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
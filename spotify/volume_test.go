@@ -0,0 +1,202 @@
+package spotify
+
+import (
+	"context"
+	"math"
+	"testing"
+	"time"
+)
+
+func testNight(hour, minute int) time.Time {
+	return time.Date(2019, 3, 1, hour, minute, 0, 0, time.Local)
+}
+
+func TestParseVolumeSchedule(t *testing.T) {
+	bad := [][2]string{
+		{"23:00", ""},
+		{"23:00=loud", ""},
+		{"23:00=101", ""},
+		{"11pm=60", ""},
+		{"", "02:00"},
+		{"", "02:00/soon"},
+		{"", "02:00/-10m"},
+		{"", "2am/10m"},
+	}
+	for _, b := range bad {
+		if _, err := ParseVolumeSchedule(b[0], b[1]); err == nil {
+			t.Errorf("ParseVolumeSchedule(%q, %q) didn't fail", b[0], b[1])
+		}
+	}
+
+	s, err := ParseVolumeSchedule("", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.Max(testNight(23, 0)) != 100 || s.fade(testNight(3, 0)) != 1 {
+		t.Error("an empty schedule limits the volume")
+	}
+
+	// in any order, after midnight is later in the night
+	s, err = ParseVolumeSchedule(" 01:00=40, 23:00=60 ,", " 02:00/10m ")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(s.limits) != 2 || s.limits[0].max != 60 || s.limits[1].max != 40 {
+		t.Errorf("got limits %v", s.limits)
+	}
+	if s.fadeAt != 14*time.Hour || s.fadeOver != 10*time.Minute {
+		t.Errorf("got a fade at %s over %s", s.fadeAt, s.fadeOver)
+	}
+}
+
+func TestVolumeScheduleMax(t *testing.T) {
+	s, err := ParseVolumeSchedule("23:00=60,01:00=40", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		at   time.Time
+		want int
+	}{
+		{testNight(12, 0), 100},
+		{testNight(20, 0), 100},
+		{testNight(22, 59), 100},
+		{testNight(23, 0), 60},
+		{testNight(0, 30), 60},
+		{testNight(1, 0), 40},
+		{testNight(11, 59), 40},
+	}
+
+	for _, tt := range tests {
+		if got := s.Max(tt.at); got != tt.want {
+			t.Errorf("Max(%s) = %d, want %d", tt.at.Format("15:04"), got, tt.want)
+		}
+	}
+}
+
+func TestVolumeScheduleFadeAcrossMidnight(t *testing.T) {
+	s, err := ParseVolumeSchedule("", "23:55/10m")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		at   time.Time
+		want float64
+	}{
+		{testNight(20, 0), 1},
+		{testNight(23, 55), 1},
+		{testNight(0, 0), 0.5},
+		{testNight(0, 4), 0.1},
+		{testNight(0, 5), 0},
+		{testNight(3, 0), 0},
+		{testNight(13, 0), 1},
+	}
+
+	for _, tt := range tests {
+		if got := s.fade(tt.at); math.Abs(got-tt.want) > 0.0001 {
+			t.Errorf("fade(%s) = %f, want %f", tt.at.Format("15:04"), got, tt.want)
+		}
+	}
+}
+
+func TestVolumeStatus(t *testing.T) {
+	s, err := ParseVolumeSchedule("23:00=60", "02:00/10m")
+	if err != nil {
+		t.Fatal(err)
+	}
+	v := &Volume{schedule: s, max: 80, step: 5, wanted: 70, level: -1}
+
+	tests := []struct {
+		at   time.Time
+		want VolumeStatus
+	}{
+		{testNight(22, 0), VolumeStatus{Level: 70, Wanted: 70}},
+		{testNight(23, 0), VolumeStatus{Level: 60, Wanted: 70}},
+		{testNight(2, 5), VolumeStatus{Level: 30, Wanted: 70, Fading: true}},
+		{testNight(2, 10), VolumeStatus{Level: 0, Wanted: 70, Fading: true}},
+	}
+
+	for _, tt := range tests {
+		if got := v.status(tt.at); *got != tt.want {
+			t.Errorf("status(%s) = %+v, want %+v", tt.at.Format("15:04"), *got, tt.want)
+		}
+	}
+}
+
+func TestVolumeChange(t *testing.T) {
+	s, err := ParseVolumeSchedule("", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	v := &Volume{schedule: s, max: 80, step: 5, wanted: 70, level: -1}
+
+	steps := []struct {
+		up   bool
+		want int
+	}{
+		{true, 75},
+		{true, 80},
+		// never over the safe maximum
+		{true, 80},
+		{false, 75},
+	}
+	for i, step := range steps {
+		if step.up {
+			v.Up()
+		} else {
+			v.Down()
+		}
+		if v.wanted != step.want {
+			t.Errorf("step %d: wanted %d, want %d", i, v.wanted, step.want)
+		}
+	}
+
+	v.wanted = 3
+	v.Down()
+	if v.wanted != 0 {
+		t.Errorf("turned down to %d", v.wanted)
+	}
+}
+
+func TestVolumeWhilePlaying(t *testing.T) {
+	p, fake, _ := testPlayer(t, false)
+	s, err := ParseVolumeSchedule("", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	v := NewVolume(ctx, p, s, 40, 80, 5)
+
+	if err := p.QueueAdd(testTrack("spotify:track:queued1", 60)); err != nil {
+		t.Fatal(err)
+	}
+	waitForTrack(t, p, "spotify:track:queued1")
+
+	// the volume is set on the device the monitor found, while it follows the track
+	v.Up()
+	timeout := time.After(5 * time.Second)
+	for {
+		select {
+		case status := <-v.Events:
+			if status.Level != 45 {
+				continue
+			}
+		case <-p.TrackEvents:
+			continue
+		case <-timeout:
+			t.Fatal("the volume never changed")
+		}
+		break
+	}
+
+	state, err := fake.PlayerState()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if state.Device.Volume != 45 {
+		t.Errorf("the device is at %d%%, want 45%%", state.Device.Volume)
+	}
+}
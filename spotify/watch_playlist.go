@@ -1,6 +1,7 @@
 package spotify
 
 import (
+	"context"
 	"time"
 
 	"github.com/nollbit/spotify"
@@ -11,8 +12,9 @@ const (
 	pollInterval = 5 * time.Second
 )
 
-// WatchPlaylist subscribes to changes to a playlist
-func WatchPlaylist(client *spotify.Client, playlistID spotify.ID, changes chan *spotify.FullPlaylist) error {
+// WatchPlaylist subscribes to changes to a playlist. Polling goes through the
+// guard, and backs off when it fails. It stops when the context is done.
+func WatchPlaylist(ctx context.Context, client *spotify.Client, guard *Guard, playlistID spotify.ID, changes chan *spotify.FullPlaylist) error {
 	log.Debugf("Setting up playlist watch for %s", playlistID)
 
 	plLog := log.WithField("id", playlistID)
@@ -21,24 +23,42 @@ func WatchPlaylist(client *spotify.Client, playlistID spotify.ID, changes chan *
 		// we can compare snapshot IDs to see if the playlist has changed.
 		// setting it to empty string guarantees that we'll send out an initial message with the full playlist
 		latestSnapshotID := ""
+		failures := 0
 
 		for {
 			plLog.Debug("Polling playlist")
 
-			playlist, err := client.GetPlaylist(playlistID)
+			var playlist *spotify.FullPlaylist
+			err := guard.Call(func() (err error) {
+				playlist, err = client.GetPlaylist(playlistID)
+				return err
+			})
 
 			if err != nil {
-				plLog.WithError(err).Warn("Unable to poll playlist")
+				delay := guard.Delay(failures)
+				plLog.WithError(err).Warnf("Unable to poll playlist, trying again in %s", delay.Round(time.Millisecond))
+				failures++
+				if !sleep(ctx, delay) {
+					return
+				}
 				continue
 			}
+			failures = 0
 
 			if playlist.SnapshotID != latestSnapshotID {
 				plLog.Debugf("New snapshot %s for playlist %s", playlist.SnapshotID, playlistID)
-				changes <- playlist
+				select {
+				case changes <- playlist:
+				case <-ctx.Done():
+					return
+				}
 				latestSnapshotID = playlist.SnapshotID
 			}
 
-			time.Sleep(pollInterval)
+			if !sleep(ctx, pollInterval) {
+				plLog.Debug("Stopped watching playlist")
+				return
+			}
 		}
 	}()
 
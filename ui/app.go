@@ -0,0 +1,706 @@
+package ui
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	termui "github.com/gizak/termui/v3"
+	sp "github.com/nollbit/spotify"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/nollbit/musikmaskinen/albumart"
+	"github.com/nollbit/musikmaskinen/controller"
+	"github.com/nollbit/musikmaskinen/dedication"
+	"github.com/nollbit/musikmaskinen/session"
+	"github.com/nollbit/musikmaskinen/spotify"
+)
+
+// App runs the terminal UI. It feeds player, playlist and controller events in
+// to the view model and redraws the view.
+type App struct {
+	player     *spotify.Player
+	playlist   *spotify.CuratedPlaylist
+	controller *controller.Controller
+	ledMapping controller.LedMapping
+
+	// Recorder records all input when set
+	Recorder *session.Recorder
+	// Banner picks the text of the header
+	Banner *Banner
+	// ArtCache fetches album art, no art is shown without it
+	ArtCache *albumart.Cache
+	// Dedications has the messages guests attached to tracks, none are shown without it
+	Dedications *dedication.Board
+	// Volume turns the volume up and down, it can't be changed without it
+	Volume *spotify.Volume
+
+	replayer    *session.Replayer
+	replaySpeed float64
+	fakeBackend *spotify.FakeBackend
+
+	view  *View
+	model *ViewModel
+
+	artResults chan artResult
+	// the track the album art is for
+	artTrackID sp.ID
+
+	attract *AttractScreen
+	idle    idleTimer
+
+	width, height int
+	// non-nil while the LED is showing the reconnect state
+	ledRestoreTimer <-chan time.Time
+	// non-nil while a notice about someone else taking over is shown
+	externalClearTimer <-chan time.Time
+}
+
+// NewApp creates the UI for a player
+func NewApp(player *spotify.Player, playlist *spotify.CuratedPlaylist, cntrl *controller.Controller, ledMapping controller.LedMapping, theme *Theme, font *BannerFont, locale *Locale, maxQueueSize int) *App {
+	// the default slides always parse
+	banner, _ := NewBanner(DefaultBannerConfig())
+
+	return &App{
+		player:     player,
+		playlist:   playlist,
+		controller: cntrl,
+		ledMapping: ledMapping,
+		Banner:     banner,
+		view:       NewView(theme, font, locale),
+		artResults: make(chan artResult),
+
+		attract: NewAttractScreen(theme, font, locale),
+		idle:    idleTimer{after: *attractAfterFlag, lastActivity: time.Now()},
+		model:   NewViewModel(maxQueueSize, FilterFromFlags()),
+	}
+}
+
+// Replay feeds a recorded session in to the app instead of a real controller.
+// The playlists in the session are added to the fake backend.
+func (a *App) Replay(replayer *session.Replayer, fakeBackend *spotify.FakeBackend, speed float64) {
+	a.replayer = replayer
+	a.fakeBackend = fakeBackend
+	a.replaySpeed = speed
+}
+
+// SetEnergyCurve marks queued tracks with too much or too little energy for
+// when they start, and lets the track list be sorted by it. Needs audio
+// features.
+func (a *App) SetEnergyCurve(c *EnergyCurve) {
+	a.model.EnergyCurve = c
+}
+
+func (a *App) volumeUp() {
+	if a.Volume != nil {
+		a.Volume.Up()
+	}
+}
+
+func (a *App) volumeDown() {
+	if a.Volume != nil {
+		a.Volume.Down()
+	}
+}
+
+// volumeEvents returns the volume events, or nil if there's no volume control
+func (a *App) volumeEvents() chan *spotify.VolumeStatus {
+	if a.Volume == nil {
+		return nil
+	}
+	return a.Volume.Events
+}
+
+// picks the LED behaviour that best describes the player right now
+func (a *App) currentLedState() controller.LedState {
+	// an empty queue is idle, even when it's so short that one or two
+	// slots is all there is
+	switch {
+	case a.player.QueueEmpty():
+		return controller.LedStateIdle
+	case a.player.QueueFull():
+		return controller.LedStateQueueFull
+	case a.player.QueueSlotsLeft() == 1:
+		return controller.LedStateQueueOneSlotLeft
+	case a.player.QueueSlotsLeft() == 2:
+		return controller.LedStateQueueAlmostFull
+	case a.player.QueueLen() == 1:
+		return controller.LedStateTrackNext
+	}
+	return controller.LedStateQueueOpen
+}
+
+func (a *App) setLedState(state controller.LedState) {
+	log.Debugf("Setting controller LED state %s", state)
+	err := a.controller.SetLedMode(a.ledMapping[state])
+	if err != nil {
+		log.WithError(err).Errorf("Unable to send command to controller")
+	}
+}
+
+// externalChanged shows a notice when someone else took over playback. When
+// the queue is paused it stays until the queue resumes, otherwise it goes
+// away after a while.
+func (a *App) externalChanged(e *spotify.PlayerExternalStatus) {
+	a.externalClearTimer = nil
+	a.model.External = e
+	if e.Resumed {
+		a.model.External = nil
+	} else if e.Policy != spotify.ExternalPause {
+		a.externalClearTimer = time.After(15 * time.Second)
+	}
+	a.view.Update(a.model)
+}
+
+// triggered whenever the queue or playing track changes
+func (a *App) queueStatusChanged() {
+	a.setLedState(a.currentLedState())
+	a.model.UpdateQueue(a.player)
+	a.updateDedication()
+	a.view.Update(a.model)
+}
+
+// updateDedication tells the dedication board what's queued and shows the
+// dedication of the playing track, if it has an approved one
+func (a *App) updateDedication() {
+	if a.Dedications == nil {
+		return
+	}
+
+	tracks := make([]sp.FullTrack, 0, a.player.QueueLen()+1)
+	if playing := a.player.CurrentlyPlaying(); playing != nil {
+		tracks = append(tracks, *playing)
+	}
+	for _, qt := range a.player.GetQueue() {
+		tracks = append(tracks, qt.Track)
+	}
+	a.Dedications.SetTracks(tracks)
+
+	a.model.Dedication = nil
+	if a.model.Playing != nil {
+		if d, ok := a.Dedications.ForTrack(a.model.Playing.ID); ok {
+			a.model.Dedication = &d
+		}
+	}
+}
+
+// replayDedication does what a guest or a moderator did on the dedication
+// pages in a replayed session
+func (a *App) replayDedication(d *session.DedicationEvent, moderation bool) {
+	if a.Dedications == nil {
+		return
+	}
+
+	var err error
+	if moderation {
+		err = a.Dedications.Moderate(d.ID, d.Approve)
+	} else {
+		_, err = a.Dedications.Submit(d.TrackID, d.From, d.Message)
+	}
+	if err != nil {
+		log.WithError(err).Debug("Replayed dedication was turned down")
+	}
+
+	a.updateDedication()
+	a.view.Update(a.model)
+}
+
+// bannerData is what the banner slides can show right now
+func (a *App) bannerData() BannerData {
+	data := BannerData{
+		QueueLen:       a.player.QueueLen(),
+		QueueSlotsLeft: a.player.QueueSlotsLeft(),
+		QueueFull:      a.player.QueueFull(),
+		Now:            time.Now(),
+		locale:         a.view.locale,
+	}
+
+	if track := a.player.CurrentlyPlaying(); track != nil {
+		data.Playing = true
+		data.Artist = formatArtists(track.Artists)
+		data.Title = track.Name
+	}
+
+	if d := a.model.Dedication; d != nil {
+		data.Dedication = d.Message
+		data.DedicationFrom = d.From
+	}
+
+	if queue := a.player.GetQueue(); len(queue) > 0 {
+		next := queue[0].Track
+		data.NextUp = fmt.Sprintf("%s - %s", formatArtists(next.Artists), next.Name)
+	}
+
+	return data
+}
+
+// update the header text
+func (a *App) updateHeaderText() {
+	// dedications are approved in the background
+	a.updateDedication()
+	a.model.Header = a.Banner.Text(a.bannerData())
+	a.view.Update(a.model)
+}
+
+// updateArt fetches new album art when the playing track changes
+func (a *App) updateArt(ctx context.Context) {
+	if a.view.Art == nil || a.ArtCache == nil {
+		return
+	}
+
+	if a.model.Playing == nil {
+		if a.artTrackID != "" {
+			a.artTrackID = ""
+			a.view.SetArt(nil)
+		}
+		return
+	}
+
+	if a.model.Playing.ID != a.artTrackID {
+		a.artTrackID = a.model.Playing.ID
+		a.view.SetArt(nil)
+		a.fetchArt(ctx, *a.model.Playing)
+	}
+}
+
+func (a *App) updateTracks() {
+	log.Debug("rendering titles")
+	a.keepSelection(func() {
+		a.model.UpdateTracks(a.playlist.Tracks, a.player, a.playlist)
+	})
+}
+
+// keepSelection runs an update of the track list and then selects the same
+// track as before, if it's still listed
+func (a *App) keepSelection(update func()) {
+	selected, hadSelection := a.model.TrackAt(a.view.TrackList.SelectedRow)
+
+	update()
+
+	if hadSelection {
+		if i := a.model.IndexOf(selected.Track.ID); i >= 0 {
+			a.view.TrackList.SelectedRow = i
+		}
+	}
+	a.view.Update(a.model)
+}
+
+// setQuery filters the track list and selects the best match
+func (a *App) setQuery(query string) {
+	f := a.model.Filter
+	f.Query = query
+	a.model.SetFilter(f)
+	a.view.TrackList.SelectedRow = 0
+	a.view.Update(a.model)
+}
+
+// nextSource only shows the tracks of the next source, or all tracks after
+// the last one
+func (a *App) nextSource() {
+	names := a.playlist.SourceNames()
+	if len(names) < 2 {
+		return
+	}
+
+	next := names[0]
+	for i, name := range names {
+		if name == a.model.Filter.Source {
+			next = ""
+			if i+1 < len(names) {
+				next = names[i+1]
+			}
+		}
+	}
+
+	a.keepSelection(func() {
+		f := a.model.Filter
+		f.Source = next
+		a.model.SetFilter(f)
+	})
+	if a.view.TrackList.SelectedRow >= len(a.model.Tracks) {
+		a.view.TrackList.SelectedRow = 0
+		a.view.Update(a.model)
+	}
+}
+
+// endSearch clears the query, keeping the selected track selected
+func (a *App) endSearch() {
+	a.model.Searching = false
+	a.keepSelection(func() {
+		f := a.model.Filter
+		f.Query = ""
+		a.model.SetFilter(f)
+	})
+}
+
+// handleSearchKey handles keys while typing a search query
+func (a *App) handleSearchKey(id string) {
+	query := []rune(a.model.Filter.Query)
+
+	switch id {
+	case "<Escape>":
+		a.endSearch()
+	case "<Backspace>", "<C-<Backspace>>":
+		if len(query) > 0 {
+			a.setQuery(string(query[:len(query)-1]))
+		}
+	case "<Enter>":
+		a.queueSelectedTrack()
+		a.endSearch()
+	case "<Down>":
+		a.moveSelection(1)
+	case "<Up>":
+		a.moveSelection(-1)
+	case "<Space>":
+		a.setQuery(string(query) + " ")
+	default:
+		if isTextKey(id) {
+			a.setQuery(string(query) + id)
+		}
+	}
+}
+
+// moveSelection moves the selection in the track list up (-1) or down (1)
+func (a *App) moveSelection(direction int) {
+	if direction > 0 {
+		a.view.TrackList.ScrollDown()
+	} else {
+		a.view.TrackList.ScrollUp()
+	}
+	a.view.UpdateDetail(a.model)
+}
+
+func (a *App) queueSelectedTrack() {
+	row, ok := a.model.TrackAt(a.view.TrackList.SelectedRow)
+	if !ok {
+		return
+	}
+
+	_, isBlacklisted := a.playlist.IsTrackBlacklisted(row.Track.ID)
+	if isBlacklisted {
+		return
+	}
+
+	if a.player.QueueFull() {
+		return
+	}
+
+	a.playlist.BlacklistTrack(row.Track.ID, 60*time.Minute)
+
+	a.player.QueueAdd(row.Track)
+
+	a.updateTracks()
+}
+
+func (a *App) handleControllerCommand(cmd byte) {
+	if err := a.Recorder.RecordController(cmd); err != nil {
+		log.WithError(err).Warn("Unable to record controller event")
+	}
+
+	if a.wake() {
+		// the first touch only wakes the machine up
+		return
+	}
+
+	switch cmd {
+	case controller.EventCmdRotaryEncoderClockwise:
+		a.moveSelection(1)
+	case controller.EventCmdRotaryEncoderCounterClockwise:
+		a.moveSelection(-1)
+	case controller.EventCmdPushButton:
+		a.queueSelectedTrack()
+	case controller.EventCmdSkip:
+		a.player.Skip()
+	case controller.EventCmdVolumeUp:
+		a.volumeUp()
+	case controller.EventCmdVolumeDown:
+		a.volumeDown()
+	}
+}
+
+// handleEvent returns false when it's time to quit
+func (a *App) handleEvent(e termui.Event) bool {
+	if e.Type == termui.KeyboardEvent {
+		if err := a.Recorder.RecordKey(e.ID); err != nil {
+			log.WithError(err).Warn("Unable to record key event")
+		}
+	}
+
+	if e.Type == termui.ResizeEvent {
+		size := e.Payload.(termui.Resize)
+		a.setSize(size.Width, size.Height)
+		termui.Clear()
+		a.render()
+		return true
+	}
+
+	if e.ID == "<C-c>" {
+		return false
+	}
+
+	if e.Type == termui.KeyboardEvent && a.wake() {
+		return true
+	}
+
+	if a.model.Searching {
+		a.handleSearchKey(e.ID)
+		return true
+	}
+
+	switch e.ID {
+	case "q":
+		return false
+	case "f":
+		a.nextSource()
+	case "o":
+		a.keepSelection(func() {
+			f := a.model.Filter
+			f.Sort = f.Sort.NextSort()
+			if f.Sort == SortCurve && a.model.EnergyCurve == nil {
+				f.Sort = f.Sort.NextSort()
+			}
+			a.model.SetFilter(f)
+		})
+	case "/":
+		a.model.Searching = true
+		a.view.Update(a.model)
+	case "d":
+		if !a.player.QueueEmpty() {
+			a.player.QueueRemove()
+		}
+	case "k", "<Down>":
+		a.moveSelection(1)
+	case "j", "<Up>":
+		a.moveSelection(-1)
+	case "<Enter>":
+		a.queueSelectedTrack()
+	case "s":
+		a.player.Skip()
+	case "+", "=":
+		a.volumeUp()
+	case "-":
+		a.volumeDown()
+	}
+
+	return true
+}
+
+func (a *App) setPlaylist(tracks []sp.FullTrack) {
+	if err := a.Recorder.RecordPlaylist(tracks); err != nil {
+		log.WithError(err).Warn("Unable to record playlist")
+	}
+	a.updateTracks()
+}
+
+func (a *App) setSize(width, height int) {
+	a.width, a.height = width, height
+	a.view.SetRect(width, height)
+	a.attract.SetRect(width, height)
+}
+
+// render draws whatever is on screen right now
+func (a *App) render() {
+	if a.idle.attracting {
+		a.attract.Render()
+	} else {
+		a.view.Render()
+	}
+}
+
+// wake notes that someone is using the machine. It returns true if the attract
+// screen was showing.
+func (a *App) wake() bool {
+	if !a.idle.wake(time.Now()) {
+		return false
+	}
+
+	log.Info("Leaving attract mode")
+	termui.Clear()
+	// sixel and kitty art was wiped along with everything else
+	a.view.SetRect(a.width, a.height)
+	a.view.Render()
+	return true
+}
+
+// checkIdle starts the attract screen when nobody has used the machine and
+// nothing has played for a while
+func (a *App) checkIdle() {
+	busy := a.model.Playing != nil || !a.player.QueueEmpty()
+	if !a.idle.check(time.Now(), busy) {
+		return
+	}
+
+	log.Info("Nobody is here, starting attract mode")
+	a.attract.Next(a.model)
+	termui.Clear()
+	a.attract.Render()
+}
+
+// feeds the replayed session into the controller and terminal event streams
+func (a *App) replaySession(ctx context.Context, uiEvents <-chan termui.Event) <-chan termui.Event {
+	events := make(chan termui.Event)
+
+	go func() {
+		for {
+			select {
+			case b := <-a.replayer.ControllerEvents:
+				select {
+				case a.controller.CommandEvents <- b:
+				case <-ctx.Done():
+					return
+				}
+			case key := <-a.replayer.KeyEvents:
+				select {
+				case events <- termui.Event{Type: termui.KeyboardEvent, ID: key}:
+				case <-ctx.Done():
+					return
+				}
+			case e := <-uiEvents:
+				select {
+				case events <- e:
+				case <-ctx.Done():
+					return
+				}
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	return events
+}
+
+// Run shows the UI until the user quits, the context is done or the controller
+// fails. Shutting down the rest is up to the caller.
+func (a *App) Run(ctx context.Context) error {
+	if err := termui.Init(); err != nil {
+		return err
+	}
+	defer termui.Close()
+
+	a.setSize(termui.TerminalDimensions())
+
+	ticker := time.NewTicker(time.Second / 30).C
+	queueTicker := time.NewTicker(time.Second / 10).C
+	bannerColorTicker := time.NewTicker(time.Second / 5).C
+	// the banner decides itself when to change slides, this keeps countdowns fresh
+	bannerTextTicker := time.NewTicker(time.Second).C
+	bannerScrollTicker := time.NewTicker(time.Second / 15).C
+	attractTicker := time.NewTicker(time.Second * 8).C
+	curatedPlaylistTicker := time.NewTicker(time.Second * 15).C
+
+	a.updateHeaderText()
+	a.queueStatusChanged()
+	a.view.Render()
+
+	uiEvents := termui.PollEvents()
+
+	// only set when replaying a session
+	var replayPlaylists chan []sp.FullTrack
+	var replayDedications, replayModerations chan *session.DedicationEvent
+	var replayDone chan struct{}
+	if a.replayer != nil {
+		uiEvents = a.replaySession(ctx, uiEvents)
+		replayPlaylists = a.replayer.Playlists
+		replayDedications = a.replayer.Dedications
+		replayModerations = a.replayer.Moderations
+		replayDone = a.replayer.Done
+		a.replayer.Play(ctx, a.replaySpeed)
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case controllerCommand := <-a.controller.CommandEvents:
+			a.handleControllerCommand(controllerCommand)
+		case controllerErr := <-a.controller.Errs:
+			return controllerErr
+		case <-a.controller.Reconnects:
+			// show that we're back for a moment, then go back to the queue state
+			a.setLedState(controller.LedStateReconnecting)
+			a.ledRestoreTimer = time.After(3 * time.Second)
+		case <-a.ledRestoreTimer:
+			a.ledRestoreTimer = nil
+			a.setLedState(a.currentLedState())
+		case e := <-uiEvents:
+			if !a.handleEvent(e) {
+				return nil
+			}
+		case <-ticker:
+			if !a.idle.attracting {
+				a.view.Render()
+			}
+		case <-bannerTextTicker:
+			// keeps the Spotify countdown going too
+			a.model.Spotify = a.player.Guard().State()
+			a.updateHeaderText()
+			a.checkIdle()
+		case <-bannerScrollTicker:
+			if a.idle.attracting {
+				a.attract.Headline.Scroll()
+				a.attract.Render()
+			} else {
+				a.view.Header.Scroll()
+				a.view.RenderHeader()
+			}
+		case <-bannerColorTicker:
+			if a.idle.attracting {
+				a.attract.Tick()
+				a.attract.Render()
+			} else {
+				a.view.Header.Tick()
+				a.view.RenderHeader()
+			}
+		case <-attractTicker:
+			if a.idle.attracting {
+				a.attract.Next(a.model)
+			}
+		case e := <-a.player.ExternalEvents:
+			a.externalChanged(e)
+		case v := <-a.volumeEvents():
+			a.model.Volume = v
+			a.view.Update(a.model)
+		case <-a.externalClearTimer:
+			a.externalClearTimer = nil
+			a.model.External = nil
+			a.view.Update(a.model)
+		case <-a.player.QueueEvents:
+			a.queueStatusChanged()
+		case <-queueTicker:
+			a.model.UpdateQueue(a.player)
+			a.view.Update(a.model)
+		case trackEvent := <-a.player.TrackEvents:
+			// the periodic (>1 event per second) player update
+			a.model.UpdatePlaying(trackEvent)
+			if trackEvent.Done {
+				a.queueStatusChanged()
+			} else {
+				// music is playing, get off the attract screen
+				a.wake()
+			}
+			a.updateArt(ctx)
+			a.view.Update(a.model)
+		case result := <-a.artResults:
+			if result.trackID == a.artTrackID {
+				a.view.SetArt(result.image)
+			}
+		case <-a.playlist.Changes:
+			a.setPlaylist(a.playlist.Tracks)
+		case tracks := <-replayPlaylists:
+			a.fakeBackend.AddTracks(tracks)
+			a.playlist.SetTracks(tracks)
+			a.setPlaylist(tracks)
+		case d := <-replayDedications:
+			a.replayDedication(d, false)
+		case d := <-replayModerations:
+			a.replayDedication(d, true)
+		case <-replayDone:
+			log.Info("Replayed the whole session")
+			replayDone = nil
+		case <-curatedPlaylistTicker:
+			// the curated playlist changed
+			a.updateTracks()
+		}
+	}
+}
@@ -0,0 +1,72 @@
+package ui
+
+import (
+	"context"
+	"image"
+	"os"
+	"strings"
+
+	sp "github.com/nollbit/spotify"
+	log "github.com/sirupsen/logrus"
+	"gopkg.in/alecthomas/kingpin.v2"
+
+	mmwidgets "github.com/nollbit/musikmaskinen/widgets"
+)
+
+var (
+	albumArtFlag = kingpin.Flag("album-art", "How to show album art: auto, half-blocks, sixel, kitty or off").Default("auto").Enum("auto", "half-blocks", "sixel", "kitty", "off")
+)
+
+type (
+	// artResult is album art that was fetched in the background
+	artResult struct {
+		trackID sp.ID
+		image   image.Image
+	}
+)
+
+// artModeFromFlags returns how to draw album art, and false if it's turned off
+func artModeFromFlags() (mmwidgets.ArtMode, bool) {
+	switch *albumArtFlag {
+	case "off":
+		return 0, false
+	case "half-blocks":
+		return mmwidgets.ArtModeHalfBlocks, true
+	case "sixel":
+		return mmwidgets.ArtModeSixel, true
+	case "kitty":
+		return mmwidgets.ArtModeKitty, true
+	}
+	return detectArtMode(), true
+}
+
+// detectArtMode guesses what the terminal can do from the environment. Asking
+// the terminal would mean reading its reply behind termui's back.
+func detectArtMode() mmwidgets.ArtMode {
+	term := os.Getenv("TERM")
+	termProgram := os.Getenv("TERM_PROGRAM")
+
+	switch {
+	case os.Getenv("KITTY_WINDOW_ID") != "", strings.Contains(term, "kitty"):
+		return mmwidgets.ArtModeKitty
+	case termProgram == "WezTerm", strings.Contains(term, "mlterm"), strings.Contains(term, "foot"), strings.Contains(term, "sixel"):
+		return mmwidgets.ArtModeSixel
+	}
+	return mmwidgets.ArtModeHalfBlocks
+}
+
+// fetchArt gets the album art of a track in the background. The result is
+// sent on artResults, with a nil image if there isn't any, unless the context
+// is done first.
+func (a *App) fetchArt(ctx context.Context, track sp.FullTrack) {
+	go func() {
+		img, err := a.ArtCache.ForTrack(track)
+		if err != nil {
+			log.WithError(err).Debugf("No album art for %s", track.ID)
+		}
+		select {
+		case a.artResults <- artResult{trackID: track.ID, image: img}:
+		case <-ctx.Done():
+		}
+	}()
+}
@@ -0,0 +1,171 @@
+package ui
+
+import (
+	"math/rand"
+	"time"
+
+	termui "github.com/gizak/termui/v3"
+	"github.com/gizak/termui/v3/widgets"
+	"gopkg.in/alecthomas/kingpin.v2"
+
+	mmwidgets "github.com/nollbit/musikmaskinen/widgets"
+)
+
+var (
+	attractAfterFlag = kingpin.Flag("attract-after", "Show the attract screen after this long without input or music. 0 turns it off.").Default("5m").Duration()
+)
+
+type (
+	// AttractScreen is a full screen animation that's shown when nobody is
+	// using the machine, telling people how to queue songs and showing off
+	// tracks that are waiting to be played
+	AttractScreen struct {
+		Background *mmwidgets.FadedBlock
+		Headline   *mmwidgets.FigletBanner
+		Caption    *widgets.Paragraph
+
+		locale         *Locale
+		headlineHeight int
+		slide          int
+	}
+
+	// idleTimer decides when the attract screen is shown
+	idleTimer struct {
+		// how long it takes, 0 never shows it
+		after time.Duration
+		// the last time someone used the machine or something played
+		lastActivity time.Time
+		attracting   bool
+	}
+)
+
+// NewAttractScreen creates the attract screen widgets. Call SetRect before drawing.
+func NewAttractScreen(theme *Theme, font *BannerFont, locale *Locale) *AttractScreen {
+	s := &AttractScreen{
+		headlineHeight: font.Height + 1,
+		locale:         locale,
+	}
+
+	s.Background = mmwidgets.NewFadedBlock()
+	s.Background.Border = false
+	s.Background.FadeColors = theme.FadeColors()
+
+	s.Headline = mmwidgets.NewFigletBanner()
+	s.Headline.FigletFont = font.Font
+	s.Headline.TextStyle = termui.NewStyle(theme.Palette.Banner)
+	s.Headline.Border = false
+
+	s.Caption = widgets.NewParagraph()
+	s.Caption.TextStyle = termui.NewStyle(theme.Palette.Text, theme.Palette.Background, termui.ModifierBold)
+	s.Caption.WrapText = true
+
+	return s
+}
+
+// SetRect lays out the attract screen on a screen of the given size
+func (s *AttractScreen) SetRect(width, height int) {
+	s.Background.SetRect(0, 0, width, height)
+
+	// the headline and caption in the middle of the screen
+	top := (height - s.headlineHeight - 5) / 2
+	if top < 0 {
+		top = 0
+	}
+	s.Headline.SetRect(0, top, width, top+s.headlineHeight)
+
+	margin := width / 6
+	s.Caption.SetRect(margin, top+s.headlineHeight, width-margin, top+s.headlineHeight+5)
+}
+
+// Next moves on to the next tip, every other one shows off a track that can
+// be queued
+func (s *AttractScreen) Next(m *ViewModel) {
+	l := s.locale
+	tips := []struct {
+		headline, caption string
+	}{
+		{l.T("attract.welcome.headline"), l.T("attract.welcome")},
+		{l.T("attract.turn.headline"), l.T("attract.turn")},
+		{l.T("attract.push.headline"), l.T("attract.push")},
+		{l.N("attract.room.headline", m.MaxQueueSize), l.N("attract.room", m.MaxQueueSize)},
+	}
+
+	s.slide++
+
+	if s.slide%2 == 0 {
+		if track, ok := featuredTrack(m); ok {
+			s.Headline.Text = formatArtists(track.Track.Artists)
+			s.Caption.Text = " " + l.T("attract.featured", formatArtists(track.Track.Artists), track.Track.Name, l.Length(track.Track.Duration/1000))
+			return
+		}
+	}
+
+	tip := tips[(s.slide/2)%len(tips)]
+	s.Headline.Text = tip.headline
+	s.Caption.Text = " " + tip.caption
+}
+
+// featuredTrack picks a random track that can be queued right now
+func featuredTrack(m *ViewModel) (TrackRow, bool) {
+	available := make([]TrackRow, 0, len(m.allTracks))
+	for _, row := range m.allTracks {
+		if row.Status == TrackAvailable {
+			available = append(available, row)
+		}
+	}
+
+	if len(available) == 0 {
+		return TrackRow{}, false
+	}
+	return available[rand.Intn(len(available))], true
+}
+
+// Tick moves the colours of the attract screen
+func (s *AttractScreen) Tick() {
+	s.Background.Tick()
+	s.Headline.Tick()
+}
+
+// Draw draws the attract screen in to a buffer
+func (s *AttractScreen) Draw(buf *termui.Buffer) {
+	s.Background.Draw(buf)
+	s.Headline.Draw(buf)
+	s.Caption.Draw(buf)
+}
+
+// Render draws the attract screen on the terminal
+func (s *AttractScreen) Render() {
+	termui.Render(s.Background, s.Headline, s.Caption)
+}
+
+// wake notes that someone is using the machine. It returns true if the attract
+// screen was showing and should be left.
+func (t *idleTimer) wake(now time.Time) bool {
+	t.lastActivity = now
+
+	if !t.attracting {
+		return false
+	}
+	t.attracting = false
+	return true
+}
+
+// check returns true when it's time to start the attract screen. busy is true
+// while something is playing or queued, which counts as activity.
+func (t *idleTimer) check(now time.Time, busy bool) bool {
+	if t.after <= 0 || t.attracting {
+		return false
+	}
+
+	if busy {
+		t.lastActivity = now
+		return false
+	}
+
+	if now.Sub(t.lastActivity) < t.after {
+		return false
+	}
+
+	t.attracting = true
+	return true
+}
@@ -0,0 +1,122 @@
+package ui
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	sp "github.com/nollbit/spotify"
+)
+
+func TestIdleTimer(t *testing.T) {
+	start := time.Date(2019, 3, 1, 22, 0, 0, 0, time.Local)
+	idle := idleTimer{after: 5 * time.Minute, lastActivity: start}
+
+	steps := []struct {
+		after    time.Duration
+		busy     bool
+		input    bool
+		starts   bool
+		leaves   bool
+		shown    bool
+		describe string
+	}{
+		{4 * time.Minute, false, false, false, false, false, "too early"},
+		// something played for a while
+		{5 * time.Minute, true, false, false, false, false, "playing"},
+		{9 * time.Minute, false, false, false, false, false, "too early after playing"},
+		{10 * time.Minute, false, false, true, false, true, "idle"},
+		{11 * time.Minute, false, false, false, false, true, "already showing"},
+		{12 * time.Minute, false, true, false, true, false, "input"},
+		{16 * time.Minute, false, false, false, false, false, "too early after input"},
+		{16 * time.Minute, false, true, false, false, false, "input while not showing"},
+		{21 * time.Minute, false, false, true, false, true, "idle again"},
+	}
+
+	for _, s := range steps {
+		now := start.Add(s.after)
+		if s.input {
+			if left := idle.wake(now); left != s.leaves {
+				t.Errorf("%s: wake = %v, want %v", s.describe, left, s.leaves)
+			}
+		} else if started := idle.check(now, s.busy); started != s.starts {
+			t.Errorf("%s: check = %v, want %v", s.describe, started, s.starts)
+		}
+		if idle.attracting != s.shown {
+			t.Errorf("%s: attracting = %v, want %v", s.describe, idle.attracting, s.shown)
+		}
+	}
+}
+
+func TestIdleTimerOff(t *testing.T) {
+	start := time.Date(2019, 3, 1, 22, 0, 0, 0, time.Local)
+	idle := idleTimer{lastActivity: start}
+
+	if idle.check(start.Add(24*time.Hour), false) || idle.attracting {
+		t.Error("the attract screen started when it's turned off")
+	}
+}
+
+// testAttractScreen creates an attract screen with the default theme
+func testAttractScreen(t *testing.T) *AttractScreen {
+	theme := DefaultTheme()
+	font, err := theme.LoadFont()
+	if err != nil {
+		t.Fatal(err)
+	}
+	l, err := NewLocale("en")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := NewAttractScreen(theme, font, l)
+	s.SetRect(80, 24)
+	return s
+}
+
+func TestAttractScreenEmptyLibrary(t *testing.T) {
+	s := testAttractScreen(t)
+	m := NewViewModel(5, Filter{})
+
+	tips := make(map[string]bool)
+	for i := 0; i < 8; i++ {
+		s.Next(m)
+		if s.Headline.Text == "" || strings.TrimSpace(s.Caption.Text) == "" {
+			t.Fatalf("slide %d is empty", i)
+		}
+		tips[s.Headline.Text] = true
+	}
+	if len(tips) != 4 {
+		t.Errorf("showed %d different tips, want all 4", len(tips))
+	}
+}
+
+func TestAttractScreenFeaturedTrack(t *testing.T) {
+	s := testAttractScreen(t)
+	m := NewViewModel(5, Filter{})
+
+	duet := testTrack("1", "Abba", "Dancing Queen", "Arrival", 231)
+	duet.Artists = append(duet.Artists, sp.SimpleArtist{Name: "Robyn"})
+	nobody := testTrack("2", "", "Untitled", "Unknown", 60)
+	nobody.Artists = nil
+	queued := testTrack("3", "Kent", "Musik non stop", "Hagnesta Hill", 245)
+
+	for _, tt := range []struct {
+		track    sp.FullTrack
+		headline string
+	}{
+		{duet, "Abba & Robyn"},
+		{nobody, ""},
+	} {
+		m.allTracks = []TrackRow{
+			{Track: tt.track, Status: TrackAvailable},
+			{Track: queued, Status: TrackInQueue},
+		}
+
+		// every other slide shows off a track
+		s.Next(m)
+		s.Next(m)
+		if s.Headline.Text != tt.headline || !strings.Contains(s.Caption.Text, tt.track.Name) {
+			t.Errorf("featured %q / %q, want %q and %s", s.Headline.Text, s.Caption.Text, tt.headline, tt.track.Name)
+		}
+	}
+}
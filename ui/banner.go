@@ -0,0 +1,308 @@
+package ui
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"strings"
+	"text/template"
+	"time"
+
+	"gopkg.in/alecthomas/kingpin.v2"
+)
+
+var (
+	bannerConfigFlag = kingpin.Flag("banner-config", "JSON file with the slides shown in the banner").ExistingFile()
+)
+
+type (
+	// BannerConfig is the list of slides the banner rotates through
+	BannerConfig struct {
+		Slides []BannerSlide `json:"slides"`
+	}
+
+	// BannerSlide is one text shown in the banner.
+	//
+	// Text is a Go template, see BannerData for what it can use, along with
+	// the upper and lower functions. Slides that end up empty are skipped, so
+	// "{{.Artist}}" is only shown while something is playing.
+	//
+	// Duration is how long the slide is shown, e.g. "15s". When is "always"
+	// (the default), "playing", "idle", "queue-open" or "queue-full". From and
+	// To limit the slide to a time of day, e.g. "22:00" to "00:00".
+	BannerSlide struct {
+		Text     string `json:"text"`
+		Duration string `json:"duration"`
+		When     string `json:"when"`
+		From     string `json:"from"`
+		To       string `json:"to"`
+	}
+
+	// BannerData is what the slide templates can show
+	BannerData struct {
+		Artist string
+		Title  string
+		// "Artist - Title" of the next track in the queue
+		NextUp         string
+		Playing        bool
+		QueueLen       int
+		QueueSlotsLeft int
+		QueueFull      bool
+		Now            time.Time
+		// the approved dedication of the playing track and who it's from, if any
+		Dedication     string
+		DedicationFrom string
+		// how countdowns are written, English when nil
+		locale *Locale
+	}
+
+	// Banner decides which slide to show, and when
+	Banner struct {
+		slides  []*bannerSlide
+		current int
+		shownAt time.Time
+	}
+
+	bannerSlide struct {
+		template *template.Template
+		duration time.Duration
+		when     string
+		// minutes after midnight, from < 0 means all day
+		from, to int
+	}
+)
+
+const (
+	defaultSlideDuration = 15 * time.Second
+	fallbackBannerText   = "MUSIKMASKINEN"
+)
+
+var bannerFuncs = template.FuncMap{
+	"upper": strings.ToUpper,
+	"lower": strings.ToLower,
+}
+
+// Until counts down to a time of day like a clock, e.g. {{.Until "00:00"}}
+func (d BannerData) Until(clock string) (string, error) {
+	seconds, err := d.secondsUntil(clock)
+	if err != nil {
+		return "", err
+	}
+	return d.textLocale().Length(seconds), nil
+}
+
+// About says in words roughly how long it is until a time of day, e.g.
+// {{.About "00:00"}}
+func (d BannerData) About(clock string) (string, error) {
+	seconds, err := d.secondsUntil(clock)
+	if err != nil {
+		return "", err
+	}
+	return d.textLocale().About(seconds), nil
+}
+
+func (d BannerData) secondsUntil(clock string) (int, error) {
+	minutes, err := parseClock(clock)
+	if err != nil {
+		return 0, err
+	}
+	return int(untilClock(d.Now, minutes).Seconds()), nil
+}
+
+func (d BannerData) textLocale() *Locale {
+	if d.locale == nil {
+		l, _ := NewLocale("en")
+		return l
+	}
+	return d.locale
+}
+
+// DefaultBannerConfig is the good old MUSIKMASKINEN, RICKARD 40, the playing
+// artist and any dedication of the playing track
+func DefaultBannerConfig() *BannerConfig {
+	return &BannerConfig{
+		Slides: []BannerSlide{
+			{Text: "MUSIKMASKINEN"},
+			{Text: "RICKARD 40"},
+			{Text: "{{.Artist}}", When: "playing"},
+			{Text: "{{.Dedication | upper}}", When: "playing"},
+		},
+	}
+}
+
+// LoadBannerConfig reads a BannerConfig from a JSON file
+func LoadBannerConfig(path string) (*BannerConfig, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	config := &BannerConfig{}
+	err = json.Unmarshal(b, config)
+	if err != nil {
+		return nil, fmt.Errorf("Unable to parse %s: %v", path, err)
+	}
+
+	return config, nil
+}
+
+// BannerFromFlags returns a banner with the slides given by --banner-config,
+// or the default ones
+func BannerFromFlags() (*Banner, error) {
+	config := DefaultBannerConfig()
+	if *bannerConfigFlag != "" {
+		var err error
+		config, err = LoadBannerConfig(*bannerConfigFlag)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return NewBanner(config)
+}
+
+// NewBanner parses the slide templates and schedules
+func NewBanner(config *BannerConfig) (*Banner, error) {
+	if len(config.Slides) == 0 {
+		return nil, errors.New("The banner needs at least one slide")
+	}
+
+	b := &Banner{}
+	for i, s := range config.Slides {
+		t, err := template.New(fmt.Sprintf("slide %d", i+1)).Funcs(bannerFuncs).Parse(s.Text)
+		if err != nil {
+			return nil, err
+		}
+
+		slide := &bannerSlide{
+			template: t,
+			duration: defaultSlideDuration,
+			when:     s.When,
+			from:     -1,
+		}
+
+		if s.Duration != "" {
+			slide.duration, err = time.ParseDuration(s.Duration)
+			if err != nil {
+				return nil, err
+			}
+			if slide.duration <= 0 {
+				return nil, fmt.Errorf("Slide %d needs a positive duration", i+1)
+			}
+		}
+
+		switch s.When {
+		case "", "always", "playing", "idle", "queue-open", "queue-full":
+		default:
+			return nil, fmt.Errorf("Unknown slide condition %q", s.When)
+		}
+
+		if s.From != "" || s.To != "" {
+			slide.from, err = parseClock(s.From)
+			if err != nil {
+				return nil, err
+			}
+			slide.to, err = parseClock(s.To)
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		b.slides = append(b.slides, slide)
+	}
+
+	// start on the first slide
+	b.current = len(b.slides) - 1
+	return b, nil
+}
+
+// Text returns the text to show right now. The slide is changed when it has
+// been shown long enough, or when it can't be shown any more.
+func (b *Banner) Text(data BannerData) string {
+	current := b.slides[b.current]
+	if !b.shownAt.IsZero() && data.Now.Sub(b.shownAt) < current.duration {
+		if text, ok := current.render(data); ok {
+			return text
+		}
+	}
+
+	// find the next slide that has something to say
+	for i := 1; i <= len(b.slides); i++ {
+		index := (b.current + i) % len(b.slides)
+		if text, ok := b.slides[index].render(data); ok {
+			b.current = index
+			b.shownAt = data.Now
+			return text
+		}
+	}
+
+	b.shownAt = data.Now
+	return fallbackBannerText
+}
+
+func (s *bannerSlide) render(data BannerData) (string, bool) {
+	if !s.active(data) {
+		return "", false
+	}
+
+	var buf bytes.Buffer
+	err := s.template.Execute(&buf, data)
+	if err != nil {
+		return "", false
+	}
+
+	text := strings.TrimSpace(buf.String())
+	return text, text != ""
+}
+
+func (s *bannerSlide) active(data BannerData) bool {
+	switch s.when {
+	case "playing":
+		if !data.Playing {
+			return false
+		}
+	case "idle":
+		if data.Playing {
+			return false
+		}
+	case "queue-open":
+		if data.QueueFull {
+			return false
+		}
+	case "queue-full":
+		if !data.QueueFull {
+			return false
+		}
+	}
+
+	if s.from < 0 {
+		return true
+	}
+
+	now := data.Now.Hour()*60 + data.Now.Minute()
+	if s.from <= s.to {
+		return now >= s.from && now < s.to
+	}
+	// the window goes past midnight
+	return now >= s.from || now < s.to
+}
+
+// parseClock turns "HH:MM" into minutes after midnight
+func parseClock(clock string) (int, error) {
+	t, err := time.Parse("15:04", clock)
+	if err != nil {
+		return 0, fmt.Errorf("Bad time of day %q, use HH:MM", clock)
+	}
+	return t.Hour()*60 + t.Minute(), nil
+}
+
+// untilClock is the time left until the next time the clock shows the given minute
+func untilClock(now time.Time, minutes int) time.Duration {
+	midnight := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+	next := midnight.Add(time.Duration(minutes) * time.Minute)
+	if !next.After(now) {
+		next = next.AddDate(0, 0, 1)
+	}
+	return next.Sub(now)
+}
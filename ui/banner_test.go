@@ -0,0 +1,152 @@
+package ui
+
+import (
+	"testing"
+	"time"
+)
+
+func testClock(hour, minute int) time.Time {
+	return time.Date(2019, 3, 1, hour, minute, 0, 0, time.Local)
+}
+
+func TestBannerCountdowns(t *testing.T) {
+	en, _ := NewLocale("en")
+	sv, _ := NewLocale("sv")
+	now := time.Date(2019, 3, 1, 22, 36, 15, 0, time.Local)
+
+	tests := []struct {
+		locale *Locale
+		text   string
+		want   string
+	}{
+		{nil, `{{.Until "23:00"}}`, "23:45"},
+		{en, `{{.Until "00:00"}}`, "1:23:45"},
+		{en, `{{.Until "22:36"}}`, "23:59:45"},
+		{en, `{{.About "00:00"}}`, "~1 hour 24 minutes"},
+		{en, `{{.About "22:37"}}`, "~1 minute"},
+		{en, `{{.About "01:36"}}`, "~3 hours"},
+		{sv, `{{.Until "00:00"}}`, "1:23:45"},
+		{sv, `{{.About "00:00"}}`, "ca 1 timme 24 minuter"},
+		{sv, `{{.About "00:00" | upper}}`, "CA 1 TIMME 24 MINUTER"},
+	}
+
+	for _, tt := range tests {
+		b, err := NewBanner(&BannerConfig{Slides: []BannerSlide{{Text: tt.text}}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := b.Text(BannerData{Now: now, locale: tt.locale}); got != tt.want {
+			t.Errorf("%s = %q, want %q", tt.text, got, tt.want)
+		}
+	}
+}
+
+func TestBannerBadClock(t *testing.T) {
+	b, err := NewBanner(&BannerConfig{Slides: []BannerSlide{{Text: `{{.About "25:00"}}`}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := b.Text(BannerData{Now: time.Now()}); got != fallbackBannerText {
+		t.Errorf("a bad time of day shows %q, want %q", got, fallbackBannerText)
+	}
+}
+
+func TestBannerRotation(t *testing.T) {
+	b, err := NewBanner(&BannerConfig{Slides: []BannerSlide{
+		{Text: "A", Duration: "10s"},
+		{Text: "{{.Artist}}"},
+		{Text: "B"},
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	start := time.Date(2019, 3, 1, 22, 0, 0, 0, time.Local)
+	tests := []struct {
+		after  time.Duration
+		artist string
+		want   string
+	}{
+		{0, "", "A"},
+		{9 * time.Second, "", "A"},
+		// the artist slide is empty when nothing is playing
+		{10 * time.Second, "", "B"},
+		{24 * time.Second, "", "B"},
+		{25 * time.Second, "", "A"},
+		{35 * time.Second, "Abba", "Abba"},
+		{49 * time.Second, "Abba", "Abba"},
+		// the artist stopped playing before its time was up
+		{50 * time.Second, "", "B"},
+	}
+
+	for _, tt := range tests {
+		got := b.Text(BannerData{Now: start.Add(tt.after), Artist: tt.artist})
+		if got != tt.want {
+			t.Errorf("after %s got %q, want %q", tt.after, got, tt.want)
+		}
+	}
+}
+
+func TestBannerSchedule(t *testing.T) {
+	tests := []struct {
+		slide BannerSlide
+		data  BannerData
+		shown bool
+	}{
+		{BannerSlide{When: "always"}, BannerData{}, true},
+		{BannerSlide{When: "playing"}, BannerData{Playing: true}, true},
+		{BannerSlide{When: "playing"}, BannerData{}, false},
+		{BannerSlide{When: "idle"}, BannerData{}, true},
+		{BannerSlide{When: "idle"}, BannerData{Playing: true}, false},
+		{BannerSlide{When: "queue-open"}, BannerData{}, true},
+		{BannerSlide{When: "queue-open"}, BannerData{QueueFull: true}, false},
+		{BannerSlide{When: "queue-full"}, BannerData{QueueFull: true}, true},
+		{BannerSlide{When: "queue-full"}, BannerData{}, false},
+		{BannerSlide{From: "20:00", To: "23:00"}, BannerData{Now: testClock(20, 0)}, true},
+		{BannerSlide{From: "20:00", To: "23:00"}, BannerData{Now: testClock(23, 0)}, false},
+		{BannerSlide{From: "20:00", To: "23:00"}, BannerData{Now: testClock(19, 59)}, false},
+		// past midnight
+		{BannerSlide{From: "22:00", To: "02:00"}, BannerData{Now: testClock(23, 30)}, true},
+		{BannerSlide{From: "22:00", To: "02:00"}, BannerData{Now: testClock(1, 59)}, true},
+		{BannerSlide{From: "22:00", To: "02:00"}, BannerData{Now: testClock(2, 0)}, false},
+		{BannerSlide{From: "22:00", To: "02:00"}, BannerData{Now: testClock(12, 0)}, false},
+		{BannerSlide{When: "playing", From: "22:00", To: "02:00"}, BannerData{Now: testClock(23, 0)}, false},
+	}
+
+	for _, tt := range tests {
+		tt.slide.Text = "shown"
+		b, err := NewBanner(&BannerConfig{Slides: []BannerSlide{tt.slide}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if tt.data.Now.IsZero() {
+			tt.data.Now = testClock(12, 0)
+		}
+
+		want := fallbackBannerText
+		if tt.shown {
+			want = "shown"
+		}
+		if got := b.Text(tt.data); got != want {
+			t.Errorf("%+v with %+v shows %q, want %q", tt.slide, tt.data, got, want)
+		}
+	}
+}
+
+func TestBannerBadConfig(t *testing.T) {
+	tests := []BannerConfig{
+		{},
+		{Slides: []BannerSlide{{Text: "{{.Artist"}}},
+		{Slides: []BannerSlide{{Text: "A", Duration: "long"}}},
+		{Slides: []BannerSlide{{Text: "A", Duration: "0s"}}},
+		{Slides: []BannerSlide{{Text: "A", When: "sometimes"}}},
+		{Slides: []BannerSlide{{Text: "A", From: "22:00"}}},
+		{Slides: []BannerSlide{{Text: "A", From: "22", To: "23:00"}}},
+	}
+
+	for _, tt := range tests {
+		if _, err := NewBanner(&tt); err == nil {
+			t.Errorf("%+v gave no error", tt.Slides)
+		}
+	}
+}
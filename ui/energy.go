@@ -0,0 +1,136 @@
+package ui
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/alecthomas/kingpin.v2"
+)
+
+var (
+	energyCurveFlag = kingpin.Flag("energy-curve", "How much energy the night should have and when, e.g. 20:00=0.4,23:00=0.9,02:00=0.5. Needs --audio-features.").String()
+)
+
+var (
+	ErrorNoAudioFeatures = errors.New("The energy curve needs --audio-features")
+	ErrorNoEnergyCurve   = errors.New("Sorting by the energy curve needs --energy-curve")
+)
+
+const (
+	// how far off the curve a track can be before it's pointed out
+	energyTolerance = 0.25
+)
+
+type (
+	// EnergyCurve is how much energy the music should have over the night.
+	// It goes in a straight line between the points, and stays flat before
+	// the first one and after the last one.
+	EnergyCurve struct {
+		points []energyPoint
+	}
+
+	energyPoint struct {
+		// since midnight, more than 24 hours for points after midnight
+		at     time.Duration
+		energy float64
+	}
+)
+
+// ParseEnergyCurve reads points like 20:00=0.4, separated by commas and in
+// the order they happen. A point with an earlier time than the one before it
+// is the next day.
+func ParseEnergyCurve(s string) (*EnergyCurve, error) {
+	c := &EnergyCurve{points: make([]energyPoint, 0)}
+
+	for _, part := range strings.Split(s, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+
+		kv := strings.SplitN(part, "=", 2)
+		if len(kv) != 2 {
+			return nil, fmt.Errorf("Unable to parse energy curve point %s: expected time=energy", part)
+		}
+
+		clock, err := time.Parse("15:04", strings.TrimSpace(kv[0]))
+		if err != nil {
+			return nil, fmt.Errorf("Unable to parse energy curve time %s: %v", kv[0], err)
+		}
+		energy, err := strconv.ParseFloat(strings.TrimSpace(kv[1]), 64)
+		if err != nil || energy < 0 || energy > 1 {
+			return nil, fmt.Errorf("Unable to parse energy curve energy %s: expected 0 to 1", kv[1])
+		}
+
+		at := time.Duration(clock.Hour())*time.Hour + time.Duration(clock.Minute())*time.Minute
+		if n := len(c.points); n > 0 {
+			for at <= c.points[n-1].at {
+				at += 24 * time.Hour
+			}
+		}
+		c.points = append(c.points, energyPoint{at: at, energy: energy})
+	}
+
+	if len(c.points) == 0 {
+		return nil, fmt.Errorf("Unable to parse energy curve %s: no points", s)
+	}
+	return c, nil
+}
+
+// EnergyCurveFromFlags returns the curve given by --energy-curve, or nil. The
+// curve is about the energy of tracks, so it's an error without audio features.
+func EnergyCurveFromFlags(audioFeatures bool) (*EnergyCurve, error) {
+	if *energyCurveFlag == "" {
+		if TrackSort(*sortFlag) == SortCurve {
+			return nil, ErrorNoEnergyCurve
+		}
+		return nil, nil
+	}
+	if !audioFeatures {
+		return nil, ErrorNoAudioFeatures
+	}
+	return ParseEnergyCurve(*energyCurveFlag)
+}
+
+// Target is the energy the music should have at a time
+func (c *EnergyCurve) Target(t time.Time) float64 {
+	at := time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute + time.Duration(t.Second())*time.Second
+
+	first, last := c.points[0], c.points[len(c.points)-1]
+	// after midnight, on a curve that goes past it. Early in the morning is
+	// after the end of the curve rather than before the start of it.
+	if at < first.at && last.at > 24*time.Hour && at+24*time.Hour-last.at < first.at-at {
+		at += 24 * time.Hour
+	}
+
+	if at <= first.at {
+		return first.energy
+	}
+	for i := 1; i < len(c.points); i++ {
+		a, b := c.points[i-1], c.points[i]
+		if at <= b.at {
+			f := float64(at-a.at) / float64(b.at-a.at)
+			return a.energy + f*(b.energy-a.energy)
+		}
+	}
+	return last.energy
+}
+
+// offCurve tells if an energy is too high (1) or too low (-1) for a time
+func (c *EnergyCurve) offCurve(energy float64, t time.Time) int {
+	if c == nil {
+		return 0
+	}
+
+	diff := energy - c.Target(t)
+	switch {
+	case diff > energyTolerance:
+		return 1
+	case diff < -energyTolerance:
+		return -1
+	}
+	return 0
+}
@@ -0,0 +1,144 @@
+package ui
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/nollbit/musikmaskinen/spotify"
+)
+
+func TestParseEnergyCurve(t *testing.T) {
+	for _, s := range []string{"", " , ", "20:00", "20:00=high", "20:00=1.5", "25:00=0.5", "20:00=0.4,=0.5"} {
+		if _, err := ParseEnergyCurve(s); err == nil {
+			t.Errorf("ParseEnergyCurve(%q) didn't fail", s)
+		}
+	}
+
+	c, err := ParseEnergyCurve(" 20:00=0.4, 23:00=0.9,02:00=0.5 ")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []energyPoint{{20 * time.Hour, 0.4}, {23 * time.Hour, 0.9}, {26 * time.Hour, 0.5}}
+	if !reflect.DeepEqual(c.points, want) {
+		t.Errorf("got points %v, want %v", c.points, want)
+	}
+}
+
+func TestEnergyCurveTarget(t *testing.T) {
+	c, err := ParseEnergyCurve("20:00=0.4,23:00=0.9,02:00=0.5")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		at   time.Time
+		want float64
+	}{
+		{testClock(18, 0), 0.4},
+		{testClock(20, 0), 0.4},
+		{testClock(21, 30), 0.65},
+		{testClock(23, 0), 0.9},
+		{testClock(0, 30), 0.7},
+		{testClock(2, 0), 0.5},
+		{testClock(4, 0), 0.5},
+		{testClock(12, 0), 0.4},
+	}
+
+	for _, tt := range tests {
+		if got := c.Target(tt.at); got < tt.want-0.0001 || got > tt.want+0.0001 {
+			t.Errorf("Target(%s) = %f, want %f", tt.at.Format("15:04"), got, tt.want)
+		}
+	}
+
+	if got := c.offCurve(0.2, testClock(23, 0)); got != -1 {
+		t.Errorf("offCurve(0.2) = %d at 23:00, want -1", got)
+	}
+	if got := c.offCurve(0.8, testClock(23, 0)); got != 0 {
+		t.Errorf("offCurve(0.8) = %d at 23:00, want 0", got)
+	}
+	if got := c.offCurve(0.8, testClock(20, 0)); got != 1 {
+		t.Errorf("offCurve(0.8) = %d at 20:00, want 1", got)
+	}
+	if got := (*EnergyCurve)(nil).offCurve(1, testClock(20, 0)); got != 0 {
+		t.Errorf("offCurve() = %d without a curve", got)
+	}
+}
+
+func TestEnergyCurveFromFlags(t *testing.T) {
+	defer func(curve, sort string) {
+		*energyCurveFlag, *sortFlag = curve, sort
+	}(*energyCurveFlag, *sortFlag)
+
+	tests := []struct {
+		curve, sort   string
+		audioFeatures bool
+		err           error
+		set           bool
+	}{
+		{"", "artist", false, nil, false},
+		{"", "curve", true, ErrorNoEnergyCurve, false},
+		{"20:00=0.4", "artist", false, ErrorNoAudioFeatures, false},
+		{"20:00=0.4", "curve", true, nil, true},
+	}
+
+	for _, tt := range tests {
+		*energyCurveFlag, *sortFlag = tt.curve, tt.sort
+		c, err := EnergyCurveFromFlags(tt.audioFeatures)
+		if err != tt.err || (c != nil) != tt.set {
+			t.Errorf("--energy-curve=%q --sort=%s: got %v, %v", tt.curve, tt.sort, c, err)
+		}
+	}
+}
+
+func TestSortByEnergyCurve(t *testing.T) {
+	energy := func(id string, e float64) TrackRow {
+		return TrackRow{
+			Track:    testTrack(id, "Abba", id, "Arrival", 200),
+			Features: &spotify.Features{Energy: e},
+		}
+	}
+	rows := []TrackRow{
+		energy("1", 0.2),
+		{Track: testTrack("2", "Bob Hund", "2", "Bob Hund", 200)},
+		energy("3", 0.95),
+		energy("4", 0.5),
+		energy("5", 0.7),
+	}
+
+	c, err := ParseEnergyCurve("20:00=0.4,23:00=0.9")
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := NewViewModel(10, Filter{Sort: SortCurve})
+	m.EnergyCurve = c
+
+	// the target is the energy at 21:30, when a track queued now would start
+	target := c.Target(testClock(21, 30))
+	f := Filter{Sort: SortCurve, TargetEnergy: &target}
+	if got, want := rowIDs(f.Apply(rows)), []string{"5", "4", "3", "1", "2"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("sorted by the curve at 21:30: got %v, want %v", got, want)
+	}
+
+	target = c.Target(testClock(23, 0))
+	if got, want := rowIDs(f.Apply(rows)), []string{"3", "5", "4", "1", "2"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("sorted by the curve at 23:00: got %v, want %v", got, want)
+	}
+
+	// without a curve only the tracks without features move, to the end
+	f.TargetEnergy = nil
+	if got, want := rowIDs(f.Apply(rows)), []string{"1", "3", "4", "5", "2"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("sorted by a missing curve: got %v, want %v", got, want)
+	}
+
+	// the model follows the curve from when a queued track would start
+	m.TimeUntilQueued = 3600
+	m.allTracks = rows
+	m.applyFilter()
+	if m.Filter.TargetEnergy == nil {
+		t.Fatal("the model has no target energy")
+	}
+	if want := c.Target(time.Now().Add(time.Hour)); *m.Filter.TargetEnergy < want-0.01 || *m.Filter.TargetEnergy > want+0.01 {
+		t.Errorf("the model targets %f, want %f", *m.Filter.TargetEnergy, want)
+	}
+}
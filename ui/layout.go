@@ -0,0 +1,183 @@
+package ui
+
+import (
+	"math"
+
+	termui "github.com/gizak/termui/v3"
+)
+
+// LayoutClass is the kind of screen the view is laid out for
+type LayoutClass int
+
+const (
+	// LayoutCompact is one column for small and portrait screens, like the
+	// one mounted on the controller
+	LayoutCompact LayoutClass = iota
+	// LayoutNormal is the two column layout the theme describes
+	LayoutNormal
+	// LayoutTV has three columns with room for big album art
+	LayoutTV
+)
+
+const (
+	// compact screens shorter than this don't get a banner
+	compactBannerMinHeight = 30
+	// three lines of text and borders
+	compactTrackInfoRows = 6
+	compactGaugeRows     = 3
+	// a box with borders needs at least this many rows to show anything
+	compactMinBoxRows = 3
+	// the queue gets a quarter, and the track list at least this much
+	compactQueueShare     = 0.25
+	compactMinTracksShare = 0.3
+)
+
+func (c LayoutClass) String() string {
+	switch c {
+	case LayoutCompact:
+		return "compact"
+	case LayoutTV:
+		return "tv"
+	}
+	return "normal"
+}
+
+// layoutClass picks a layout for a screen size using the breakpoints of the theme
+func (l Layout) layoutClass(width, height int) LayoutClass {
+	switch {
+	case width < l.CompactWidth || width < height:
+		// cells are about twice as tall as they're wide, so this is a
+		// screen standing up
+		return LayoutCompact
+	case width >= l.TVWidth && height >= l.TVHeight:
+		return LayoutTV
+	}
+	return LayoutNormal
+}
+
+// layoutGrid creates the grid for a layout class, for a grid that's height rows tall
+func (v *View) layoutGrid(class LayoutClass, height int) *termui.Grid {
+	l := v.layout
+	grid := termui.NewGrid()
+
+	switch class {
+	case LayoutCompact:
+		// no instructions or album art, the track list is what matters. The
+		// track info and progress bar get just the rows they need, and are
+		// left out when there's no room for them.
+		grid.Set(v.compactRows(height)...)
+
+	case LayoutTV:
+		nowPlaying := []interface{}{
+			termui.NewRow(0.25, v.TrackInfo),
+			termui.NewRow(0.1, v.Gauge),
+		}
+		if v.Art != nil {
+			nowPlaying = append(nowPlaying, termui.NewRow(0.65, v.Art))
+		} else {
+			nowPlaying[0] = termui.NewRow(0.9, v.TrackInfo)
+		}
+
+		grid.Set(
+			termui.NewRow(1.0,
+				termui.NewCol(0.4, v.leftColumn()...),
+				termui.NewCol(0.3, v.QueueTable),
+				termui.NewCol(0.3, nowPlaying...),
+			),
+		)
+
+	default:
+		rightColumn := []interface{}{
+			termui.NewRow(l.TrackInfo, v.TrackInfo),
+			termui.NewRow(l.Gauge, v.Gauge), // progress bar for current song
+		}
+		queueHeight := 1 - l.TrackInfo - l.Gauge
+		if v.Art != nil {
+			rightColumn = append(rightColumn, termui.NewRow(l.Art, v.Art))
+			queueHeight -= l.Art
+		}
+		rightColumn = append(rightColumn, termui.NewRow(queueHeight, v.QueueTable))
+
+		grid.Set(
+			termui.NewRow(1.0,
+				// left UI column
+				termui.NewCol(l.LeftColumn, v.leftColumn()...),
+				// right UI column
+				termui.NewCol(1-l.LeftColumn, rightColumn...),
+			),
+		)
+	}
+
+	return grid
+}
+
+// compactRows stacks the track info, the progress bar, the track list and the
+// queue. The track list always gets its share, then the queue, the progress
+// bar and the track info get theirs for as long as there are rows left.
+func (v *View) compactRows(height int) []interface{} {
+	rows := math.Max(float64(height), 1)
+	left := rows - math.Max(compactMinBoxRows, math.Floor(rows*compactMinTracksShare))
+
+	take := func(n float64) float64 {
+		n = math.Max(n, compactMinBoxRows)
+		if n > left {
+			return 0
+		}
+		left -= n
+		return n
+	}
+	queue := take(math.Ceil(rows * compactQueueShare))
+	gauge := take(compactGaugeRows)
+	info := take(compactTrackInfoRows)
+
+	grid := make([]interface{}, 0, 4)
+	if info > 0 {
+		grid = append(grid, termui.NewRow(info/rows, v.TrackInfo))
+	}
+	if gauge > 0 {
+		grid = append(grid, termui.NewRow(gauge/rows, v.Gauge))
+	}
+	grid = append(grid, termui.NewRow((rows-info-gauge-queue)/rows, v.TrackList))
+	if queue > 0 {
+		grid = append(grid, termui.NewRow(queue/rows, v.QueueTable))
+	}
+	return grid
+}
+
+// leftColumn is the instructions, the track list and the details of the
+// selected track
+func (v *View) leftColumn() []interface{} {
+	l := v.layout
+	column := []interface{}{
+		termui.NewRow(l.Usage, v.Usage),
+		termui.NewRow(1-l.Usage-l.Detail, v.TrackList),
+	}
+	if l.Detail > 0 {
+		column = append(column, termui.NewRow(l.Detail, v.Detail))
+	}
+	return column
+}
+
+// resizeQueueColumns drops the duration and then the wait columns when the
+// queue gets too narrow to show them
+func (v *View) resizeQueueColumns() {
+	width := v.QueueTable.Inner.Dx()
+
+	rows := make([][]string, 0, len(v.queueRows))
+	switch {
+	case width >= 40:
+		v.QueueTable.ColumnWidths = []int{width - 17, 6, 7}
+		rows = v.queueRows
+	case width >= 24:
+		v.QueueTable.ColumnWidths = []int{width - 8, 7}
+		for _, row := range v.queueRows {
+			rows = append(rows, []string{row[0], row[2]})
+		}
+	default:
+		v.QueueTable.ColumnWidths = []int{width}
+		for _, row := range v.queueRows {
+			rows = append(rows, []string{row[0]})
+		}
+	}
+	v.QueueTable.Rows = rows
+}
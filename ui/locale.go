@@ -0,0 +1,360 @@
+package ui
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"sort"
+	"strings"
+	"time"
+
+	"gopkg.in/alecthomas/kingpin.v2"
+)
+
+var (
+	localeFlag = kingpin.Flag("locale", "Language of the UI, or a JSON file with messages. Built in: "+strings.Join(LocaleNames(), ", ")).Default("en").String()
+)
+
+type (
+	// Locale is the language of the UI: a catalog of messages and how to
+	// write numbers and durations
+	Locale struct {
+		Name     string             `json:"name"`
+		Messages map[string]Message `json:"messages"`
+		fallback *Locale
+	}
+
+	// Message is a translated text in fmt.Sprintf format. Texts that depend on
+	// a count have one form for exactly one and another for the rest. In JSON
+	// a message is a string, or {"one": ..., "other": ...}.
+	Message struct {
+		One   string `json:"one"`
+		Other string `json:"other"`
+	}
+)
+
+var builtinLocales = map[string]map[string]Message{
+	"en": {
+		"title.instructions":   {Other: "Instruction"},
+		"title.tracks":         {Other: "Tracks"},
+		"title.search":         {Other: "Search: %s_ (%d of %d)"},
+		"title.matching":       {Other: "Tracks matching \"%s\" (%d of %d)"},
+		"title.source":         {Other: "Tracks from %s (%d of %d)"},
+		"title.sorted":         {Other: "Tracks by %s"},
+		"title.queue":          {Other: "Queue"},
+		"title.queue_full":     {Other: "Queue (full)"},
+		"title.current_track":  {Other: "Current Track"},
+		"title.playing":        {Other: "Playing"},
+		"title.volume":         {Other: "Playing, volume %d%%"},
+		"title.volume_limited": {Other: "Playing, volume %d%% (limited)"},
+		"title.volume_fading":  {Other: "Closing time, volume %d%%"},
+		"title.album_art":      {Other: "Album"},
+		"title.details":        {Other: "Selected Track"},
+
+		"queue.duration": {Other: " Dur."},
+		"queue.wait":     {Other: " Wait"},
+
+		"sort.energy":       {Other: "energy"},
+		"sort.curve":        {Other: "the energy curve"},
+		"sort.tempo":        {Other: "tempo"},
+		"sort.danceability": {Other: "danceability"},
+		"sort.key":          {Other: "key"},
+
+		"track.playing":         {Other: "(playing)"},
+		"track.in_queue":        {Other: "(in queue)"},
+		"track.recently_played": {Other: "(recently played)"},
+
+		"info.artist":          {Other: "Artist"},
+		"info.title":           {Other: "Title"},
+		"info.album":           {Other: "Album"},
+		"info.dedication":      {Other: "Message"},
+		"info.dedication_text": {Other: "[\"%s\"](fg:highlight,mod:bold)"},
+		"info.dedication_from": {Other: "[\"%s\"](fg:highlight,mod:bold) from %s"},
+
+		"detail.popularity":       {Other: "Popularity"},
+		"detail.popularity_value": {Other: "%d/100"},
+		"detail.explicit":         {Other: "Explicit"},
+		"detail.source":           {Other: "From"},
+		"detail.feel":             {Other: "Feel"},
+		"detail.feel_value":       {Other: "%.0f BPM, energy %.0f%%, %s"},
+		"detail.major":            {Other: "%s major"},
+		"detail.minor":            {Other: "%s minor"},
+		"detail.unknown_key":      {Other: "unknown key"},
+		"detail.energy_high":      {Other: "[More energy than the night asks for right then](fg:alert)"},
+		"detail.energy_low":       {Other: "[Less energy than the night asks for right then](fg:alert)"},
+		"detail.yes":              {Other: "Yes"},
+		"detail.no":               {Other: "No"},
+		"detail.playing":          {Other: "Playing right now"},
+		"detail.in_queue":         {Other: "Number %d in the queue, starts in [~%s](fg:highlight,mod:bold)"},
+		"detail.recently_played":  {Other: "Played recently, can be queued again at [%s](fg:highlight,mod:bold)"},
+		"detail.queue_full":       {Other: "[The queue is full](fg:alert,mod:bold), wait for a free spot"},
+		"detail.would_start":      {Other: "Would start in [~%s](fg:highlight,mod:bold)"},
+
+		"status.retrying":     {Other: "Having trouble reaching Spotify, retrying"},
+		"status.rate_limited": {Other: "Spotify asked us to slow down, waiting %s"},
+		"status.open":         {Other: "Spotify isn't working, trying again in %s"},
+
+		"external.pause":   {Other: "Someone is playing %s on %s, the queue waits until they're done"},
+		"external.reclaim": {Other: "Someone tried to play %s on %s, took the speakers back"},
+		"external.adopt":   {Other: "%s is playing from %s, the queue continues after it"},
+		"external.device":  {Other: "another device"},
+
+		"instructions.header": {Other: " How to select a song:"},
+		"instructions.step1":  {Other: "  1. Move to the song with the [scroll wheel](fg:highlight,mod:bold)"},
+		"instructions.step2":  {Other: "  2. Push the [blinking button to the right](fg:highlight,mod:bold)"},
+		"instructions.full":   {Other: " [ >>>>>>> The queue is now full. Please wait <<<<<<< ](fg:alert,bg:alert-bg,mod:bold)"},
+		"instructions.limit": {
+			One:   " There can only be [%d](mod:bold) track in the queue. One per person please!",
+			Other: " There can only be [%d](mod:bold) tracks in the queue. One per person please!",
+		},
+
+		"attract.welcome.headline": {Other: "MUSIKMASKINEN"},
+		"attract.welcome":          {Other: "Pick the next song!"},
+		"attract.turn.headline":    {Other: "TURN"},
+		"attract.turn":             {Other: "Turn the [scroll wheel](fg:highlight) to find a song"},
+		"attract.push.headline":    {Other: "PUSH"},
+		"attract.push":             {Other: "Push the [blinking button](fg:highlight) to queue it"},
+		"attract.room.headline":    {One: "%d SONG", Other: "%d SONGS"},
+		"attract.room": {
+			One:   "There's room for [%d](fg:highlight) song in the queue. One per person please!",
+			Other: "There's room for [%d](fg:highlight) songs in the queue. One per person please!",
+		},
+		"attract.featured": {Other: "[%s](fg:artist) - [%s](fg:title) is waiting for you (%s)"},
+
+		"duration.clock":       {Other: "%d:%02d"},
+		"duration.clock_hours": {Other: "%d:%02d:%02d"},
+		"duration.minutes":     {One: "%d minute", Other: "%d minutes"},
+		"duration.hours":       {One: "%d hour", Other: "%d hours"},
+		"duration.about":       {Other: "~%s"},
+		"time.clock":           {Other: "%02d:%02d"},
+	},
+
+	"sv": {
+		"title.instructions":   {Other: "Instruktioner"},
+		"title.tracks":         {Other: "Låtar"},
+		"title.search":         {Other: "Sök: %s_ (%d av %d)"},
+		"title.matching":       {Other: "Låtar som matchar \"%s\" (%d av %d)"},
+		"title.source":         {Other: "Låtar från %s (%d av %d)"},
+		"title.sorted":         {Other: "Låtar efter %s"},
+		"title.queue":          {Other: "Kö"},
+		"title.queue_full":     {Other: "Kö (full)"},
+		"title.current_track":  {Other: "Spelas nu"},
+		"title.playing":        {Other: "Spelar"},
+		"title.volume":         {Other: "Spelar, volym %d%%"},
+		"title.volume_limited": {Other: "Spelar, volym %d%% (begränsad)"},
+		"title.volume_fading":  {Other: "Stängningsdags, volym %d%%"},
+		"title.album_art":      {Other: "Album"},
+		"title.details":        {Other: "Vald låt"},
+
+		"queue.duration": {Other: " Längd"},
+		"queue.wait":     {Other: " Vänta"},
+
+		"sort.energy":       {Other: "energi"},
+		"sort.curve":        {Other: "energikurvan"},
+		"sort.tempo":        {Other: "tempo"},
+		"sort.danceability": {Other: "dansbarhet"},
+		"sort.key":          {Other: "tonart"},
+
+		"track.playing":         {Other: "(spelas)"},
+		"track.in_queue":        {Other: "(i kön)"},
+		"track.recently_played": {Other: "(nyligen spelad)"},
+
+		"info.artist":          {Other: "Artist"},
+		"info.title":           {Other: "Titel"},
+		"info.album":           {Other: "Album"},
+		"info.dedication":      {Other: "Hälsning"},
+		"info.dedication_text": {Other: "[\"%s\"](fg:highlight,mod:bold)"},
+		"info.dedication_from": {Other: "[\"%s\"](fg:highlight,mod:bold) från %s"},
+
+		"detail.popularity":       {Other: "Popularitet"},
+		"detail.popularity_value": {Other: "%d/100"},
+		"detail.explicit":         {Other: "Explicit"},
+		"detail.source":           {Other: "Från"},
+		"detail.feel":             {Other: "Känsla"},
+		"detail.feel_value":       {Other: "%.0f BPM, energi %.0f%%, %s"},
+		"detail.major":            {Other: "%s-dur"},
+		"detail.minor":            {Other: "%s-moll"},
+		"detail.unknown_key":      {Other: "okänd tonart"},
+		"detail.energy_high":      {Other: "[Mer energi än kvällen vill ha just då](fg:alert)"},
+		"detail.energy_low":       {Other: "[Mindre energi än kvällen vill ha just då](fg:alert)"},
+		"detail.yes":              {Other: "Ja"},
+		"detail.no":               {Other: "Nej"},
+		"detail.playing":          {Other: "Spelas just nu"},
+		"detail.in_queue":         {Other: "Nummer %d i kön, börjar om [~%s](fg:highlight,mod:bold)"},
+		"detail.recently_played":  {Other: "Spelades nyss, kan köas igen kl [%s](fg:highlight,mod:bold)"},
+		"detail.queue_full":       {Other: "[Kön är full](fg:alert,mod:bold), vänta på en ledig plats"},
+		"detail.would_start":      {Other: "Skulle börja om [~%s](fg:highlight,mod:bold)"},
+
+		"status.retrying":     {Other: "Har problem att nå Spotify, försöker igen"},
+		"status.rate_limited": {Other: "Spotify bad oss sakta ner, väntar %s"},
+		"status.open":         {Other: "Spotify fungerar inte, försöker igen om %s"},
+
+		"external.pause":   {Other: "Någon spelar %s på %s, kön väntar tills de är klara"},
+		"external.reclaim": {Other: "Någon försökte spela %s på %s, tog tillbaka högtalarna"},
+		"external.adopt":   {Other: "%s spelas från %s, kön fortsätter efter den"},
+		"external.device":  {Other: "en annan enhet"},
+
+		"instructions.header": {Other: " Så väljer du en låt:"},
+		"instructions.step1":  {Other: "  1. Leta upp låten med [skrollhjulet](fg:highlight,mod:bold)"},
+		"instructions.step2":  {Other: "  2. Tryck på [den blinkande knappen till höger](fg:highlight,mod:bold)"},
+		"instructions.full":   {Other: " [ >>>>>>> Kön är full. Vänta lite <<<<<<< ](fg:alert,bg:alert-bg,mod:bold)"},
+		"instructions.limit": {
+			One:   " Det får bara finnas [%d](mod:bold) låt i kön. En per person, tack!",
+			Other: " Det får bara finnas [%d](mod:bold) låtar i kön. En per person, tack!",
+		},
+
+		"attract.welcome.headline": {Other: "MUSIKMASKINEN"},
+		"attract.welcome":          {Other: "Välj nästa låt!"},
+		"attract.turn.headline":    {Other: "VRID"},
+		"attract.turn":             {Other: "Vrid på [skrollhjulet](fg:highlight) för att hitta en låt"},
+		"attract.push.headline":    {Other: "TRYCK"},
+		"attract.push":             {Other: "Tryck på [den blinkande knappen](fg:highlight) för att köa den"},
+		"attract.room.headline":    {One: "%d LÅT", Other: "%d LÅTAR"},
+		"attract.room": {
+			One:   "Det finns plats för [%d](fg:highlight) låt i kön. En per person, tack!",
+			Other: "Det finns plats för [%d](fg:highlight) låtar i kön. En per person, tack!",
+		},
+		"attract.featured": {Other: "[%s](fg:artist) - [%s](fg:title) väntar på dig (%s)"},
+
+		"duration.clock":       {Other: "%d:%02d"},
+		"duration.clock_hours": {Other: "%d:%02d:%02d"},
+		"duration.minutes":     {One: "%d minut", Other: "%d minuter"},
+		"duration.hours":       {One: "%d timme", Other: "%d timmar"},
+		"duration.about":       {Other: "ca %s"},
+		"time.clock":           {Other: "%02d:%02d"},
+	},
+}
+
+// LocaleNames lists the built in locales
+func LocaleNames() []string {
+	names := make([]string, 0, len(builtinLocales))
+	for name := range builtinLocales {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// NewLocale returns a built in locale. Missing messages are taken from English.
+func NewLocale(name string) (*Locale, error) {
+	messages, ok := builtinLocales[name]
+	if !ok {
+		return nil, fmt.Errorf("Unknown locale %q", name)
+	}
+
+	l := &Locale{Name: name, Messages: messages}
+	if name != "en" {
+		l.fallback = &Locale{Name: "en", Messages: builtinLocales["en"]}
+	}
+	return l, nil
+}
+
+// LoadLocale reads messages from a JSON file. The file can name a built in
+// locale in "name" to take the messages it leaves out from.
+func LoadLocale(path string) (*Locale, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	l := &Locale{}
+	err = json.Unmarshal(b, l)
+	if err != nil {
+		return nil, fmt.Errorf("Unable to parse %s: %v", path, err)
+	}
+
+	base := l.Name
+	if _, ok := builtinLocales[base]; !ok {
+		base = "en"
+	}
+	l.fallback, _ = NewLocale(base)
+
+	return l, nil
+}
+
+// LocaleFromFlags returns the locale given by --locale
+func LocaleFromFlags() (*Locale, error) {
+	if _, ok := builtinLocales[*localeFlag]; ok {
+		return NewLocale(*localeFlag)
+	}
+	return LoadLocale(*localeFlag)
+}
+
+// UnmarshalJSON lets messages without plural forms be plain strings
+func (m *Message) UnmarshalJSON(b []byte) error {
+	var s string
+	if err := json.Unmarshal(b, &s); err == nil {
+		m.Other = s
+		return nil
+	}
+
+	type plain Message
+	return json.Unmarshal(b, (*plain)(m))
+}
+
+func (l *Locale) message(key string) Message {
+	if m, ok := l.Messages[key]; ok {
+		return m
+	}
+	if l.fallback != nil {
+		return l.fallback.message(key)
+	}
+	// better than nothing
+	return Message{Other: key}
+}
+
+// T returns a translated message
+func (l *Locale) T(key string, args ...interface{}) string {
+	m := l.message(key)
+	if len(args) == 0 {
+		return m.Other
+	}
+	return fmt.Sprintf(m.Other, args...)
+}
+
+// N returns a translated message in the form for the count n. The count is
+// the first argument to the message.
+func (l *Locale) N(key string, n int, args ...interface{}) string {
+	m := l.message(key)
+
+	form := m.Other
+	// both English and Swedish only have a special form for one
+	if n == 1 && m.One != "" {
+		form = m.One
+	}
+
+	return fmt.Sprintf(form, append([]interface{}{n}, args...)...)
+}
+
+// Length formats a number of seconds like a clock, e.g. 3:20
+func (l *Locale) Length(seconds int) string {
+	if seconds < 0 {
+		seconds = 0
+	}
+	if seconds >= 3600 {
+		return l.T("duration.clock_hours", seconds/3600, seconds/60%60, seconds%60)
+	}
+	return l.T("duration.clock", seconds/60, seconds%60)
+}
+
+// Clock formats the time of day, e.g. 23:45
+func (l *Locale) Clock(t time.Time) string {
+	return l.T("time.clock", t.Hour(), t.Minute())
+}
+
+// About formats a number of seconds roughly, in words, e.g. ~14 minutes
+func (l *Locale) About(seconds int) string {
+	minutes := (seconds + 30) / 60
+
+	var text string
+	switch {
+	case minutes < 60:
+		text = l.N("duration.minutes", minutes)
+	case minutes%60 == 0:
+		text = l.N("duration.hours", minutes/60)
+	default:
+		text = l.N("duration.hours", minutes/60) + " " + l.N("duration.minutes", minutes%60)
+	}
+
+	return l.T("duration.about", text)
+}
@@ -0,0 +1,226 @@
+package ui
+
+import (
+	"time"
+
+	"github.com/nollbit/musikmaskinen/dedication"
+	"github.com/nollbit/musikmaskinen/spotify"
+	sp "github.com/nollbit/spotify"
+)
+
+type (
+	// TrackStatus tells if a track in the list can be queued, and if not, why
+	TrackStatus int
+
+	// PlayerState is what the view model needs to know about the player
+	PlayerState interface {
+		CurrentlyPlaying() *sp.FullTrack
+		IsInQueue(trackID sp.ID) bool
+		GetQueue() []*spotify.QueuedTrack
+		QueueFull() bool
+		TimeUntilQueued() int
+	}
+
+	// Library knows which tracks were queued recently, and where tracks are from
+	Library interface {
+		IsTrackBlacklisted(trackID sp.ID) (time.Time, bool)
+		Sources(trackID sp.ID) []string
+		Features(trackID sp.ID) (spotify.Features, bool)
+	}
+
+	// TrackRow is a row in the track list
+	TrackRow struct {
+		Track  sp.FullTrack
+		Status TrackStatus
+		// when a recently played track can be queued again
+		AvailableAt time.Time
+		// the playlists, albums and artists the track is from
+		Sources []string
+		// nil unless audio features are fetched
+		Features *spotify.Features
+	}
+
+	// QueueRow is a row in the queue table
+	QueueRow struct {
+		Track sp.FullTrack
+		// time in seconds until this tracks starts playing
+		TimeUntilStart int
+		// 1 if it has more energy than the energy curve when it starts, -1 if less
+		OffCurve int
+	}
+
+	// ViewModel is everything the view shows. It's built from player and
+	// playlist events and doesn't know anything about termui.
+	ViewModel struct {
+		Header       string
+		MaxQueueSize int
+		QueueFull    bool
+		// the tracks in the list, after filtering
+		Tracks []TrackRow
+		// how many tracks there are before filtering
+		TotalTracks int
+		Filter      Filter
+		// set while the user is typing a search query
+		Searching bool
+		Queue     []QueueRow
+		// time in seconds until a track queued now would start playing
+		TimeUntilQueued int
+		// nil when nothing is playing
+		Playing *sp.FullTrack
+		// seconds left of the playing track
+		Remaining int
+		// the approved dedication of the playing track, if any
+		Dedication *dedication.Dedication
+		// how requests to Spotify are going
+		Spotify spotify.GuardState
+		// set when someone else took over playback
+		External *spotify.PlayerExternalStatus
+		// how much energy the night should have, nil if it doesn't matter
+		EnergyCurve *EnergyCurve
+		// nil without volume control
+		Volume *spotify.VolumeStatus
+
+		allTracks []TrackRow
+	}
+)
+
+const (
+	TrackAvailable TrackStatus = iota
+	TrackPlaying
+	TrackInQueue
+	TrackRecentlyPlayed
+)
+
+// NewViewModel creates an empty view model
+func NewViewModel(maxQueueSize int, filter Filter) *ViewModel {
+	return &ViewModel{
+		MaxQueueSize: maxQueueSize,
+		Tracks:       make([]TrackRow, 0),
+		Filter:       filter,
+		Queue:        make([]QueueRow, 0),
+		allTracks:    make([]TrackRow, 0),
+	}
+}
+
+// UpdateTracks rebuilds the track list from the curated tracks
+func (m *ViewModel) UpdateTracks(tracks []sp.FullTrack, player PlayerState, library Library) {
+	playing := player.CurrentlyPlaying()
+
+	rows := make([]TrackRow, 0, len(tracks))
+	for _, track := range tracks {
+		row := TrackRow{Track: track, Status: TrackAvailable, Sources: library.Sources(track.ID)}
+		if f, ok := library.Features(track.ID); ok {
+			row.Features = &f
+		}
+
+		if playing != nil && playing.ID == track.ID {
+			row.Status = TrackPlaying
+		} else if player.IsInQueue(track.ID) {
+			row.Status = TrackInQueue
+		} else if until, isBlacklisted := library.IsTrackBlacklisted(track.ID); isBlacklisted {
+			row.Status = TrackRecentlyPlayed
+			row.AvailableAt = until
+		}
+
+		rows = append(rows, row)
+	}
+
+	m.allTracks = rows
+	m.TotalTracks = len(rows)
+	m.applyFilter()
+}
+
+// SetFilter changes the filter and filters the track list again
+func (m *ViewModel) SetFilter(f Filter) {
+	m.Filter = f
+	m.applyFilter()
+}
+
+// applyFilter filters the track list. The energy curve is followed from when
+// a track queued now would start.
+func (m *ViewModel) applyFilter() {
+	m.Filter.TargetEnergy = nil
+	if m.EnergyCurve != nil {
+		target := m.EnergyCurve.Target(time.Now().Add(time.Duration(m.TimeUntilQueued) * time.Second))
+		m.Filter.TargetEnergy = &target
+	}
+	m.Tracks = m.Filter.Apply(m.allTracks)
+}
+
+// IndexOf returns the row of a track in the track list, or -1 if it isn't listed
+func (m *ViewModel) IndexOf(trackID sp.ID) int {
+	for i, row := range m.Tracks {
+		if row.Track.ID == trackID {
+			return i
+		}
+	}
+	return -1
+}
+
+// UpdateQueue rebuilds the queue from the player
+func (m *ViewModel) UpdateQueue(player PlayerState) {
+	queue := player.GetQueue()
+
+	now := time.Now()
+	rows := make([]QueueRow, 0, len(queue))
+	for _, qt := range queue {
+		starts := now.Add(time.Duration(qt.TimeUntilStart) * time.Second)
+		rows = append(rows, QueueRow{
+			Track:          qt.Track,
+			TimeUntilStart: qt.TimeUntilStart,
+			OffCurve:       m.OffCurve(qt.Track.ID, starts),
+		})
+	}
+
+	m.Queue = rows
+	m.QueueFull = player.QueueFull()
+	m.TimeUntilQueued = player.TimeUntilQueued()
+}
+
+// UpdatePlaying sets the playing track from a player track event
+func (m *ViewModel) UpdatePlaying(status *spotify.PlayerTrackStatus) {
+	if status.Done {
+		m.Playing = nil
+		m.Remaining = 0
+		return
+	}
+
+	m.Playing = status.Track
+	m.Remaining = status.Remaining
+}
+
+// OffCurve tells if a track has more energy (1) or less (-1) than the energy
+// curve asks for at a time. It's 0 when it's close enough, or not known.
+func (m *ViewModel) OffCurve(trackID sp.ID, at time.Time) int {
+	if m.EnergyCurve == nil {
+		return 0
+	}
+
+	for _, row := range m.allTracks {
+		if row.Track.ID == trackID {
+			if row.Features == nil {
+				return 0
+			}
+			return m.EnergyCurve.offCurve(row.Features.Energy, at)
+		}
+	}
+	return 0
+}
+
+// QueuePosition returns the position of a track in the queue, or -1 if it isn't queued
+func (m *ViewModel) QueuePosition(trackID sp.ID) int {
+	for i, row := range m.Queue {
+		if row.Track.ID == trackID {
+			return i
+		}
+	}
+	return -1
+}
+
+// TrackAt returns the track on a row in the track list
+func (m *ViewModel) TrackAt(row int) (TrackRow, bool) {
+	if row < 0 || row >= len(m.Tracks) {
+		return TrackRow{}, false
+	}
+	return m.Tracks[row], true
+}
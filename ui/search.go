@@ -0,0 +1,266 @@
+package ui
+
+import (
+	"math"
+	"sort"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"gopkg.in/alecthomas/kingpin.v2"
+
+	"github.com/nollbit/musikmaskinen/spotify"
+)
+
+var (
+	hideRecentlyPlayedFlag = kingpin.Flag("hide-recently-played", "Don't list tracks that were queued recently").Bool()
+	hideQueuedFlag         = kingpin.Flag("hide-queued", "Don't list tracks that are playing or in the queue").Bool()
+	sortFlag               = kingpin.Flag("sort", "How to sort the track list. All but artist need --audio-features, curve needs --energy-curve too.").
+				Default(string(SortArtist)).Enum(string(SortArtist), string(SortEnergy), string(SortCurve), string(SortTempo), string(SortDanceability), string(SortKey))
+	minEnergyFlag = kingpin.Flag("min-energy", "Only list tracks with at least this much energy, 0 to 1. Needs --audio-features.").Float64()
+	maxEnergyFlag = kingpin.Flag("max-energy", "Only list tracks with at most this much energy, 0 to 1. Needs --audio-features.").Float64()
+	minTempoFlag  = kingpin.Flag("min-tempo", "Only list tracks with at least this many beats per minute. Needs --audio-features.").Float64()
+	maxTempoFlag  = kingpin.Flag("max-tempo", "Only list tracks with at most this many beats per minute. Needs --audio-features.").Float64()
+)
+
+// TrackSort is the order of the track list, when there's no query
+type TrackSort string
+
+const (
+	// SortArtist is by artist and title, like the curated playlist
+	SortArtist TrackSort = "artist"
+	// SortEnergy puts the most energetic tracks first
+	SortEnergy TrackSort = "energy"
+	// SortCurve puts the tracks closest to the energy curve first, for when a
+	// track queued now would start
+	SortCurve TrackSort = "curve"
+	// SortTempo puts the fastest tracks first
+	SortTempo TrackSort = "tempo"
+	// SortDanceability puts the most danceable tracks first
+	SortDanceability TrackSort = "danceability"
+	// SortKey goes through the keys from C, which is handy for mixing
+	SortKey TrackSort = "key"
+)
+
+// the order the sort key goes through them
+var trackSorts = []TrackSort{SortArtist, SortEnergy, SortCurve, SortTempo, SortDanceability, SortKey}
+
+// Filter decides which tracks are shown in the track list
+type Filter struct {
+	// Query is fuzzy matched against artist, title and album
+	Query              string
+	HideRecentlyPlayed bool
+	HideQueued         bool
+	// Source only shows the tracks from one playlist, album or artist
+	Source string
+	Sort   TrackSort
+	// 0 is no limit. Tracks without audio features aren't left out.
+	MinEnergy, MaxEnergy float64
+	MinTempo, MaxTempo   float64
+	// the energy SortCurve puts closest first, nil without an energy curve
+	TargetEnergy *float64
+}
+
+// FilterFromFlags returns a filter with the options given on the command line
+func FilterFromFlags() Filter {
+	return Filter{
+		HideRecentlyPlayed: *hideRecentlyPlayedFlag,
+		HideQueued:         *hideQueuedFlag,
+		Sort:               TrackSort(*sortFlag),
+		MinEnergy:          *minEnergyFlag,
+		MaxEnergy:          *maxEnergyFlag,
+		MinTempo:           *minTempoFlag,
+		MaxTempo:           *maxTempoFlag,
+	}
+}
+
+// NextSort returns the sort that comes after this one
+func (s TrackSort) NextSort() TrackSort {
+	for i, sort := range trackSorts {
+		if sort == s {
+			return trackSorts[(i+1)%len(trackSorts)]
+		}
+	}
+	return SortArtist
+}
+
+// inRange checks the audio features against the limits of the filter
+func (f Filter) inRange(features *spotify.Features) bool {
+	if features == nil {
+		return true
+	}
+	outside := func(v, min, max float64) bool {
+		return min > 0 && v < min || max > 0 && v > max
+	}
+	return !outside(features.Energy, f.MinEnergy, f.MaxEnergy) && !outside(features.Tempo, f.MinTempo, f.MaxTempo)
+}
+
+// less orders two rows by the sort of the filter. Tracks without audio
+// features go last.
+func (f Filter) less(a, b TrackRow) bool {
+	if f.Sort == SortArtist || f.Sort == "" {
+		return false
+	}
+	if a.Features == nil || b.Features == nil {
+		return a.Features != nil && b.Features == nil
+	}
+
+	fa, fb := a.Features, b.Features
+	switch f.Sort {
+	case SortEnergy:
+		return fa.Energy > fb.Energy
+	case SortCurve:
+		if f.TargetEnergy == nil {
+			return false
+		}
+		return math.Abs(fa.Energy-*f.TargetEnergy) < math.Abs(fb.Energy-*f.TargetEnergy)
+	case SortTempo:
+		return fa.Tempo > fb.Tempo
+	case SortDanceability:
+		return fa.Danceability > fb.Danceability
+	case SortKey:
+		if fa.Key != fb.Key {
+			return fa.Key < fb.Key
+		}
+		return fa.Mode > fb.Mode
+	}
+	return false
+}
+
+// Apply returns the rows that pass the filter. When there's a query, the best
+// matches come first.
+func (f Filter) Apply(rows []TrackRow) []TrackRow {
+	type scoredRow struct {
+		row   TrackRow
+		score int
+	}
+
+	query := strings.TrimSpace(f.Query)
+
+	scored := make([]scoredRow, 0, len(rows))
+	for _, row := range rows {
+		switch row.Status {
+		case TrackRecentlyPlayed:
+			if f.HideRecentlyPlayed {
+				continue
+			}
+		case TrackPlaying, TrackInQueue:
+			if f.HideQueued {
+				continue
+			}
+		}
+
+		if f.Source != "" && !hasString(row.Sources, f.Source) {
+			continue
+		}
+		if !f.inRange(row.Features) {
+			continue
+		}
+
+		score := 0
+		if query != "" {
+			var ok bool
+			score, ok = matchTrack(query, row)
+			if !ok {
+				continue
+			}
+		}
+
+		scored = append(scored, scoredRow{row: row, score: score})
+	}
+
+	if query != "" {
+		sort.SliceStable(scored, func(i, j int) bool {
+			return scored[i].score > scored[j].score
+		})
+	} else {
+		// the rows come sorted by artist, ties keep that order
+		sort.SliceStable(scored, func(i, j int) bool {
+			return f.less(scored[i].row, scored[j].row)
+		})
+	}
+
+	filtered := make([]TrackRow, 0, len(scored))
+	for _, s := range scored {
+		filtered = append(filtered, s.row)
+	}
+	return filtered
+}
+
+func hasString(list []string, s string) bool {
+	for _, l := range list {
+		if l == s {
+			return true
+		}
+	}
+	return false
+}
+
+// matchTrack matches every word of the query against the artists, title and album
+func matchTrack(query string, row TrackRow) (int, bool) {
+	fields := make([]string, 0, len(row.Track.Artists)+2)
+	for _, artist := range row.Track.Artists {
+		fields = append(fields, artist.Name)
+	}
+	fields = append(fields, row.Track.Name, row.Track.Album.Name)
+
+	total := 0
+	for _, word := range strings.Fields(query) {
+		best := -1
+		for _, field := range fields {
+			if score, ok := fuzzyMatch(word, field); ok && score > best {
+				best = score
+			}
+		}
+		if best < 0 {
+			return 0, false
+		}
+		total += best
+	}
+
+	return total, true
+}
+
+// fuzzyMatch checks if the letters of the pattern appear in order in the text,
+// ignoring case. Letters in a row and letters starting a word score higher.
+func fuzzyMatch(pattern, text string) (int, bool) {
+	p := []rune(strings.ToLower(pattern))
+	t := []rune(strings.ToLower(text))
+
+	score := 0
+	pi := 0
+	lastMatch := -2
+	for ti := 0; ti < len(t) && pi < len(p); ti++ {
+		if t[ti] != p[pi] {
+			continue
+		}
+
+		score++
+		if ti == lastMatch+1 {
+			score += 3
+		} else if ti == 0 || !unicode.IsLetter(t[ti-1]) && !unicode.IsDigit(t[ti-1]) {
+			score += 2
+		}
+
+		lastMatch = ti
+		pi++
+	}
+
+	if pi < len(p) {
+		return 0, false
+	}
+
+	return score, true
+}
+
+// isTextKey tells if a termui key event is a printable character
+func isTextKey(id string) bool {
+	if id == "<Space>" {
+		return true
+	}
+	if utf8.RuneCountInString(id) != 1 {
+		return false
+	}
+	r, _ := utf8.DecodeRuneInString(id)
+	return unicode.IsPrint(r)
+}
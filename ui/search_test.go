@@ -0,0 +1,120 @@
+package ui
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestFuzzyMatch(t *testing.T) {
+	tests := []struct {
+		pattern, text string
+		ok            bool
+	}{
+		{"abba", "Abba", true},
+		{"dq", "Dancing Queen", true},
+		{"qd", "Dancing Queen", false},
+		{"förv", "Istället för musik: förvirring", true},
+		{"", "Kent", true},
+		{"kentt", "Kent", false},
+	}
+
+	for _, tt := range tests {
+		if _, ok := fuzzyMatch(tt.pattern, tt.text); ok != tt.ok {
+			t.Errorf("fuzzyMatch(%q, %q) = %v, want %v", tt.pattern, tt.text, ok, tt.ok)
+		}
+	}
+
+	// letters in a row beat letters spread out, and word starts beat the middle of words
+	better := [][2]string{
+		{"Dancing", "Daft Punk Is Playing"},
+		{"One More Time", "Jon Moore"},
+	}
+	for _, b := range better {
+		s1, _ := fuzzyMatch("dan", b[0])
+		s2, ok := fuzzyMatch("dan", b[1])
+		if ok && s1 <= s2 {
+			t.Errorf("%q scores %d for %q, no better than %d for %q", "dan", s1, b[0], s2, b[1])
+		}
+	}
+	s1, _ := fuzzyMatch("mt", "More Time")
+	s2, _ := fuzzyMatch("mt", "Smart")
+	if s1 <= s2 {
+		t.Errorf("word starts score %d, no better than %d in the middle of words", s1, s2)
+	}
+}
+
+func TestFilterQuery(t *testing.T) {
+	rows := []TrackRow{
+		{Track: testTrack("1", "Abba", "Dancing Queen", "Arrival", 231)},
+		{Track: testTrack("2", "Bob Hund", "Istället för musik: förvirring", "Bob Hund", 198)},
+		{Track: testTrack("3", "Daft Punk", "One More Time", "Discovery", 320)},
+		{Track: testTrack("5", "Robyn", "Dancing On My Own", "Body Talk", 287)},
+	}
+
+	tests := []struct {
+		query string
+		ids   []string
+	}{
+		{"", []string{"1", "2", "3", "5"}},
+		{"  ", []string{"1", "2", "3", "5"}},
+		{"dancing", []string{"1", "5"}},
+		{"robyn dancing", []string{"5"}},
+		{"arrival", []string{"1"}},
+		{"discovry", []string{"3"}},
+		{"bob", []string{"2"}},
+		{"dnc", []string{"1", "5"}},
+		{"zz", []string{}},
+	}
+
+	for _, tt := range tests {
+		got := rowIDs(Filter{Query: tt.query}.Apply(rows))
+		if !reflect.DeepEqual(got, tt.ids) {
+			t.Errorf("query %q: got %v, want %v", tt.query, got, tt.ids)
+		}
+	}
+}
+
+func TestFilterHide(t *testing.T) {
+	rows := []TrackRow{
+		{Track: testTrack("1", "Abba", "Dancing Queen", "Arrival", 231), Status: TrackPlaying, Sources: []string{"Party"}},
+		{Track: testTrack("2", "Bob Hund", "Istället för musik: förvirring", "Bob Hund", 198), Status: TrackInQueue},
+		{Track: testTrack("3", "Daft Punk", "One More Time", "Discovery", 320), Status: TrackRecentlyPlayed, Sources: []string{"Party"}},
+		{Track: testTrack("5", "Robyn", "Dancing On My Own", "Body Talk", 287), Sources: []string{"Party", "Robyn"}},
+	}
+
+	tests := []struct {
+		name   string
+		filter Filter
+		ids    []string
+	}{
+		{"all", Filter{}, []string{"1", "2", "3", "5"}},
+		{"recently played", Filter{HideRecentlyPlayed: true}, []string{"1", "2", "5"}},
+		{"queued", Filter{HideQueued: true}, []string{"3", "5"}},
+		{"source", Filter{Source: "Party"}, []string{"1", "3", "5"}},
+		{"source and query", Filter{Source: "Party", Query: "dancing"}, []string{"1", "5"}},
+		{"everything", Filter{HideRecentlyPlayed: true, HideQueued: true, Source: "Robyn"}, []string{"5"}},
+	}
+
+	for _, tt := range tests {
+		got := rowIDs(tt.filter.Apply(rows))
+		if !reflect.DeepEqual(got, tt.ids) {
+			t.Errorf("%s: got %v, want %v", tt.name, got, tt.ids)
+		}
+	}
+}
+
+func TestIsTextKey(t *testing.T) {
+	for id, want := range map[string]bool{"a": true, "ö": true, "<Space>": true, "<Enter>": false, "<Up>": false, "<C-c>": false} {
+		if got := isTextKey(id); got != want {
+			t.Errorf("isTextKey(%q) = %v, want %v", id, got, want)
+		}
+	}
+}
+
+func rowIDs(rows []TrackRow) []string {
+	ids := make([]string, 0, len(rows))
+	for _, row := range rows {
+		ids = append(ids, string(row.Track.ID))
+	}
+	return ids
+}
@@ -0,0 +1,38 @@
+package ui
+
+import (
+	"image"
+	"strings"
+
+	termui "github.com/gizak/termui/v3"
+)
+
+// DrawToBuffer lays out the view on a screen of the given size and draws it in
+// to a new buffer, without touching the terminal
+func DrawToBuffer(v *View, width, height int) *termui.Buffer {
+	buf := termui.NewBuffer(image.Rect(0, 0, width, height))
+	v.SetRect(width, height)
+	v.Draw(buf)
+	return buf
+}
+
+// Snapshot returns the characters of a buffer, one line per row, with trailing
+// space removed. Styles are ignored. Handy for comparing the UI to golden files.
+func Snapshot(buf *termui.Buffer) string {
+	var sb strings.Builder
+
+	for y := buf.Min.Y; y < buf.Max.Y; y++ {
+		var line strings.Builder
+		for x := buf.Min.X; x < buf.Max.X; x++ {
+			r := buf.GetCell(image.Pt(x, y)).Rune
+			if r == 0 {
+				r = ' '
+			}
+			line.WriteRune(r)
+		}
+		sb.WriteString(strings.TrimRight(line.String(), " "))
+		sb.WriteString("\n")
+	}
+
+	return sb.String()
+}
@@ -0,0 +1,351 @@
+package ui
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"sort"
+	"strconv"
+	"strings"
+
+	termui "github.com/gizak/termui/v3"
+	"github.com/lukesampson/figlet/figletlib"
+	"gopkg.in/alecthomas/kingpin.v2"
+
+	"github.com/nollbit/musikmaskinen/fonts"
+	mmwidgets "github.com/nollbit/musikmaskinen/widgets"
+)
+
+var (
+	themeFlag = kingpin.Flag("theme", "Theme name or JSON theme file. Built in: "+strings.Join(ThemeNames(), ", ")).Default("default").String()
+	fontFlag  = kingpin.Flag("font", "Figlet font (.flf) for the banner, overrides the theme").ExistingFile()
+)
+
+type (
+	// Theme decides colours, layout and the banner font. Colours are 256 color
+	// indexes, -1 is the terminal default.
+	Theme struct {
+		Name string `json:"name"`
+		// Font is a path to a figlet .flf file. Empty means the built in ANSI Shadow.
+		Font    string  `json:"font"`
+		Palette Palette `json:"palette"`
+		// Fade is the banner gradient, as ranges of color indexes with both ends included
+		Fade   [][2]int `json:"fade"`
+		Layout Layout   `json:"layout"`
+	}
+
+	// Palette is the colours of the UI. The markup names are what they're
+	// called in the text of the widgets, e.g. [Title](fg:label).
+	Palette struct {
+		// markup: text
+		Text termui.Color `json:"text"`
+		// markup: artist
+		Artist termui.Color `json:"artist"`
+		// markup: title
+		Title termui.Color `json:"title"`
+		// markup: label
+		Label termui.Color `json:"label"`
+		// markup: highlight
+		Highlight termui.Color `json:"highlight"`
+		// markup: alert and alert-bg
+		Alert      termui.Color `json:"alert"`
+		AlertBg    termui.Color `json:"alert_bg"`
+		Background termui.Color `json:"background"`
+		Banner     termui.Color `json:"banner"`
+		List       termui.Color `json:"list"`
+		SelectedFg termui.Color `json:"selected_fg"`
+		SelectedBg termui.Color `json:"selected_bg"`
+		Gauge      termui.Color `json:"gauge"`
+		Border     termui.Color `json:"border"`
+		BorderText termui.Color `json:"border_text"`
+	}
+
+	// Layout is the proportions of the grid below the banner
+	Layout struct {
+		// width of the left column, the right column gets the rest
+		LeftColumn float64 `json:"left_column"`
+		// heights of the instructions and the details of the selected track,
+		// the track list gets the rest. A detail height of 0 hides the details.
+		Usage  float64 `json:"usage"`
+		Detail float64 `json:"detail"`
+		// heights of the track info and progress bar, the queue gets the rest
+		TrackInfo float64 `json:"track_info"`
+		Gauge     float64 `json:"gauge"`
+		// height of the album art, taken from the queue
+		Art float64 `json:"art"`
+
+		// screens narrower than this get the compact one column layout
+		CompactWidth int `json:"compact_width"`
+		// screens at least this big get the three column TV layout
+		TVWidth  int `json:"tv_width"`
+		TVHeight int `json:"tv_height"`
+	}
+
+	// BannerFont is a figlet font and how many rows it's tall
+	BannerFont struct {
+		*figletlib.Font
+		Height int
+	}
+)
+
+var builtinThemes = map[string]func() *Theme{
+	"default":       DefaultTheme,
+	"high-contrast": highContrastTheme,
+	"amber":         amberTheme,
+	"ocean":         oceanTheme,
+}
+
+// ThemeNames lists the built in themes
+func ThemeNames() []string {
+	names := make([]string, 0, len(builtinThemes))
+	for name := range builtinThemes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// DefaultTheme is the original musikmaskinen look
+func DefaultTheme() *Theme {
+	return &Theme{
+		Name: "default",
+		Palette: Palette{
+			Text:       termui.ColorWhite,
+			Artist:     termui.ColorWhite,
+			Title:      termui.ColorYellow,
+			Label:      termui.ColorBlue,
+			Highlight:  termui.ColorYellow,
+			Alert:      termui.ColorWhite,
+			AlertBg:    termui.ColorRed,
+			Background: termui.ColorBlack,
+			Banner:     40,
+			List:       termui.ColorYellow,
+			SelectedFg: termui.ColorBlack,
+			SelectedBg: termui.ColorYellow,
+			Gauge:      termui.ColorBlue,
+			Border:     termui.ColorWhite,
+			BorderText: termui.ColorWhite,
+		},
+		Fade: [][2]int{{16, 50}, {195, 162}, {50, 159}, {50, 16}},
+		Layout: Layout{
+			LeftColumn: 0.6,
+			Usage:      0.2,
+			Detail:     0.2,
+			TrackInfo:  0.2,
+			Gauge:      0.1,
+			Art:        0.3,
+
+			CompactWidth: 80,
+			TVWidth:      160,
+			TVHeight:     50,
+		},
+	}
+}
+
+// for projectors and people who forgot their glasses
+func highContrastTheme() *Theme {
+	t := DefaultTheme()
+	t.Name = "high-contrast"
+	t.Palette = Palette{
+		Text:       231,
+		Artist:     231,
+		Title:      226,
+		Label:      51,
+		Highlight:  226,
+		Alert:      16,
+		AlertBg:    226,
+		Background: 16,
+		Banner:     231,
+		List:       231,
+		SelectedFg: 16,
+		SelectedBg: 226,
+		Gauge:      226,
+		Border:     231,
+		BorderText: 226,
+	}
+	// a fade is hard to read, keep the banner white
+	t.Fade = [][2]int{{231, 231}}
+	return t
+}
+
+func amberTheme() *Theme {
+	t := DefaultTheme()
+	t.Name = "amber"
+	t.Palette = Palette{
+		Text:       214,
+		Artist:     220,
+		Title:      208,
+		Label:      130,
+		Highlight:  220,
+		Alert:      16,
+		AlertBg:    208,
+		Background: 16,
+		Banner:     214,
+		List:       214,
+		SelectedFg: 16,
+		SelectedBg: 214,
+		Gauge:      208,
+		Border:     130,
+		BorderText: 214,
+	}
+	t.Fade = [][2]int{{52, 58}, {94, 100}, {130, 136}, {166, 172}, {202, 208}, {214, 220}, {220, 214}, {208, 202}, {172, 166}, {136, 130}, {100, 94}, {58, 52}}
+	return t
+}
+
+func oceanTheme() *Theme {
+	t := DefaultTheme()
+	t.Name = "ocean"
+	t.Palette = Palette{
+		Text:       153,
+		Artist:     195,
+		Title:      87,
+		Label:      33,
+		Highlight:  87,
+		Alert:      231,
+		AlertBg:    125,
+		Background: 17,
+		Banner:     45,
+		List:       117,
+		SelectedFg: 17,
+		SelectedBg: 87,
+		Gauge:      33,
+		Border:     25,
+		BorderText: 117,
+	}
+	t.Fade = [][2]int{{17, 21}, {27, 33}, {39, 45}, {51, 51}, {45, 39}, {33, 27}, {21, 17}}
+	t.Layout.LeftColumn = 0.55
+	return t
+}
+
+// LoadTheme reads a theme from a JSON file. Anything left out of the file is
+// taken from the default theme.
+func LoadTheme(path string) (*Theme, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	theme := DefaultTheme()
+	theme.Name = path
+	err = json.Unmarshal(b, theme)
+	if err != nil {
+		return nil, fmt.Errorf("Unable to parse %s: %v", path, err)
+	}
+
+	return theme, theme.validate()
+}
+
+// ThemeFromFlags returns the theme given by --theme, with the font given by --font
+func ThemeFromFlags() (*Theme, error) {
+	var theme *Theme
+	if builtin, ok := builtinThemes[*themeFlag]; ok {
+		theme = builtin()
+	} else {
+		var err error
+		theme, err = LoadTheme(*themeFlag)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if *fontFlag != "" {
+		theme.Font = *fontFlag
+	}
+
+	return theme, nil
+}
+
+func (t *Theme) validate() error {
+	l := t.Layout
+	if l.LeftColumn <= 0 || l.LeftColumn >= 1 {
+		return errors.New("Theme left column must be between 0 and 1")
+	}
+	if l.Usage <= 0 || l.Usage >= 1 {
+		return errors.New("Theme usage height must be between 0 and 1")
+	}
+	if l.Detail < 0 || l.Usage+l.Detail >= 1 {
+		return errors.New("Theme usage and detail must leave room for the track list")
+	}
+	if l.TrackInfo <= 0 || l.Gauge <= 0 || l.Art < 0 || l.TrackInfo+l.Gauge+l.Art >= 1 {
+		return errors.New("Theme track info, gauge and album art must leave room for the queue")
+	}
+	p := t.Palette
+	colors := map[string]termui.Color{
+		"text": p.Text, "artist": p.Artist, "title": p.Title, "label": p.Label,
+		"highlight": p.Highlight, "alert": p.Alert, "alert_bg": p.AlertBg,
+		"background": p.Background, "banner": p.Banner, "list": p.List,
+		"selected_fg": p.SelectedFg, "selected_bg": p.SelectedBg, "gauge": p.Gauge,
+		"border": p.Border, "border_text": p.BorderText,
+	}
+	for name, c := range colors {
+		if c < -1 || c > 255 {
+			return fmt.Errorf("Theme colour %s is %d, use 0-255 or -1 for the terminal default", name, c)
+		}
+	}
+	for _, r := range t.Fade {
+		if r[0] < 0 || r[0] > 255 || r[1] < 0 || r[1] > 255 {
+			return fmt.Errorf("Theme fade range %v is outside 0-255", r)
+		}
+	}
+	return nil
+}
+
+// FadeColors is the banner gradient of the theme
+func (t *Theme) FadeColors() []termui.Color {
+	if len(t.Fade) == 0 {
+		return mmwidgets.DefaultFadeColors()
+	}
+	return mmwidgets.FadeColorRanges(t.Fade)
+}
+
+// LoadFont loads the banner font of the theme
+func (t *Theme) LoadFont() (*BannerFont, error) {
+	if t.Font == "" {
+		return parseBannerFont([]byte(fonts.AnsiShadow))
+	}
+
+	b, err := ioutil.ReadFile(t.Font)
+	if err != nil {
+		return nil, err
+	}
+	return parseBannerFont(b)
+}
+
+func parseBannerFont(b []byte) (*BannerFont, error) {
+	font, err := figletlib.ReadFontFromBytes(b)
+	if err != nil {
+		return nil, err
+	}
+
+	// the font keeps the height to itself, read it from the header:
+	// flf2a$ <height> <baseline> ...
+	header := strings.Fields(strings.SplitN(string(b), "\n", 2)[0])
+	if len(header) < 2 {
+		return nil, errors.New("Bad figlet font header")
+	}
+	height, err := strconv.Atoi(header[1])
+	if err != nil || height < 1 {
+		return nil, errors.New("Bad figlet font height")
+	}
+
+	return &BannerFont{Font: font, Height: height}, nil
+}
+
+// Apply makes the palette available as markup colours and sets the default
+// block styles. Call it before creating any widgets.
+func (t *Theme) Apply() {
+	p := t.Palette
+	termui.StyleParserColorMap["text"] = p.Text
+	termui.StyleParserColorMap["artist"] = p.Artist
+	termui.StyleParserColorMap["title"] = p.Title
+	termui.StyleParserColorMap["label"] = p.Label
+	termui.StyleParserColorMap["highlight"] = p.Highlight
+	termui.StyleParserColorMap["alert"] = p.Alert
+	termui.StyleParserColorMap["alert-bg"] = p.AlertBg
+
+	termui.Theme.Block.Border = termui.NewStyle(p.Border)
+	termui.Theme.Block.Title = termui.NewStyle(p.BorderText)
+	termui.Theme.Paragraph.Text = termui.NewStyle(p.Text)
+	termui.Theme.Table.Text = termui.NewStyle(p.Text)
+}
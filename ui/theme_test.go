@@ -0,0 +1,139 @@
+package ui
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	termui "github.com/gizak/termui/v3"
+
+	"github.com/nollbit/musikmaskinen/fonts"
+)
+
+// testThemeDir writes files to a temporary directory
+func testThemeDir(t *testing.T, files map[string]string) (string, func()) {
+	dir, err := ioutil.TempDir("", "theme")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, content := range files {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir, func() { os.RemoveAll(dir) }
+}
+
+func TestThemeFromFlags(t *testing.T) {
+	dir, done := testThemeDir(t, map[string]string{
+		"pink.json":        `{"palette": {"title": 205, "border": -1}, "fade": [[200, 207]], "layout": {"left_column": 0.5}}`,
+		"broken.json":      `{"palette": {"title": 205`,
+		"named.json":       `{"palette": {"title": "pink"}}`,
+		"bad-colour.json":  `{"palette": {"title": 256}}`,
+		"bad-default.json": `{"palette": {"border": -2}}`,
+		"bad-fade.json":    `{"fade": [[0, 300]]}`,
+		"bad-layout.json":  `{"layout": {"track_info": 0.5, "gauge": 0.5}}`,
+	})
+	defer done()
+
+	pink := DefaultTheme()
+	pink.Name = filepath.Join(dir, "pink.json")
+	pink.Palette.Title = 205
+	pink.Palette.Border = termui.ColorClear
+	pink.Fade = [][2]int{{200, 207}}
+	pink.Layout.LeftColumn = 0.5
+
+	withFont := oceanTheme()
+	withFont.Font = "my.flf"
+
+	tests := []struct {
+		theme, font string
+		want        *Theme
+		wantErr     bool
+	}{
+		{"default", "", DefaultTheme(), false},
+		{"amber", "", amberTheme(), false},
+		{"ocean", "my.flf", withFont, false},
+		{filepath.Join(dir, "pink.json"), "", pink, false},
+		{filepath.Join(dir, "missing.json"), "", nil, true},
+		{"pink", "", nil, true},
+		{filepath.Join(dir, "broken.json"), "", nil, true},
+		{filepath.Join(dir, "named.json"), "", nil, true},
+		{filepath.Join(dir, "bad-colour.json"), "", nil, true},
+		{filepath.Join(dir, "bad-default.json"), "", nil, true},
+		{filepath.Join(dir, "bad-fade.json"), "", nil, true},
+		{filepath.Join(dir, "bad-layout.json"), "", nil, true},
+	}
+
+	defer func(theme, font string) { *themeFlag, *fontFlag = theme, font }(*themeFlag, *fontFlag)
+
+	for _, tt := range tests {
+		*themeFlag, *fontFlag = tt.theme, tt.font
+
+		got, err := ThemeFromFlags()
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("%s gave no error", tt.theme)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: %v", tt.theme, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s = %+v, want %+v", tt.theme, got, tt.want)
+		}
+	}
+}
+
+func TestBuiltinThemesAreValid(t *testing.T) {
+	for _, name := range ThemeNames() {
+		if err := builtinThemes[name]().validate(); err != nil {
+			t.Errorf("%s: %v", name, err)
+		}
+	}
+}
+
+func TestThemeFont(t *testing.T) {
+	dir, done := testThemeDir(t, map[string]string{
+		"shadow.flf":     fonts.AnsiShadow,
+		"not-a-font.flf": "hello",
+		"bad-height.flf": "flf2a$ x 5 10 0 0\n",
+	})
+	defer done()
+
+	tests := []struct {
+		font    string
+		height  int
+		wantErr bool
+	}{
+		{"", 7, false},
+		{filepath.Join(dir, "shadow.flf"), 7, false},
+		{filepath.Join(dir, "missing.flf"), 0, true},
+		{filepath.Join(dir, "not-a-font.flf"), 0, true},
+		{filepath.Join(dir, "bad-height.flf"), 0, true},
+	}
+
+	for _, tt := range tests {
+		theme := DefaultTheme()
+		theme.Font = tt.font
+
+		font, err := theme.LoadFont()
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("%q gave no error", tt.font)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%q: %v", tt.font, err)
+			continue
+		}
+		if font.Height != tt.height {
+			t.Errorf("%q is %d rows, want %d", tt.font, font.Height, tt.height)
+		}
+	}
+}
@@ -0,0 +1,489 @@
+package ui
+
+import (
+	"fmt"
+	"image"
+	"os"
+	"strings"
+	"time"
+
+	termui "github.com/gizak/termui/v3"
+	"github.com/gizak/termui/v3/widgets"
+	sp "github.com/nollbit/spotify"
+	termbox "github.com/nsf/termbox-go"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/nollbit/musikmaskinen/spotify"
+	mmwidgets "github.com/nollbit/musikmaskinen/widgets"
+)
+
+// View holds the widgets of the terminal UI and draws a ViewModel
+type View struct {
+	Header     *mmwidgets.FigletBanner
+	Usage      *widgets.Paragraph
+	TrackList  *widgets.List
+	Detail     *widgets.Paragraph
+	QueueTable *widgets.Table
+	TrackInfo  *widgets.Paragraph
+	Gauge      *widgets.Gauge
+	// nil when album art is turned off
+	Art *mmwidgets.AlbumArt
+
+	grid         *termui.Grid
+	layout       Layout
+	locale       *Locale
+	class        LayoutClass
+	headerHeight int
+	showHeader   bool
+	// all queue columns, the table only gets the ones that fit
+	queueRows [][]string
+	// set when sixel or kitty graphics need to be written again
+	artDirty bool
+	// gauge titles for when everything is fine and when Spotify isn't
+	titleStyle, alertTitleStyle termui.Style
+}
+
+// NewView creates the widgets and lays them out. Call SetRect before drawing.
+func NewView(theme *Theme, font *BannerFont, locale *Locale) *View {
+	theme.Apply()
+	p := theme.Palette
+	l := theme.Layout
+
+	v := &View{
+		layout: l,
+		locale: locale,
+		// one empty row below the banner
+		headerHeight: font.Height + 1,
+		showHeader:   true,
+		class:        -1,
+
+		titleStyle:      termui.Theme.Block.Title,
+		alertTitleStyle: termui.NewStyle(p.Alert, termui.ColorClear, termui.ModifierBold),
+	}
+
+	v.Header = mmwidgets.NewFigletBanner()
+	v.Header.FigletFont = font.Font
+	v.Header.TextStyle = termui.NewStyle(p.Banner)
+	v.Header.FadeColors = theme.FadeColors()
+	v.Header.Border = false
+
+	v.Usage = widgets.NewParagraph()
+	v.Usage.Title = locale.T("title.instructions")
+	v.Usage.TextStyle = termui.NewStyle(p.Text, p.Background, termui.ModifierBold)
+
+	v.TrackList = widgets.NewList()
+	v.TrackList.Title = locale.T("title.tracks")
+	v.TrackList.TextStyle = termui.NewStyle(p.List)
+	v.TrackList.SelectedRowStyle = termui.NewStyle(p.SelectedFg, p.SelectedBg, termui.ModifierBold)
+	v.TrackList.WrapText = false
+
+	v.Detail = widgets.NewParagraph()
+	v.Detail.Title = locale.T("title.details")
+	v.Detail.TextStyle = termui.NewStyle(p.Text, p.Background)
+	v.Detail.WrapText = false
+
+	v.QueueTable = widgets.NewTable()
+	v.queueRows = [][]string{
+		[]string{" ", locale.T("queue.duration"), locale.T("queue.wait")},
+	}
+	v.QueueTable.Rows = v.queueRows
+	v.QueueTable.TextStyle = termui.NewStyle(p.Text)
+	v.QueueTable.RowSeparator = true
+	v.QueueTable.FillRow = true
+	v.QueueTable.Title = locale.T("title.queue")
+
+	v.QueueTable.ColumnResizer = v.resizeQueueColumns
+
+	v.TrackInfo = widgets.NewParagraph()
+	v.TrackInfo.Title = locale.T("title.current_track")
+	v.TrackInfo.Text = ""
+	v.TrackInfo.WrapText = false
+
+	v.Gauge = widgets.NewGauge()
+	v.Gauge.Title = locale.T("title.playing")
+	v.Gauge.Percent = 0
+	v.Gauge.LabelStyle = termui.NewStyle(p.Text, p.Background)
+	v.Gauge.Label = "<3!"
+	v.Gauge.BarColor = p.Gauge
+
+	if mode, ok := artModeFromFlags(); ok && l.Art > 0 {
+		v.Art = mmwidgets.NewAlbumArt()
+		v.Art.Title = locale.T("title.album_art")
+		v.Art.Mode = mode
+	}
+
+	return v
+}
+
+// SetRect lays out the view on a screen of the given size. The layout is
+// picked by the size, so call it again whenever the terminal is resized.
+func (v *View) SetRect(width, height int) {
+	class := v.layout.layoutClass(width, height)
+	if class != v.class {
+		log.Debugf("Using the %s layout for %dx%d", class, width, height)
+		v.class = class
+	}
+
+	v.showHeader = class != LayoutCompact || height >= compactBannerMinHeight
+
+	top := 0
+	if v.showHeader {
+		top = v.headerHeight
+		v.Header.SetRect(0, 0, width, v.headerHeight)
+	}
+
+	v.grid = v.layoutGrid(class, height-1-top)
+	v.grid.SetRect(1, top, width-1, height-1)
+	v.artDirty = true
+}
+
+// SetArt changes the album art, nil clears it
+func (v *View) SetArt(img image.Image) {
+	if v.Art == nil {
+		return
+	}
+	v.Art.Image = img
+	v.artDirty = true
+}
+
+// Update copies the view model in to the widgets
+func (v *View) Update(m *ViewModel) {
+	v.Header.Text = m.Header
+	v.Usage.Text = formatInstructions(m, v.locale)
+
+	rows := make([]string, 0, len(m.Tracks))
+	for _, row := range m.Tracks {
+		rows = append(rows, formatTrackRow(row, v.locale))
+	}
+	v.TrackList.Rows = rows
+	v.TrackList.Title = formatTrackListTitle(m, v.locale)
+	if v.TrackList.SelectedRow >= len(rows) && len(rows) > 0 {
+		v.TrackList.SelectedRow = len(rows) - 1
+	}
+	v.UpdateDetail(m)
+
+	v.queueRows = [][]string{
+		[]string{"", v.locale.T("queue.duration"), v.locale.T("queue.wait")},
+	}
+	for i, qr := range m.Queue {
+		v.queueRows = append(v.queueRows, []string{
+			fmt.Sprintf(" %d | [%s](fg:artist,mod:bold) - [%s](fg:title,mod:bold)%s", i+1, qr.Track.Artists[0].Name, qr.Track.Name, formatOffCurve(qr.OffCurve)),
+			fmt.Sprintf(" %s ", v.locale.Length(qr.Track.Duration/1000)),
+			fmt.Sprintf(" %s ", v.locale.Length(qr.TimeUntilStart)),
+		})
+	}
+	v.QueueTable.Rows = v.queueRows
+	v.QueueTable.Title = v.locale.T("title.queue")
+	if m.QueueFull {
+		// the instructions saying so aren't shown on small screens
+		v.QueueTable.Title = v.locale.T("title.queue_full")
+	}
+
+	v.Gauge.Title, v.Gauge.TitleStyle = formatPlayingTitle(m.Volume, v.locale), v.titleStyle
+	if m.External != nil {
+		v.Gauge.Title, v.Gauge.TitleStyle = formatExternal(m.External, v.locale), v.alertTitleStyle
+	}
+	if status := formatSpotifyState(m.Spotify, v.locale); status != "" {
+		v.Gauge.Title, v.Gauge.TitleStyle = status, v.alertTitleStyle
+	}
+
+	if m.Playing == nil {
+		v.TrackInfo.Text = ""
+		v.Gauge.Label = ""
+		v.Gauge.Percent = 0
+	} else {
+		s := m.Playing
+
+		lines := [][2]string{
+			{"info.artist", "[" + formatArtists(s.Artists) + "](fg:artist,mod:bold)"},
+			{"info.title", "[" + s.Name + "](fg:title,mod:bold)"},
+			{"info.album", "[" + s.Album.Name + "](fg:artist,mod:bold)"},
+		}
+		if d := m.Dedication; d != nil {
+			lines = append(lines, [2]string{"info.dedication", formatDedication(d.Message, d.From, v.locale)})
+		}
+		v.TrackInfo.Text = formatTrackInfo(v.locale, lines)
+		if m.Dedication != nil {
+			// the empty line at the top makes room for the dedication
+			v.TrackInfo.Text = strings.TrimPrefix(v.TrackInfo.Text, "\n")
+		}
+		v.Gauge.Label = v.locale.Length(m.Remaining)
+		v.Gauge.Percent = int((float32((s.Duration/1000)-m.Remaining) / float32(s.Duration/1000)) * 100)
+	}
+}
+
+// UpdateDetail shows the details of the selected track. Call it when the
+// selection moves.
+func (v *View) UpdateDetail(m *ViewModel) {
+	row, ok := m.TrackAt(v.TrackList.SelectedRow)
+	if !ok {
+		v.Detail.Text = ""
+		return
+	}
+	v.Detail.Text = formatTrackDetail(row, m, v.locale)
+}
+
+// Draw draws the whole view in to a buffer
+func (v *View) Draw(buf *termui.Buffer) {
+	if v.showHeader {
+		v.Header.Draw(buf)
+	}
+	v.grid.Draw(buf)
+}
+
+// Render draws the whole view on the terminal
+func (v *View) Render() {
+	if v.artDirty && v.Art != nil && v.Art.Mode != mmwidgets.ArtModeHalfBlocks {
+		// termui only redraws cells that changed, make it paint over the old image
+		termbox.Sync()
+	}
+
+	if v.showHeader {
+		termui.Render(v.Header)
+	}
+	termui.Render(v.grid)
+
+	if v.artDirty && v.Art != nil {
+		v.artDirty = false
+		err := v.Art.WriteGraphics(os.Stdout)
+		if err != nil {
+			log.WithError(err).Warn("Unable to draw album art")
+		}
+	}
+}
+
+// RenderHeader only draws the animated header on the terminal
+func (v *View) RenderHeader() {
+	if v.showHeader {
+		termui.Render(v.Header)
+	}
+}
+
+// formatArtists joins artist names like "A, B & C"
+func formatArtists(artists []sp.SimpleArtist) string {
+	var sb strings.Builder
+	for i, artist := range artists {
+		if i == len(artists)-1 && len(artists) > 1 {
+			sb.WriteString(" & ")
+		} else if len(artists) > 1 && i > 0 {
+			sb.WriteString(", ")
+		}
+		sb.WriteString(artist.Name)
+	}
+	return sb.String()
+}
+
+func formatTrackRow(row TrackRow, l *Locale) string {
+	track := row.Track
+
+	switch row.Status {
+	case TrackPlaying:
+		return fmt.Sprintf(" [%s](fg:artist) - [%s](fg:title) [%s](fg:text) ", track.Artists[0].Name, track.Name, l.T("track.playing"))
+	case TrackInQueue:
+		return fmt.Sprintf(" [%s](fg:artist) - [%s](fg:title) [%s](fg:text) ", track.Artists[0].Name, track.Name, l.T("track.in_queue"))
+	case TrackRecentlyPlayed:
+		return fmt.Sprintf(" [%s](fg:artist) - [%s](fg:title) [%s](fg:text) ", track.Artists[0].Name, track.Name, l.T("track.recently_played"))
+	}
+
+	return fmt.Sprintf(" [%s](fg:artist,mod:bold) - [%s](fg:title,mod:bold) [(%s)](fg:text) ", track.Artists[0].Name, track.Name, l.Length(track.Duration/1000))
+}
+
+// formatTrackInfo lines up label and value pairs. The labels are message keys.
+func formatTrackInfo(l *Locale, lines [][2]string) string {
+	width := 0
+	for _, line := range lines {
+		if w := len([]rune(l.T(line[0]))); w > width {
+			width = w
+		}
+	}
+
+	var sb strings.Builder
+	for _, line := range lines {
+		label := l.T(line[0])
+		padding := strings.Repeat(" ", width-len([]rune(label))+3)
+		sb.WriteString(fmt.Sprintf("\n [%s](fg:label,mod:bold):%s%s", label, padding, line[1]))
+	}
+	return sb.String()
+}
+
+// formatTrackDetail describes a track in the list, and when it would be played
+// or why it can't be queued
+func formatTrackDetail(row TrackRow, m *ViewModel, l *Locale) string {
+	track := row.Track
+
+	var sb strings.Builder
+	sb.WriteString(" ")
+
+	// the most important line goes first, it's the one that fits on small screens
+	switch row.Status {
+	case TrackPlaying:
+		sb.WriteString(l.T("detail.playing"))
+	case TrackInQueue:
+		if i := m.QueuePosition(track.ID); i >= 0 {
+			sb.WriteString(l.T("detail.in_queue", i+1, l.Length(m.Queue[i].TimeUntilStart)))
+		} else {
+			sb.WriteString(l.T("track.in_queue"))
+		}
+	case TrackRecentlyPlayed:
+		sb.WriteString(l.T("detail.recently_played", l.Clock(row.AvailableAt)))
+	default:
+		if m.QueueFull {
+			sb.WriteString(l.T("detail.queue_full"))
+		} else {
+			sb.WriteString(l.T("detail.would_start", l.Length(m.TimeUntilQueued)))
+		}
+	}
+
+	album := "[" + track.Album.Name + "](fg:artist)"
+	if len(track.Album.ReleaseDate) >= 4 {
+		album += " (" + track.Album.ReleaseDate[:4] + ")"
+	}
+	explicit := l.T("detail.no")
+	if track.Explicit {
+		explicit = l.T("detail.yes")
+	}
+
+	lines := [][2]string{
+		{"info.album", album},
+		{"detail.popularity", l.T("detail.popularity_value", track.Popularity)},
+		{"detail.explicit", explicit},
+	}
+	if len(row.Sources) > 0 {
+		lines = append(lines, [2]string{"detail.source", strings.Join(row.Sources, ", ")})
+	}
+	if f := row.Features; f != nil {
+		lines = append(lines, [2]string{"detail.feel", l.T("detail.feel_value", f.Tempo, f.Energy*100, formatKey(f.Key, f.Mode, l))})
+	}
+	sb.WriteString(formatTrackInfo(l, lines))
+
+	if row.Status == TrackAvailable && !m.QueueFull {
+		starts := time.Now().Add(time.Duration(m.TimeUntilQueued) * time.Second)
+		switch m.OffCurve(track.ID, starts) {
+		case 1:
+			sb.WriteString("\n\n " + l.T("detail.energy_high"))
+		case -1:
+			sb.WriteString("\n\n " + l.T("detail.energy_low"))
+		}
+	}
+
+	return sb.String()
+}
+
+// formatSpotifyState says what's wrong with Spotify, if anything
+func formatSpotifyState(state spotify.GuardState, l *Locale) string {
+	wait := int(time.Until(state.Until).Seconds() + 0.5)
+
+	switch state.Status {
+	case spotify.GuardRetrying:
+		return l.T("status.retrying")
+	case spotify.GuardRateLimited:
+		if wait > 0 {
+			return l.T("status.rate_limited", l.Length(wait))
+		}
+		return l.T("status.retrying")
+	case spotify.GuardOpen:
+		if wait > 0 {
+			return l.T("status.open", l.Length(wait))
+		}
+		return l.T("status.retrying")
+	}
+	return ""
+}
+
+// formatPlayingTitle adds the volume to the title of the playing track, and
+// says when it's held back
+func formatPlayingTitle(volume *spotify.VolumeStatus, l *Locale) string {
+	switch {
+	case volume == nil:
+		return l.T("title.playing")
+	case volume.Fading:
+		return l.T("title.volume_fading", volume.Level)
+	case volume.Wanted > volume.Level:
+		return l.T("title.volume_limited", volume.Level)
+	}
+	return l.T("title.volume", volume.Level)
+}
+
+// formatExternal says what's going on when someone else took over playback
+func formatExternal(e *spotify.PlayerExternalStatus, l *Locale) string {
+	track := ""
+	if e.Track != nil {
+		track = formatArtists(e.Track.Artists) + " - " + e.Track.Name
+	}
+	device := e.Device
+	if device == "" {
+		device = l.T("external.device")
+	}
+
+	switch e.Policy {
+	case spotify.ExternalReclaim:
+		return l.T("external.reclaim", track, device)
+	case spotify.ExternalAdopt:
+		return l.T("external.adopt", track, device)
+	}
+	return l.T("external.pause", track, device)
+}
+
+// the pitch classes Spotify numbers keys by
+var keyNames = []string{"C", "C♯", "D", "D♯", "E", "F", "F♯", "G", "G♯", "A", "A♯", "B"}
+
+func formatKey(key, mode int, l *Locale) string {
+	if key < 0 || key >= len(keyNames) {
+		return l.T("detail.unknown_key")
+	}
+	if mode == 0 {
+		return l.T("detail.minor", keyNames[key])
+	}
+	return l.T("detail.major", keyNames[key])
+}
+
+// formatOffCurve marks a queued track with too much or too little energy
+func formatOffCurve(offCurve int) string {
+	switch offCurve {
+	case 1:
+		return " [↑](fg:alert,mod:bold)"
+	case -1:
+		return " [↓](fg:alert,mod:bold)"
+	}
+	return ""
+}
+
+func formatDedication(message, from string, l *Locale) string {
+	if from == "" {
+		return l.T("info.dedication_text", message)
+	}
+	return l.T("info.dedication_from", message, from)
+}
+
+func formatTrackListTitle(m *ViewModel, l *Locale) string {
+	if m.Searching {
+		return l.T("title.search", m.Filter.Query, len(m.Tracks), m.TotalTracks)
+	}
+	if m.Filter.Query != "" {
+		return l.T("title.matching", m.Filter.Query, len(m.Tracks), m.TotalTracks)
+	}
+	if m.Filter.Source != "" {
+		return l.T("title.source", m.Filter.Source, len(m.Tracks), m.TotalTracks)
+	}
+	if m.Filter.Sort != SortArtist && m.Filter.Sort != "" {
+		return l.T("title.sorted", l.T("sort."+string(m.Filter.Sort)))
+	}
+	return l.T("title.tracks")
+}
+
+func formatInstructions(m *ViewModel, l *Locale) string {
+	var sb strings.Builder
+
+	sb.WriteString(l.T("instructions.header") + "\n")
+	sb.WriteString(l.T("instructions.step1") + "\n")
+	sb.WriteString(l.T("instructions.step2") + "\n")
+	sb.WriteString("\n")
+
+	if m.QueueFull {
+		sb.WriteString(l.T("instructions.full") + "\n")
+	} else {
+		sb.WriteString(l.N("instructions.limit", m.MaxQueueSize) + "\n")
+	}
+
+	return sb.String()
+}
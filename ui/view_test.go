@@ -0,0 +1,226 @@
+package ui
+
+import (
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	sp "github.com/nollbit/spotify"
+
+	"github.com/nollbit/musikmaskinen/dedication"
+	"github.com/nollbit/musikmaskinen/spotify"
+)
+
+var update = flag.Bool("update", false, "write the golden files in testdata instead of comparing with them")
+
+// testTrack is a track with everything the view shows
+func testTrack(id, artist, name, album string, seconds int) sp.FullTrack {
+	return sp.FullTrack{
+		SimpleTrack: sp.SimpleTrack{
+			ID:       sp.ID(id),
+			Name:     name,
+			Artists:  []sp.SimpleArtist{{Name: artist}},
+			Duration: seconds * 1000,
+		},
+		Album:      sp.SimpleAlbum{Name: album, ReleaseDate: "1984-06-01"},
+		Popularity: 61,
+	}
+}
+
+// testViewModels are the screens the golden files are drawn from
+func testViewModels() map[string]*ViewModel {
+	tracks := []sp.FullTrack{
+		testTrack("1", "Abba", "Dancing Queen", "Arrival", 231),
+		testTrack("2", "Bob Hund", "Istället för musik: förvirring", "Bob Hund", 198),
+		testTrack("3", "Daft Punk", "One More Time", "Discovery", 320),
+		testTrack("4", "Kent", "Musik non stop", "Hagnesta Hill", 245),
+		testTrack("5", "Robyn", "Dancing On My Own", "Body Talk", 287),
+	}
+
+	idle := NewViewModel(5, Filter{})
+	idle.Header = "musikmaskinen"
+	for _, t := range tracks {
+		idle.Tracks = append(idle.Tracks, TrackRow{Track: t, Status: TrackAvailable})
+	}
+	idle.TotalTracks = len(tracks)
+
+	playing := NewViewModel(5, Filter{})
+	playing.Header = "fredagsbar"
+	playing.Tracks = []TrackRow{
+		{Track: tracks[0], Status: TrackInQueue, Sources: []string{"Fredag"}},
+		{Track: tracks[1], Status: TrackRecentlyPlayed, AvailableAt: time.Date(2019, 3, 1, 23, 45, 0, 0, time.Local)},
+		{Track: tracks[2], Status: TrackPlaying},
+		{Track: tracks[3], Status: TrackAvailable},
+		{Track: tracks[4], Status: TrackInQueue},
+	}
+	playing.TotalTracks = len(tracks)
+	playing.Queue = []QueueRow{
+		{Track: tracks[0], TimeUntilStart: 95},
+		{Track: tracks[4], TimeUntilStart: 326},
+	}
+	playing.TimeUntilQueued = 613
+	playing.Playing = &tracks[2]
+	playing.Remaining = 95
+	playing.Dedication = &dedication.Dedication{Message: "Grattis på födelsedagen!", From: "Kim"}
+	playing.Volume = &spotify.VolumeStatus{Level: 60, Wanted: 80}
+
+	full := NewViewModel(2, Filter{Query: "danc"})
+	full.Header = "musikmaskinen"
+	full.Searching = true
+	full.Tracks = []TrackRow{
+		{Track: tracks[0], Status: TrackAvailable},
+		{Track: tracks[4], Status: TrackInQueue},
+	}
+	full.TotalTracks = len(tracks)
+	full.Queue = []QueueRow{
+		{Track: tracks[4], TimeUntilStart: 12},
+		{Track: tracks[3], TimeUntilStart: 299},
+	}
+	full.QueueFull = true
+	full.Playing = &tracks[1]
+	full.Remaining = 12
+	full.Spotify = spotify.GuardState{Status: spotify.GuardRetrying}
+
+	return map[string]*ViewModel{
+		"idle":    idle,
+		"playing": playing,
+		"full":    full,
+	}
+}
+
+// testView creates a view with the default theme and no album art
+func testView(t *testing.T, locale string) *View {
+	*albumArtFlag = "off"
+
+	theme := DefaultTheme()
+	font, err := theme.LoadFont()
+	if err != nil {
+		t.Fatal(err)
+	}
+	l, err := NewLocale(locale)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return NewView(theme, font, l)
+}
+
+// checkGolden compares a snapshot with testdata/<name>.golden, or writes it
+// with -update
+func checkGolden(t *testing.T, name string, got string) {
+	path := filepath.Join("testdata", name+".golden")
+
+	if *update {
+		if err := ioutil.WriteFile(path, []byte(got), 0644); err != nil {
+			t.Fatal(err)
+		}
+		return
+	}
+
+	want, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatalf("%v, run the tests with -update to create it", err)
+	}
+	if got != string(want) {
+		t.Errorf("%s differs from the golden file, run the tests with -update if that's intended. Got:\n%s", name, got)
+	}
+}
+
+func TestViewSnapshots(t *testing.T) {
+	sizes := []struct {
+		name          string
+		width, height int
+		class         LayoutClass
+	}{
+		{"compact", 60, 40, LayoutCompact},
+		{"compact-short", 50, 20, LayoutCompact},
+		{"normal", 120, 40, LayoutNormal},
+		{"tv", 180, 55, LayoutTV},
+	}
+
+	for name, m := range testViewModels() {
+		for _, size := range sizes {
+			t.Run(name+"-"+size.name, func(t *testing.T) {
+				v := testView(t, "en")
+				v.Update(m)
+
+				buf := DrawToBuffer(v, size.width, size.height)
+				if v.class != size.class {
+					t.Errorf("got the %s layout for %dx%d, want %s", v.class, size.width, size.height, size.class)
+				}
+				checkGolden(t, name+"-"+size.name, Snapshot(buf))
+			})
+		}
+	}
+}
+
+func TestViewSnapshotLocale(t *testing.T) {
+	v := testView(t, "sv")
+	v.Update(testViewModels()["playing"])
+
+	checkGolden(t, "playing-normal-sv", Snapshot(DrawToBuffer(v, 120, 40)))
+}
+
+func TestCompactLayoutHeights(t *testing.T) {
+	for _, height := range []int{8, 12, 24} {
+		t.Run(fmt.Sprint(height), func(t *testing.T) {
+			v := testView(t, "en")
+			v.Update(testViewModels()["playing"])
+
+			buf := DrawToBuffer(v, 40, height)
+			if v.class != LayoutCompact {
+				t.Fatalf("got the %s layout for 40x%d", v.class, height)
+			}
+			if h := v.TrackList.Dy(); h < 2 {
+				t.Errorf("the track list is %d rows on a screen %d rows tall", h, height)
+			}
+			checkGolden(t, fmt.Sprintf("playing-compact-%d", height), Snapshot(buf))
+		})
+	}
+}
+
+// testPlayerState is a player with a fixed queue
+type testPlayerState struct {
+	queue           []*spotify.QueuedTrack
+	full            bool
+	timeUntilQueued int
+}
+
+func (p *testPlayerState) CurrentlyPlaying() *sp.FullTrack  { return nil }
+func (p *testPlayerState) IsInQueue(trackID sp.ID) bool     { return false }
+func (p *testPlayerState) GetQueue() []*spotify.QueuedTrack { return p.queue }
+func (p *testPlayerState) QueueFull() bool                  { return p.full }
+func (p *testPlayerState) TimeUntilQueued() int             { return p.timeUntilQueued }
+
+func TestDetailStartEstimate(t *testing.T) {
+	queued := testTrack("1", "Abba", "Dancing Queen", "Arrival", 180)
+	other := testTrack("2", "Robyn", "Dancing On My Own", "Body Talk", 287)
+
+	l, err := NewLocale("en")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name   string
+		player *testPlayerState
+		row    TrackRow
+		want   string
+	}{
+		{"empty queue", &testPlayerState{}, TrackRow{Track: other, Status: TrackAvailable}, l.T("detail.would_start", l.Length(0))},
+		{"in queue", &testPlayerState{queue: []*spotify.QueuedTrack{{Track: queued, TimeUntilStart: 95}}, timeUntilQueued: 275}, TrackRow{Track: queued, Status: TrackInQueue}, l.T("detail.in_queue", 1, l.Length(95))},
+		{"after the queue", &testPlayerState{queue: []*spotify.QueuedTrack{{Track: queued, TimeUntilStart: 95}}, timeUntilQueued: 275}, TrackRow{Track: other, Status: TrackAvailable}, l.T("detail.would_start", l.Length(275))},
+		{"queue full", &testPlayerState{queue: []*spotify.QueuedTrack{{Track: queued, TimeUntilStart: 95}}, full: true, timeUntilQueued: 275}, TrackRow{Track: other, Status: TrackAvailable}, l.T("detail.queue_full")},
+	}
+
+	for _, test := range tests {
+		m := NewViewModel(5, Filter{})
+		m.UpdateQueue(test.player)
+		if got := formatTrackDetail(test.row, m, l); !strings.Contains(got, test.want) {
+			t.Errorf("%s: the detail says %q, want %q", test.name, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,312 @@
+package widget
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"io"
+
+	termui "github.com/gizak/termui/v3"
+)
+
+type (
+	// ArtMode is how the album art is drawn
+	ArtMode int
+
+	// AlbumArt shows an image, usually an album cover. With half blocks the
+	// image is drawn in to the termui buffer like any other widget. Sixel and
+	// kitty graphics can't go through termui, so Draw only clears the area and
+	// WriteGraphics has to be called after rendering to put the image there.
+	AlbumArt struct {
+		termui.Block
+		Image image.Image
+		Mode  ArtMode
+		// size of a terminal cell in pixels, only used for sixel
+		CellWidth, CellHeight int
+	}
+)
+
+const (
+	ArtModeHalfBlocks ArtMode = iota
+	ArtModeSixel
+	ArtModeKitty
+)
+
+const upperHalfBlock = '▀'
+
+func NewAlbumArt() *AlbumArt {
+	return &AlbumArt{
+		Block:      *termui.NewBlock(),
+		Mode:       ArtModeHalfBlocks,
+		CellWidth:  10,
+		CellHeight: 20,
+	}
+}
+
+func (a *AlbumArt) Draw(buf *termui.Buffer) {
+	a.Block.Draw(buf)
+
+	// clear what was drawn before, graphics go on top of this
+	buf.Fill(termui.NewCell(' ', termui.NewStyle(termui.ColorClear)), a.Inner)
+
+	if a.Image == nil || a.Mode != ArtModeHalfBlocks {
+		return
+	}
+
+	area := a.artArea(1, 2)
+	img := scaleImage(a.Image, area.Dx(), area.Dy()*2)
+
+	for y := 0; y < area.Dy(); y++ {
+		for x := 0; x < area.Dx(); x++ {
+			// each cell is two pixels, the top one in the foreground
+			top := Color256(img.At(x, y*2))
+			bottom := Color256(img.At(x, y*2+1))
+			cell := termui.NewCell(upperHalfBlock, termui.NewStyle(top, bottom))
+			buf.SetCell(cell, image.Pt(x, y).Add(area.Min))
+		}
+	}
+}
+
+// artArea is the largest square that fits in the widget, in cells. A cell is
+// pixelsX by pixelsY image pixels.
+func (a *AlbumArt) artArea(pixelsX, pixelsY int) image.Rectangle {
+	w, h := a.Inner.Dx()*pixelsX, a.Inner.Dy()*pixelsY
+	side := w
+	if h < side {
+		side = h
+	}
+
+	cols, rows := side/pixelsX, side/pixelsY
+	min := a.Inner.Min.Add(image.Pt((a.Inner.Dx()-cols)/2, (a.Inner.Dy()-rows)/2))
+	return image.Rectangle{Min: min, Max: min.Add(image.Pt(cols, rows))}
+}
+
+// WriteGraphics draws the image with sixel or kitty graphics. Call it after
+// termui has rendered the widget. Half blocks need nothing written.
+func (a *AlbumArt) WriteGraphics(w io.Writer) error {
+	if a.Mode == ArtModeKitty {
+		// kitty images stay until they're deleted
+		_, err := io.WriteString(w, "\x1b_Ga=d,q=2\x1b\\")
+		if err != nil {
+			return err
+		}
+	}
+
+	if a.Image == nil || a.Mode == ArtModeHalfBlocks {
+		return nil
+	}
+
+	var b bytes.Buffer
+
+	// keep the cursor where termui left it
+	b.WriteString("\x1b7")
+
+	switch a.Mode {
+	case ArtModeKitty:
+		// kitty scales the image to the cells itself
+		area := a.artArea(1, 2)
+		fmt.Fprintf(&b, "\x1b[%d;%dH", area.Min.Y+1, area.Min.X+1)
+		err := writeKitty(&b, a.Image, area.Dx(), area.Dy())
+		if err != nil {
+			return err
+		}
+	case ArtModeSixel:
+		area := a.artArea(a.CellWidth, a.CellHeight)
+		fmt.Fprintf(&b, "\x1b[%d;%dH", area.Min.Y+1, area.Min.X+1)
+		img := scaleImage(a.Image, area.Dx()*a.CellWidth, area.Dy()*a.CellHeight)
+		writeSixel(&b, img)
+	}
+
+	b.WriteString("\x1b8")
+
+	_, err := w.Write(b.Bytes())
+	return err
+}
+
+// writeKitty sends the image as a PNG using the kitty graphics protocol
+func writeKitty(w *bytes.Buffer, img image.Image, cols, rows int) error {
+	var p bytes.Buffer
+	err := png.Encode(&p, img)
+	if err != nil {
+		return err
+	}
+
+	data := base64.StdEncoding.EncodeToString(p.Bytes())
+
+	// the payload has to be sent in chunks of at most 4096 bytes
+	first := true
+	for len(data) > 0 {
+		chunk := data
+		if len(chunk) > 4096 {
+			chunk = chunk[:4096]
+		}
+		data = data[len(chunk):]
+
+		more := 0
+		if len(data) > 0 {
+			more = 1
+		}
+
+		if first {
+			fmt.Fprintf(w, "\x1b_Ga=T,f=100,q=2,c=%d,r=%d,m=%d;%s\x1b\\", cols, rows, more, chunk)
+			first = false
+		} else {
+			fmt.Fprintf(w, "\x1b_Gm=%d;%s\x1b\\", more, chunk)
+		}
+	}
+
+	return nil
+}
+
+// writeSixel sends the image as sixels using the 256 color palette
+func writeSixel(w *bytes.Buffer, img image.Image) {
+	bounds := img.Bounds()
+
+	pixels := make([][]termui.Color, bounds.Dy())
+	used := make(map[termui.Color]bool)
+	for y := range pixels {
+		pixels[y] = make([]termui.Color, bounds.Dx())
+		for x := range pixels[y] {
+			c := Color256(img.At(bounds.Min.X+x, bounds.Min.Y+y))
+			pixels[y][x] = c
+			used[c] = true
+		}
+	}
+
+	w.WriteString("\x1bPq")
+	fmt.Fprintf(w, "\"1;1;%d;%d", bounds.Dx(), bounds.Dy())
+
+	for c := range used {
+		r, g, b := palette256RGB(c)
+		// sixel colors are in percent
+		fmt.Fprintf(w, "#%d;2;%d;%d;%d", c, r*100/255, g*100/255, b*100/255)
+	}
+
+	// six rows of pixels at a time
+	for band := 0; band < bounds.Dy(); band += 6 {
+		for c := range used {
+			fmt.Fprintf(w, "#%d", c)
+			for x := 0; x < bounds.Dx(); x++ {
+				bits := 0
+				for i := 0; i < 6 && band+i < bounds.Dy(); i++ {
+					if pixels[band+i][x] == c {
+						bits |= 1 << uint(i)
+					}
+				}
+				w.WriteByte(byte(63 + bits))
+			}
+			// back to the start of the band for the next color
+			w.WriteByte('$')
+		}
+		// next band
+		w.WriteByte('-')
+	}
+
+	w.WriteString("\x1b\\")
+}
+
+// scaleImage resizes an image by averaging the pixels that end up in the same spot
+func scaleImage(src image.Image, width, height int) *image.RGBA {
+	dst := image.NewRGBA(image.Rect(0, 0, width, height))
+	if width <= 0 || height <= 0 {
+		return dst
+	}
+
+	b := src.Bounds()
+	for y := 0; y < height; y++ {
+		y0 := b.Min.Y + y*b.Dy()/height
+		y1 := b.Min.Y + (y+1)*b.Dy()/height
+		if y1 <= y0 {
+			y1 = y0 + 1
+		}
+
+		for x := 0; x < width; x++ {
+			x0 := b.Min.X + x*b.Dx()/width
+			x1 := b.Min.X + (x+1)*b.Dx()/width
+			if x1 <= x0 {
+				x1 = x0 + 1
+			}
+
+			var r, g, bl, n uint32
+			for sy := y0; sy < y1; sy++ {
+				for sx := x0; sx < x1; sx++ {
+					pr, pg, pb, _ := src.At(sx, sy).RGBA()
+					r += pr >> 8
+					g += pg >> 8
+					bl += pb >> 8
+					n++
+				}
+			}
+
+			dst.Set(x, y, color.RGBA{uint8(r / n), uint8(g / n), uint8(bl / n), 0xff})
+		}
+	}
+
+	return dst
+}
+
+// the levels of the 6x6x6 color cube in the 256 color palette
+var cubeLevels = []int{0, 95, 135, 175, 215, 255}
+
+// Color256 finds the closest color in the 256 color palette, looking at the
+// color cube and the gray ramp
+func Color256(c color.Color) termui.Color {
+	r32, g32, b32, _ := c.RGBA()
+	r, g, b := int(r32>>8), int(g32>>8), int(b32>>8)
+
+	ri, gi, bi := closestLevel(r), closestLevel(g), closestLevel(b)
+	cube := 16 + 36*ri + 6*gi + bi
+	cubeDist := colorDistance(r, g, b, cubeLevels[ri], cubeLevels[gi], cubeLevels[bi])
+
+	// the gray ramp goes from 8 to 238 in steps of 10
+	avg := (r + g + b) / 3
+	grayIndex := (avg - 3) / 10
+	if grayIndex < 0 {
+		grayIndex = 0
+	} else if grayIndex > 23 {
+		grayIndex = 23
+	}
+	level := 8 + grayIndex*10
+	grayDist := colorDistance(r, g, b, level, level, level)
+
+	if grayDist < cubeDist {
+		return termui.Color(232 + grayIndex)
+	}
+	return termui.Color(cube)
+}
+
+func closestLevel(v int) int {
+	best := 0
+	for i, level := range cubeLevels {
+		if abs(v-level) < abs(v-cubeLevels[best]) {
+			best = i
+		}
+	}
+	return best
+}
+
+// palette256RGB is the RGB value of a color from the color cube or gray ramp
+func palette256RGB(c termui.Color) (int, int, int) {
+	i := int(c)
+	if i >= 232 {
+		level := 8 + (i-232)*10
+		return level, level, level
+	}
+	i -= 16
+	return cubeLevels[i/36], cubeLevels[i/6%6], cubeLevels[i%6]
+}
+
+func colorDistance(r1, g1, b1, r2, g2, b2 int) int {
+	dr, dg, db := r1-r2, g1-g2, b1-b2
+	return dr*dr + dg*dg + db*db
+}
+
+func abs(v int) int {
+	if v < 0 {
+		return -v
+	}
+	return v
+}
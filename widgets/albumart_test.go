@@ -0,0 +1,154 @@
+package widget
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"math/rand"
+	"strings"
+	"testing"
+
+	termui "github.com/gizak/termui/v3"
+)
+
+// testImage is red on top and blue at the bottom
+func testImage(size int) image.Image {
+	img := image.NewRGBA(image.Rect(0, 0, size, size))
+	for y := 0; y < size; y++ {
+		for x := 0; x < size; x++ {
+			c := color.RGBA{0xff, 0, 0, 0xff}
+			if y >= size/2 {
+				c = color.RGBA{0, 0, 0xff, 0xff}
+			}
+			img.Set(x, y, c)
+		}
+	}
+	return img
+}
+
+func TestColor256(t *testing.T) {
+	tests := []struct {
+		c    color.Color
+		want termui.Color
+	}{
+		{color.RGBA{0, 0, 0, 0xff}, 16},
+		{color.RGBA{0xff, 0xff, 0xff, 0xff}, 231},
+		{color.RGBA{0xff, 0, 0, 0xff}, 196},
+		{color.RGBA{0, 0, 0xff, 0xff}, 21},
+		{color.RGBA{0x80, 0x80, 0x80, 0xff}, 244},
+	}
+
+	for _, tt := range tests {
+		if got := Color256(tt.c); got != tt.want {
+			t.Errorf("Color256(%v) = %d, want %d", tt.c, got, tt.want)
+		}
+		r, g, b := palette256RGB(tt.want)
+		if back := Color256(color.RGBA{uint8(r), uint8(g), uint8(b), 0xff}); back != tt.want {
+			t.Errorf("palette color %d comes back as %d", tt.want, back)
+		}
+	}
+}
+
+func TestAlbumArtHalfBlocks(t *testing.T) {
+	a := NewAlbumArt()
+	a.SetRect(0, 0, 6, 4)
+	a.Image = testImage(8)
+
+	buf := termui.NewBuffer(a.GetRect())
+	a.Draw(buf)
+
+	// inside the border 4x2 cells is a 4x4 pixel square, the top row is all
+	// red and the bottom row all blue
+	for x := 0; x < 4; x++ {
+		tests := []struct {
+			y      int
+			fg, bg termui.Color
+		}{
+			{0, 196, 196},
+			{1, 21, 21},
+		}
+		for _, tt := range tests {
+			cell := buf.GetCell(image.Pt(x+1, tt.y+1))
+			if cell.Rune != upperHalfBlock || cell.Style.Fg != tt.fg || cell.Style.Bg != tt.bg {
+				t.Errorf("cell %d,%d = %q %d/%d, want %q %d/%d", x, tt.y, cell.Rune, cell.Style.Fg, cell.Style.Bg, upperHalfBlock, tt.fg, tt.bg)
+			}
+		}
+	}
+
+	var b bytes.Buffer
+	if err := a.WriteGraphics(&b); err != nil || b.Len() != 0 {
+		t.Errorf("half blocks wrote %q (%v), want nothing", b.String(), err)
+	}
+}
+
+func TestAlbumArtKitty(t *testing.T) {
+	a := NewAlbumArt()
+	a.SetRect(0, 0, 6, 4)
+	a.Mode = ArtModeKitty
+
+	var b bytes.Buffer
+	if err := a.WriteGraphics(&b); err != nil {
+		t.Fatal(err)
+	}
+	if got := b.String(); got != "\x1b_Ga=d,q=2\x1b\\" {
+		t.Errorf("without an image kitty wrote %q, want only the delete", got)
+	}
+
+	// noise doesn't compress, so it needs more than one chunk
+	img := image.NewRGBA(image.Rect(0, 0, 64, 64))
+	rand.New(rand.NewSource(1)).Read(img.Pix)
+	a.Image = img
+
+	b.Reset()
+	if err := a.WriteGraphics(&b); err != nil {
+		t.Fatal(err)
+	}
+	got := b.String()
+
+	for _, want := range []string{"\x1b_Ga=d,q=2\x1b\\\x1b7\x1b[2;2H", "\x1b_Ga=T,f=100,q=2,c=4,r=2,m=1;", "\x1b_Gm=0;"} {
+		if !strings.Contains(got, want) {
+			t.Errorf("kitty output is missing %q", want)
+		}
+	}
+	if !strings.HasSuffix(got, "\x1b\\\x1b8") {
+		t.Errorf("kitty output doesn't put the cursor back")
+	}
+	for _, chunk := range strings.Split(got, "\x1b\\") {
+		if i := strings.LastIndex(chunk, ";"); i >= 0 && len(chunk)-i-1 > 4096 {
+			t.Errorf("kitty chunk of %d bytes, want at most 4096", len(chunk)-i-1)
+		}
+	}
+}
+
+func TestAlbumArtSixel(t *testing.T) {
+	a := NewAlbumArt()
+	a.SetRect(0, 0, 4, 3)
+	a.Mode = ArtModeSixel
+	a.CellWidth, a.CellHeight = 6, 12
+	a.Image = testImage(12)
+
+	var b bytes.Buffer
+	if err := a.WriteGraphics(&b); err != nil {
+		t.Fatal(err)
+	}
+	got := b.String()
+
+	// two cells of 6x12 pixels, two bands of six rows, the first all red and
+	// the second all blue
+	for _, want := range []string{
+		"\x1b7\x1b[2;2H\x1bPq\"1;1;12;12",
+		"#196;2;100;0;0",
+		"#21;2;0;0;100",
+		"#196~~~~~~~~~~~~$",
+		"#21~~~~~~~~~~~~$",
+		"#196????????????$",
+		"#21????????????$",
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("sixel output is missing %q: %q", want, got)
+		}
+	}
+	if !strings.HasSuffix(got, "-\x1b\\\x1b8") || strings.Count(got, "-") != 2 {
+		t.Errorf("sixel output doesn't end two bands and put the cursor back: %q", got)
+	}
+}
@@ -8,16 +8,28 @@ import (
 
 type FadedBlock struct {
 	termui.Block
+	// the colors the block fades through
+	FadeColors []termui.Color
+	fadeOffset int
 }
 
 // Faded block is a block filled with faded blocks. Try it and you'll see :)
 // I only used it render something to put on the controller
 func NewFadedBlock() *FadedBlock {
 	return &FadedBlock{
-		Block: *termui.NewBlock(),
+		Block:      *termui.NewBlock(),
+		FadeColors: DefaultFadeColors(),
 	}
 }
 
+// Tick moves the fade one step, call it repeatedly to animate the block
+func (f *FadedBlock) Tick() {
+	if len(f.FadeColors) == 0 {
+		return
+	}
+	f.fadeOffset = (f.fadeOffset + 1) % len(f.FadeColors)
+}
+
 func (f *FadedBlock) Draw(buf *termui.Buffer) {
 	f.Block.Draw(buf)
 
@@ -36,19 +48,9 @@ func (f *FadedBlock) Draw(buf *termui.Buffer) {
 }
 
 func (f *FadedBlock) cyclicHoriFade() [][]termui.Cell {
-	fadeColors := make([]termui.Color, 0)
-
-	for i := 16; i < 51; i++ {
-		fadeColors = append(fadeColors, termui.Color(i))
-	}
-	for i := 195; i > 161; i-- {
-		fadeColors = append(fadeColors, termui.Color(i))
-	}
-	for i := 50; i < 160; i++ {
-		fadeColors = append(fadeColors, termui.Color(i))
-	}
-	for i := 50; i > 15; i-- {
-		fadeColors = append(fadeColors, termui.Color(i))
+	fadeColors := f.FadeColors
+	if len(fadeColors) == 0 {
+		fadeColors = []termui.Color{termui.ColorWhite}
 	}
 
 	w := f.Inner.Max.X
@@ -62,7 +64,7 @@ func (f *FadedBlock) cyclicHoriFade() [][]termui.Cell {
 		for x := 0; x < w; x++ {
 			row[x] = termui.Cell{
 				Rune:  block,
-				Style: termui.NewStyle(fadeColors[(x+y)%len(fadeColors)]),
+				Style: termui.NewStyle(fadeColors[(x+y+f.fadeOffset)%len(fadeColors)]),
 			}
 		}
 
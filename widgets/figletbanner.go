@@ -2,61 +2,82 @@ package widget
 
 import (
 	"image"
+	"math"
+	"strings"
 
 	termui "github.com/gizak/termui/v3"
 	"github.com/lukesampson/figlet/figletlib"
 )
 
 // FigletBanner is an animated header that uses figlet fonts to render the color
-// faded header text. Call Tick() to animate it.
+// faded header text. Call Tick() to animate it. Text that doesn't fit scrolls
+// sideways when Scroll() is called.
 type FigletBanner struct {
 	termui.Block
 	Text       string
 	TextStyle  termui.Style
 	FigletFont *figletlib.Font
+	// the colors the text fades through
+	FadeColors []termui.Color
 	fadeOffset int
+
+	scrollOffset int
+	scrolledText string
 }
 
 func NewFigletBanner() *FigletBanner {
 	return &FigletBanner{
-		Block:     *termui.NewBlock(),
-		TextStyle: termui.Theme.Paragraph.Text,
+		Block:      *termui.NewBlock(),
+		TextStyle:  termui.Theme.Paragraph.Text,
+		FadeColors: DefaultFadeColors(),
 	}
 }
 
-var (
-	fadeColors []termui.Color
-)
+// DefaultFadeColors is the blue/green/purple fade used by the banner and the faded block
+func DefaultFadeColors() []termui.Color {
+	return FadeColorRanges([][2]int{{16, 50}, {195, 162}, {50, 159}, {50, 16}})
+}
 
-func init() {
-	fadeColors = make([]termui.Color, 0)
+// FadeColorRanges builds a fade from ranges of 256 color indexes. Both ends are
+// included, and a range can go up or down.
+func FadeColorRanges(ranges [][2]int) []termui.Color {
+	fadeColors := make([]termui.Color, 0)
 
-	for i := 16; i < 51; i++ {
-		fadeColors = append(fadeColors, termui.Color(i))
-	}
-	for i := 195; i > 161; i-- {
-		fadeColors = append(fadeColors, termui.Color(i))
-	}
-	for i := 50; i < 160; i++ {
-		fadeColors = append(fadeColors, termui.Color(i))
-	}
-	for i := 50; i > 15; i-- {
-		fadeColors = append(fadeColors, termui.Color(i))
+	for _, r := range ranges {
+		step := 1
+		if r[1] < r[0] {
+			step = -1
+		}
+		for i := r[0]; i != r[1]+step; i += step {
+			fadeColors = append(fadeColors, termui.Color(i))
+		}
 	}
 
+	return fadeColors
 }
 
 func (f *FigletBanner) Tick() {
-	f.fadeOffset = (f.fadeOffset + 1) % len(fadeColors)
+	if len(f.FadeColors) == 0 {
+		return
+	}
+	f.fadeOffset = (f.fadeOffset + 1) % len(f.FadeColors)
+}
+
+// Scroll moves text that's too wide for the banner one column to the left
+func (f *FigletBanner) Scroll() {
+	f.scrollOffset++
 }
 
 func (f *FigletBanner) Draw(buf *termui.Buffer) {
 	f.Block.Draw(buf)
 
-	settings := f.FigletFont.Settings()
-	renderedText := figletlib.SprintMsg(f.Text, f.FigletFont, f.Inner.Max.X, settings, "center")
+	if f.Text != f.scrolledText {
+		// start new text from the beginning
+		f.scrolledText = f.Text
+		f.scrollOffset = 0
+	}
 
-	rows := f.cyclicHoriFade(renderedText)
+	rows := f.cyclicHoriFade(f.layout(f.render()))
 
 	for y, row := range rows {
 		if y+f.Inner.Min.Y >= f.Inner.Max.Y {
@@ -70,31 +91,82 @@ func (f *FigletBanner) Draw(buf *termui.Buffer) {
 	}
 }
 
-func (f *FigletBanner) cyclicHoriFade(s string) [][]termui.Cell {
-	runes := []rune(s)
+// render draws the text on one line, however wide it gets
+func (f *FigletBanner) render() [][]rune {
+	settings := f.FigletFont.Settings()
+	lines := figletlib.GetLines(f.Text, f.FigletFont, math.MaxInt32, settings)
+
+	rows := make([][]rune, 0)
+	for _, line := range lines {
+		for _, art := range line.Art() {
+			row := make([]rune, len(art))
+			for i, r := range art {
+				if r == settings.HardBlank() {
+					r = ' '
+				}
+				row[i] = r
+			}
+			rows = append(rows, row)
+		}
+	}
+	return rows
+}
+
+// layout centers the text if it fits, otherwise it's scrolled
+func (f *FigletBanner) layout(rows [][]rune) [][]rune {
+	width := 0
+	for _, row := range rows {
+		if len(row) > width {
+			width = len(row)
+		}
+	}
+
+	space := f.Inner.Dx()
+	if width <= space {
+		padding := []rune(strings.Repeat(" ", (space-width)/2))
+		for i, row := range rows {
+			rows[i] = append(padding, row...)
+		}
+		return rows
+	}
+
+	// leave a gap between the end of the text and the start of it coming around again
+	loop := width + space/3
+	offset := f.scrollOffset % loop
+	for i, row := range rows {
+		scrolled := make([]rune, space)
+		for x := range scrolled {
+			pos := (offset + x) % loop
+			if pos < len(row) {
+				scrolled[x] = row[pos]
+			} else {
+				scrolled[x] = ' '
+			}
+		}
+		rows[i] = scrolled
+	}
+	return rows
+}
 
+func (f *FigletBanner) cyclicHoriFade(lines [][]rune) [][]termui.Cell {
 	fadeOffset := f.fadeOffset
 
-	rows := make([][]termui.Cell, 0)
-	row := make([]termui.Cell, 0, 100)
-	colorIndex := fadeOffset
-	for _, rune := range runes {
-		if rune == '\n' {
-			colorIndex = fadeOffset + len(rows)
-			rows = append(rows, row)
-			row = make([]termui.Cell, 0, 100)
-		} else {
+	rows := make([][]termui.Cell, 0, len(lines))
+	for y, line := range lines {
+		colorIndex := fadeOffset + y
+		row := make([]termui.Cell, 0, len(line))
+		for _, rune := range line {
 			colorIndex++
+			style := f.TextStyle
+			if len(f.FadeColors) > 0 {
+				style = termui.NewStyle(f.FadeColors[colorIndex%len(f.FadeColors)])
+			}
 			cell := termui.Cell{
 				Rune:  rune,
-				Style: termui.NewStyle(fadeColors[colorIndex%len(fadeColors)]),
+				Style: style,
 			}
 			row = append(row, cell)
 		}
-
-	}
-
-	if len(row) > 0 {
 		rows = append(rows, row)
 	}
 